@@ -1,21 +1,34 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"avito-tech-go/internal/config"
+	"avito-tech-go/internal/logging"
 	"avito-tech-go/internal/server"
 )
 
 func main() {
 	cfg, err := config.LoadConfig()
 	if err != nil {
-		log.Fatalf("Ошибка загрузки конфигурации: %v", err)
+		logging.New(os.Stderr, slog.LevelInfo).Error("failed to load config", "error", err)
+		os.Exit(1)
 	}
 
-	log.Printf("Конфигурация успешно загружена: %+v", cfg)
+	logger := logging.New(os.Stdout, cfg.LogLevel)
+	slog.SetDefault(logger)
+	logger.Info("config loaded", "config", cfg)
 
-	if err := server.Run(cfg); err != nil {
-		log.Fatalf("Ошибка при запуске сервера: %v", err)
+	// SIGTERM from the orchestrator or Ctrl+C stops the server gracefully.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = server.Run(ctx, cfg, logger)
+	stop()
+	if err != nil {
+		logger.Error("server stopped", "error", err)
+		os.Exit(1)
 	}
 }
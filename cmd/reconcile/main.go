@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"avito-tech-go/internal/config"
+	"avito-tech-go/internal/logging"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"avito-tech-go/pkg/database"
+)
+
+// reconcile recomputes every balance and inventory from the transactions table and
+// reports mismatches. It exits with status 1 when mismatches remain.
+func main() {
+	format := flag.String("format", "text", "report format: text or json")
+	fix := flag.Bool("fix", false, "correct mismatched balances and post the difference to the ledger")
+	flag.Parse()
+
+	if *format != "text" && *format != "json" {
+		log.Fatalf("unknown format %q", *format)
+	}
+
+	mismatches, err := run(*format, *fix)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if mismatches {
+		os.Exit(1)
+	}
+}
+
+// run audits the database, fixing balances first if asked to, writes the report and
+// reports whether mismatches remain. It returns before main exits, so the connection
+// pool is closed.
+func run(format string, fix bool) (bool, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return false, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	db, err := database.NewDBConnection(cfg, logging.New(os.Stderr, cfg.LogLevel))
+	if err != nil {
+		return false, fmt.Errorf("failed to init db: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return false, fmt.Errorf("failed to init db: %w", err)
+	}
+	defer sqlDB.Close()
+
+	auditService := services.NewAuditService(repositories.NewUnitOfWork(db))
+
+	ctx := context.Background()
+	report, err := auditService.Audit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("audit failed: %w", err)
+	}
+
+	if fix && len(report.BalanceMismatches) > 0 {
+		fixed, err := auditService.FixBalances(ctx, report)
+		if err != nil {
+			return false, fmt.Errorf("fixed %d balances before failing: %w", fixed, err)
+		}
+		log.Printf("fixed %d balances", fixed)
+
+		if report, err = auditService.Audit(ctx); err != nil {
+			return false, fmt.Errorf("audit failed: %w", err)
+		}
+	}
+
+	if err := writeReport(os.Stdout, format, report); err != nil {
+		return false, fmt.Errorf("failed to write report: %w", err)
+	}
+	return report.HasMismatches(), nil
+}
+
+func writeReport(w io.Writer, format string, report *services.AuditReport) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	if _, err := fmt.Fprintf(w, "Users checked: %d\n", report.UsersChecked); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "Balance mismatches: %d\n", len(report.BalanceMismatches)); err != nil {
+		return err
+	}
+	for _, m := range report.BalanceMismatches {
+		if _, err := fmt.Fprintf(w, "  user %d (%s): stored %d, expected %d\n",
+			m.UserID, m.Username, m.StoredCoins, m.ExpectedCoins); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "Inventory mismatches: %d\n", len(report.InventoryMismatches)); err != nil {
+		return err
+	}
+	for _, m := range report.InventoryMismatches {
+		itemType := m.ItemType
+		if itemType == "" {
+			itemType = "all items"
+		}
+		if _, err := fmt.Fprintf(w, "  user %d (%s), %s: quantity %d, purchased %d\n",
+			m.UserID, m.Username, itemType, m.Quantity, m.Purchased); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,18 +1,83 @@
 package config
 
 import (
+	"avito-tech-go/internal/logging"
+	"fmt"
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+	// The runtime image has no zoneinfo; SCHEDULE_TIMEZONE relies on the embedded copy.
+	_ "time/tzdata"
 )
 
+// Config is the configuration of the service. Fields tagged `secret:"true"` are
+// redacted when the config is logged or printed.
 type Config struct {
-	AppPort   string
-	DBHost    string
-	DBPort    int
-	DBUser    string
-	DBPass    string
-	DBName    string
-	JWTSecret string
+	AppPort         string
+	DBHost          string
+	DBPort          int
+	DBUser          string
+	DBPass          string `secret:"true"`
+	DBName          string
+	JWTSecret       string `secret:"true"`
+	IdempotencyTTL  time.Duration
+	AdminUsernames  []string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// AuthAutoRegister keeps the legacy behaviour of /api/auth, which registers unknown users.
+	AuthAutoRegister bool
+	// LoginMaxAttempts and LoginMaxAttemptsPerIP are the failed logins allowed before
+	// a lockout that starts at LoginLockoutBase and doubles up to LoginLockoutMax.
+	LoginMaxAttempts      int
+	LoginMaxAttemptsPerIP int
+	LoginLockoutBase      time.Duration
+	LoginLockoutMax       time.Duration
+	// CoinRequestTTL is how long a coin request stays payable.
+	CoinRequestTTL time.Duration
+	// ScheduleLocation is the time zone cron schedules of recurring transfers use.
+	ScheduleLocation *time.Location
+	// TransferMaxAmount, TransferDailyAmount and TransferDailyCount are the default
+	// transfer limits per transfer and per rolling 24 hours; zero disables a limit.
+	TransferMaxAmount   int
+	TransferDailyAmount int
+	TransferDailyCount  int
+	// RefundWindow is how long after a purchase the buyer may refund it.
+	RefundWindow time.Duration
+	// AllowanceAmount coins are issued to every user once per AllowancePeriod (daily,
+	// weekly or monthly), but never above AllowanceMaxBalance; zero amount disables
+	// the allowance and zero cap means no cap.
+	AllowanceAmount     int
+	AllowancePeriod     string
+	AllowanceMaxBalance int
+	// LogLevel is the lowest level logged; DBSlowQuery is the duration above which a
+	// query is logged as slow, zero to disable.
+	LogLevel    slog.Level
+	DBSlowQuery time.Duration
+	// RequestTimeout is the deadline of the work done for one HTTP request; zero
+	// disables it.
+	RequestTimeout time.Duration
+	// ShutdownTimeout is how long in-flight requests are given to finish after a stop
+	// signal before the server closes their connections.
+	ShutdownTimeout time.Duration
+	// TracingExporter is where spans are sent: "none", "stdout" or "otlp". The OTLP
+	// endpoint is read by the exporter from the standard OTEL_EXPORTER_OTLP_* variables.
+	TracingExporter string
+	// TrustedProxies are the addresses or CIDRs of the proxies whose X-Forwarded-For
+	// and X-Real-IP headers are believed; none by default, so the client IP is the
+	// peer address and per-IP login lockouts can not be dodged with a forged header.
+	TrustedProxies []string
+}
+
+// LogValue makes slog print the config with secrets redacted.
+func (c Config) LogValue() slog.Value {
+	return logging.StructValue(c)
+}
+
+// String makes fmt print the config with secrets redacted.
+func (c Config) String() string {
+	return c.LogValue().String()
 }
 
 func LoadConfig() (*Config, error) {
@@ -26,14 +91,152 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	idempotencyTTL, err := getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	accessTokenTTL, err := getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshTokenTTL, err := getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	authAutoRegister, err := getEnvBool("AUTH_AUTO_REGISTER", true)
+	if err != nil {
+		return nil, err
+	}
+
+	loginMaxAttempts, err := getEnvInt("LOGIN_MAX_ATTEMPTS", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	loginMaxAttemptsPerIP, err := getEnvInt("LOGIN_MAX_ATTEMPTS_PER_IP", 20)
+	if err != nil {
+		return nil, err
+	}
+
+	loginLockoutBase, err := getEnvDuration("LOGIN_LOCKOUT_BASE", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	loginLockoutMax, err := getEnvDuration("LOGIN_LOCKOUT_MAX", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	coinRequestTTL, err := getEnvDuration("COIN_REQUEST_TTL", 7*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	scheduleLocation, err := time.LoadLocation(getEnv("SCHEDULE_TIMEZONE", "UTC"))
+	if err != nil {
+		return nil, err
+	}
+
+	transferMaxAmount, err := getEnvInt("TRANSFER_MAX_AMOUNT", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	transferDailyAmount, err := getEnvInt("TRANSFER_DAILY_AMOUNT", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	transferDailyCount, err := getEnvInt("TRANSFER_DAILY_COUNT", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	refundWindow, err := getEnvDuration("REFUND_WINDOW", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	allowanceAmount, err := getEnvInt("ALLOWANCE_AMOUNT", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	allowancePeriod := getEnv("ALLOWANCE_PERIOD", "monthly")
+	switch allowancePeriod {
+	case "daily", "weekly", "monthly":
+	default:
+		return nil, fmt.Errorf("ALLOWANCE_PERIOD must be daily, weekly or monthly, got %q", allowancePeriod)
+	}
+
+	allowanceMaxBalance, err := getEnvInt("ALLOWANCE_MAX_BALANCE", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var logLevel slog.Level
+	if err := logLevel.UnmarshalText([]byte(getEnv("LOG_LEVEL", "info"))); err != nil {
+		return nil, err
+	}
+
+	dbSlowQuery, err := getEnvDuration("DB_SLOW_QUERY", 200*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	requestTimeout, err := getEnvDuration("REQUEST_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	shutdownTimeout, err := getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	tracingExporter := getEnv("TRACING_EXPORTER", "none")
+	switch tracingExporter {
+	case "none", "stdout", "otlp":
+	default:
+		return nil, fmt.Errorf("TRACING_EXPORTER must be none, stdout or otlp, got %q", tracingExporter)
+	}
+
 	cfg := &Config{
-		AppPort:   getEnv("APP_PORT", "8080"),
-		DBHost:    getEnv("DB_HOST", "localhost"),
-		DBPort:    dbPort,
-		DBUser:    getEnv("DB_USER", "postgres"),
-		DBPass:    getEnv("DB_PASSWORD", "postgres"),
-		DBName:    getEnv("DB_NAME", "avito_shop"),
-		JWTSecret: getEnv("JWT_SECRET", "avitomiraines"),
+		AppPort:               getEnv("APP_PORT", "8080"),
+		DBHost:                getEnv("DB_HOST", "localhost"),
+		DBPort:                dbPort,
+		DBUser:                getEnv("DB_USER", "postgres"),
+		DBPass:                getEnv("DB_PASSWORD", "postgres"),
+		DBName:                getEnv("DB_NAME", "avito_shop"),
+		JWTSecret:             getEnv("JWT_SECRET", "avitomiraines"),
+		IdempotencyTTL:        idempotencyTTL,
+		AdminUsernames:        getEnvList("ADMIN_USERNAMES"),
+		AccessTokenTTL:        accessTokenTTL,
+		RefreshTokenTTL:       refreshTokenTTL,
+		AuthAutoRegister:      authAutoRegister,
+		LoginMaxAttempts:      loginMaxAttempts,
+		LoginMaxAttemptsPerIP: loginMaxAttemptsPerIP,
+		LoginLockoutBase:      loginLockoutBase,
+		LoginLockoutMax:       loginLockoutMax,
+		CoinRequestTTL:        coinRequestTTL,
+		ScheduleLocation:      scheduleLocation,
+		TransferMaxAmount:     transferMaxAmount,
+		TransferDailyAmount:   transferDailyAmount,
+		TransferDailyCount:    transferDailyCount,
+		RefundWindow:          refundWindow,
+		AllowanceAmount:       allowanceAmount,
+		AllowancePeriod:       allowancePeriod,
+		AllowanceMaxBalance:   allowanceMaxBalance,
+		LogLevel:              logLevel,
+		DBSlowQuery:           dbSlowQuery,
+		RequestTimeout:        requestTimeout,
+		ShutdownTimeout:       shutdownTimeout,
+		TracingExporter:       tracingExporter,
+		TrustedProxies:        getEnvList("TRUSTED_PROXIES"),
 	}
 
 	return cfg, nil
@@ -46,3 +249,38 @@ func getEnv(key, defaultValue string) string {
 	}
 	return val
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultValue, nil
+	}
+	return time.ParseDuration(val)
+}
+
+func getEnvInt(key string, defaultValue int) (int, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(val)
+}
+
+func getEnvBool(key string, defaultValue bool) (bool, error) {
+	val := os.Getenv(key)
+	if val == "" {
+		return defaultValue, nil
+	}
+	return strconv.ParseBool(val)
+}
+
+// getEnvList splits a comma-separated variable, skipping empty elements.
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
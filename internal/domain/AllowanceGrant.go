@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// AllowanceGrant records that a user got the allowance of a period, such as "2026-10".
+// The primary key makes issuing idempotent per user and period. TransactionID is nil
+// when nothing was issued because the balance was already at the cap.
+type AllowanceGrant struct {
+	UserID        uint   `gorm:"primaryKey;autoIncrement:false"`
+	Period        string `gorm:"primaryKey;size:16"`
+	Amount        int    `gorm:"not null"`
+	TransactionID *uint
+	CreatedAt     time.Time
+}
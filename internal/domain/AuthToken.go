@@ -0,0 +1,30 @@
+package domain
+
+import "time"
+
+// RefreshToken is a long-lived token that can be exchanged for a new access token.
+// Only a hash of the token is stored. Every refresh revokes the used token and issues
+// a new one, so a token that is presented twice has leaked.
+// swagger:model RefreshToken
+type RefreshToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;size:64;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// Revoked reports whether the token was rotated or revoked on logout.
+func (t *RefreshToken) Revoked() bool {
+	return t.RevokedAt != nil
+}
+
+// RevokedToken is an access token that was revoked before it expired. Rows are kept only
+// until the token would have expired anyway.
+// swagger:model RevokedToken
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;size:64"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,13 @@
+package domain
+
+import "time"
+
+// CartItem is a merch item a user has put in their cart but not bought yet.
+// swagger:model CartItem
+type CartItem struct {
+	UserID    uint   `gorm:"primaryKey;autoIncrement:false"`
+	ItemType  string `gorm:"primaryKey;size:100"`
+	Quantity  int    `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
@@ -0,0 +1,34 @@
+package domain
+
+import "time"
+
+// CoinRequestStatus is the state of a coin request.
+type CoinRequestStatus string
+
+const (
+	// CoinRequestPending is waiting for the payer to accept or decline it.
+	CoinRequestPending CoinRequestStatus = "pending"
+	// CoinRequestAccepted was paid; TransactionID points at the transfer.
+	CoinRequestAccepted CoinRequestStatus = "accepted"
+	// CoinRequestDeclined was rejected by the payer.
+	CoinRequestDeclined CoinRequestStatus = "declined"
+	// CoinRequestCancelled was withdrawn by the requester.
+	CoinRequestCancelled CoinRequestStatus = "cancelled"
+	// CoinRequestExpired was not answered in time.
+	CoinRequestExpired CoinRequestStatus = "expired"
+)
+
+// CoinRequest is a request from one user to another to send coins.
+// swagger:model CoinRequest
+type CoinRequest struct {
+	ID            uint              `gorm:"primaryKey"`
+	RequesterID   uint              `gorm:"not null;index"`
+	PayerID       uint              `gorm:"not null;index:idx_coin_requests_payer_status,priority:1"`
+	Amount        int               `gorm:"not null"`
+	Message       string            `gorm:"size:200"`
+	Status        CoinRequestStatus `gorm:"size:20;not null;index:idx_coin_requests_payer_status,priority:2"`
+	TransactionID *uint
+	ExpiresAt     time.Time `gorm:"not null;index"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
@@ -0,0 +1,20 @@
+package domain
+
+import "time"
+
+// IdempotencyKey stores the outcome of a request sent with an Idempotency-Key header,
+// so that a retried request can be answered without running it again.
+// swagger:model IdempotencyKey
+type IdempotencyKey struct {
+	UserID       uint   `gorm:"primaryKey;autoIncrement:false"`
+	Key          string `gorm:"column:idempotency_key;primaryKey;size:255"`
+	RequestHash  string `gorm:"not null;size:64"`
+	StatusCode   int    `gorm:"not null;default:0"`
+	ResponseBody []byte
+	CreatedAt    time.Time `gorm:"index"`
+}
+
+// Completed reports whether the response of the original request has been stored.
+func (k *IdempotencyKey) Completed() bool {
+	return k.StatusCode != 0
+}
@@ -0,0 +1,48 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// ShopAccountCode is the ledger account that receives coins spent on merch.
+	ShopAccountCode = "shop"
+	// IssuanceAccountCode is the ledger account coins are issued from; its balance is
+	// the negated amount of coins in circulation.
+	IssuanceAccountCode = "issuance"
+)
+
+// UserAccountCode returns the ledger account code of a user.
+func UserAccountCode(userID uint) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// LedgerAccount is an account of the double-entry ledger.
+// swagger:model LedgerAccount
+type LedgerAccount struct {
+	ID        uint   `gorm:"primaryKey"`
+	Code      string `gorm:"uniqueIndex;not null;size:100"`
+	UserID    *uint  `gorm:"uniqueIndex"`
+	CreatedAt time.Time
+}
+
+// LedgerEntry is a single posting to a ledger account. A positive amount is a credit
+// (the account balance grows), a negative amount is a debit. Entries written for one
+// operation always sum up to zero.
+// swagger:model LedgerEntry
+type LedgerEntry struct {
+	ID            uint  `gorm:"primaryKey"`
+	TransactionID *uint `gorm:"index"`
+	AccountID     uint  `gorm:"not null;index"`
+	Amount        int   `gorm:"not null"`
+	CreatedAt     time.Time
+}
+
+// BalanceDrift describes a user whose cached balance differs from the ledger.
+type BalanceDrift struct {
+	UserID      uint   `json:"userId"`
+	Username    string `json:"username"`
+	CachedCoins int    `json:"cachedCoins"`
+	LedgerCoins int    `json:"ledgerCoins"`
+}
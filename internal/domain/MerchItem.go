@@ -1,8 +1,14 @@
 package domain
 
+import "gorm.io/gorm"
+
 // MerchItem represents a merchandise item available for purchase.
+// Retired items are soft-deleted, so inventory and purchase history keep referring to them.
+// Stock is the number of items left for physically limited merch; nil means unlimited.
 // swagger:model MerchItem
 type MerchItem struct {
-	Price    int    `gorm:"not null"`
-	ItemType string `gorm:"primaryKey;not null;size:100"`
+	Price     int    `gorm:"not null"`
+	ItemType  string `gorm:"primaryKey;not null;size:100"`
+	Stock     *int
+	DeletedAt gorm.DeletedAt `gorm:"index"`
 }
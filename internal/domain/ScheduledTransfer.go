@@ -0,0 +1,33 @@
+package domain
+
+import "time"
+
+// ScheduledTransfer is a transfer that the server makes on behalf of its owner,
+// either once at a given time or repeatedly on a cron schedule.
+// NextRunAt is nil once a one-shot transfer has run.
+// swagger:model ScheduledTransfer
+type ScheduledTransfer struct {
+	ID        uint       `gorm:"primaryKey"`
+	OwnerID   uint       `gorm:"not null;index"`
+	ToUserID  uint       `gorm:"not null"`
+	Amount    int        `gorm:"not null"`
+	Message   string     `gorm:"size:200"`
+	Category  string     `gorm:"size:32"`
+	Schedule  string     `gorm:"size:100"`
+	Active    bool       `gorm:"not null;index:idx_scheduled_transfers_due,priority:1"`
+	NextRunAt *time.Time `gorm:"index:idx_scheduled_transfers_due,priority:2"`
+	LastRunAt *time.Time
+	LastError string `gorm:"size:255"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ScheduledTransferRun records one execution of a scheduled transfer.
+// Error is empty when the transfer succeeded.
+type ScheduledTransferRun struct {
+	ID                  uint      `gorm:"primaryKey"`
+	ScheduledTransferID uint      `gorm:"not null;index"`
+	ScheduledFor        time.Time `gorm:"not null"`
+	Error               string    `gorm:"size:255"`
+	CreatedAt           time.Time
+}
@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+// SecurityEventLoginLockout is recorded when too many failed logins lock a username or an IP.
+const SecurityEventLoginLockout = "login_lockout"
+
+// SecurityEvent is an audit record of a security-relevant event. Username or IP is empty
+// when the event is not tied to it.
+// swagger:model SecurityEvent
+type SecurityEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	Type      string    `gorm:"not null;size:50;index"`
+	Username  string    `gorm:"size:255;index"`
+	IP        string    `gorm:"size:64"`
+	Details   string    `gorm:"size:255"`
+	CreatedAt time.Time `gorm:"index"`
+}
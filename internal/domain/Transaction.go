@@ -10,15 +10,30 @@ const (
 	Transfer TransactionType = "transfer"
 	// Purchase indicates a purchase transaction from the shop.
 	Purchase TransactionType = "purchase"
+	// Reversal returns the coins of a transfer from its recipient (FromUserID)
+	// to its sender (ToUserID).
+	Reversal TransactionType = "reversal"
+	// Refund returns the coins of a purchase from the shop to the buyer (FromUserID).
+	Refund TransactionType = "refund"
+	// Grant issues the periodic allowance to FromUserID.
+	Grant TransactionType = "grant"
 )
 
 // Transaction represents a coin transaction in the system.
+// The composite indexes serve the paginated history of a user, newest first.
+// ReversalOfID links a reversal or refund to the transaction it undoes; the unique
+// index makes sure a transaction is undone at most once.
 // swagger:model Transaction
 type Transaction struct {
-	ID         uint            `gorm:"primaryKey"`
-	FromUserID uint            `gorm:"not null;index"`
-	ToUserID   *uint           `gorm:"index"`
-	Amount     int             `gorm:"not null"`
-	Type       TransactionType `gorm:"size:20;not null"`
-	CreatedAt  time.Time
+	ID           uint            `gorm:"primaryKey"`
+	FromUserID   uint            `gorm:"not null;index:idx_transactions_from_created,priority:1"`
+	ToUserID     *uint           `gorm:"index:idx_transactions_to_created,priority:1"`
+	Amount       int             `gorm:"not null"`
+	Type         TransactionType `gorm:"size:20;not null"`
+	ItemType     string          `gorm:"size:100"`
+	Quantity     int             `gorm:"not null;default:1"`
+	Message      string          `gorm:"size:200"`
+	Category     string          `gorm:"size:32;index"`
+	ReversalOfID *uint           `gorm:"uniqueIndex"`
+	CreatedAt    time.Time       `gorm:"index:idx_transactions_from_created,priority:2;index:idx_transactions_to_created,priority:2"`
 }
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// TransferLimit overrides the configured transfer limits for one user.
+// A nil field falls back to the configured default; zero means no limit.
+// swagger:model TransferLimit
+type TransferLimit struct {
+	UserID      uint `gorm:"primaryKey;autoIncrement:false"`
+	MaxAmount   *int
+	DailyAmount *int
+	DailyCount  *int
+	UpdatedAt   time.Time
+}
@@ -2,13 +2,25 @@ package domain
 
 import "time"
 
+// InitialCoins is the balance every new user starts with.
+const InitialCoins = 1000
+
+const (
+	// RoleUser is the role of a regular employee.
+	RoleUser = "user"
+	// RoleAdmin is the role allowed to manage the shop.
+	RoleAdmin = "admin"
+)
+
 // User represents an employee in the system.
+// Coins caches the balance of the user's ledger account.
 // swagger:model User
 type User struct {
 	ID           uint   `gorm:"primaryKey"`
 	Username     string `gorm:"uniqueIndex;not null;size:255"`
 	PasswordHash string `gorm:"not null; size:255"`
 	Coins        int    `gorm:"default:1000"`
+	Role         string `gorm:"not null;size:20;default:user"`
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 }
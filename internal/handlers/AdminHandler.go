@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateMerchItemRequest represents the request payload for adding a merch item.
+// swagger:model CreateMerchItemRequest
+// Stock is optional; items without it are never sold out.
+type CreateMerchItemRequest struct {
+	Item  string `json:"item" binding:"required"`
+	Price int    `json:"price" binding:"required"`
+	Stock *int   `json:"stock"`
+}
+
+// SetMerchItemStockRequest represents the request payload for changing the stock of a
+// merch item. A null stock makes it unlimited.
+// swagger:model SetMerchItemStockRequest
+type SetMerchItemStockRequest struct {
+	Stock *int `json:"stock"`
+}
+
+// UpdateMerchItemRequest represents the request payload for repricing a merch item.
+// swagger:model UpdateMerchItemRequest
+type UpdateMerchItemRequest struct {
+	Price int `json:"price" binding:"required"`
+}
+
+// CreateMerchItemHandler godoc
+// @Summary      Add a merch item to the shop
+// @Description  Puts a new item on sale. A previously retired item with the same type is brought back with the new price. Admin only.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      CreateMerchItemRequest  true  "Merch item payload"
+// @Success      201   {object}  map[string]interface{} "Item created"
+// @Failure      400   {object}  map[string]string "Bad request"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      403   {object}  map[string]string "Admin role required"
+// @Failure      409   {object}  map[string]string "Item already exists"
+// @Router       /api/admin/merch [post]
+func CreateMerchItemHandler(merchService services.MerchService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateMerchItemRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid JSON request"})
+			return
+		}
+
+		if err := merchService.CreateItem(c.Request.Context(), req.Item, req.Price, req.Stock); err != nil {
+			c.JSON(merchAdminErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"item":  req.Item,
+			"price": req.Price,
+			"stock": req.Stock,
+		})
+	}
+}
+
+// UpdateMerchItemHandler godoc
+// @Summary      Change the price of a merch item
+// @Description  Sets a new price for an item on sale. Admin only.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        item  path      string                  true  "Merch item type"
+// @Param        body  body      UpdateMerchItemRequest  true  "New price"
+// @Success      200   {object}  map[string]interface{} "Item updated"
+// @Failure      400   {object}  map[string]string "Bad request"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      403   {object}  map[string]string "Admin role required"
+// @Failure      404   {object}  map[string]string "Merch item not found"
+// @Router       /api/admin/merch/{item} [put]
+func UpdateMerchItemHandler(merchService services.MerchService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req UpdateMerchItemRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid JSON request"})
+			return
+		}
+
+		itemType := c.Param("item")
+		if err := merchService.UpdateItemPrice(c.Request.Context(), itemType, req.Price); err != nil {
+			c.JSON(merchAdminErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"item":  itemType,
+			"price": req.Price,
+		})
+	}
+}
+
+// SetMerchItemStockHandler godoc
+// @Summary      Change the stock of a merch item
+// @Description  Sets the number of items left for sale; a null stock makes the item unlimited. Admin only.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        item  path      string                    true  "Merch item type"
+// @Param        body  body      SetMerchItemStockRequest  true  "New stock"
+// @Success      200   {object}  map[string]interface{} "Stock updated"
+// @Failure      400   {object}  map[string]string "Bad request"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      403   {object}  map[string]string "Admin role required"
+// @Failure      404   {object}  map[string]string "Merch item not found"
+// @Router       /api/admin/merch/{item}/stock [put]
+func SetMerchItemStockHandler(merchService services.MerchService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SetMerchItemStockRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid JSON request"})
+			return
+		}
+
+		itemType := c.Param("item")
+		if err := merchService.SetItemStock(c.Request.Context(), itemType, req.Stock); err != nil {
+			c.JSON(merchAdminErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"item":  itemType,
+			"stock": req.Stock,
+		})
+	}
+}
+
+// RetireMerchItemHandler godoc
+// @Summary      Retire a merch item
+// @Description  Takes the item off sale. Inventories and purchase history that mention it are kept. Admin only.
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        item  path  string  true  "Merch item type"
+// @Success      204   "Item retired"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      403   {object}  map[string]string "Admin role required"
+// @Failure      404   {object}  map[string]string "Merch item not found"
+// @Router       /api/admin/merch/{item} [delete]
+func RetireMerchItemHandler(merchService services.MerchService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := merchService.RetireItem(c.Request.Context(), c.Param("item")); err != nil {
+			c.JSON(merchAdminErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func merchAdminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidMerchItem):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrMerchItemNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrMerchItemExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
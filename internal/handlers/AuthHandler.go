@@ -1,9 +1,15 @@
 package handlers
 
 import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"avito-tech-go/internal/metrics"
 	"avito-tech-go/internal/services"
 	"github.com/gin-gonic/gin"
-	"net/http"
 )
 
 // AuthRequest represents the request payload for authentication.
@@ -13,15 +19,31 @@ type AuthRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// AuthResponse represents the response containing the JWT token.
+// AuthResponse represents the response containing the JWT access token and the refresh
+// token that renews it. ExpiresIn is the lifetime of the access token in seconds.
 // swagger:model AuthResponse
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
+}
+
+// RefreshRequest represents the request payload for renewing an access token.
+// swagger:model RefreshRequest
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// LogoutRequest represents the request payload for logging out. The refresh token is
+// optional; when present it is revoked too.
+// swagger:model LogoutRequest
+type LogoutRequest struct {
+	RefreshToken string `json:"refreshToken"`
 }
 
 // AuthHandler godoc
 // @Summary      Authenticate user and return JWT token
-// @Description  If the user does not exist, the service registers the user and returns a token; otherwise, it performs login.
+// @Description  Logs the user in. If auto-registration is enabled and the user does not exist, the service registers the user and returns a token. Prefer /api/login and /api/register.
 // @Tags         auth
 // @Accept       json
 // @Produce      json
@@ -29,8 +51,9 @@ type AuthResponse struct {
 // @Success      200   {object}  AuthResponse
 // @Failure      400   {object}  map[string]string "Invalid request payload"
 // @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      429   {object}  map[string]string "Too many failed login attempts"
 // @Router       /api/auth [post]
-func AuthHandler(authService services.AuthService) gin.HandlerFunc {
+func AuthHandler(authService services.AuthService, autoRegister bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req AuthRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -38,16 +61,193 @@ func AuthHandler(authService services.AuthService) gin.HandlerFunc {
 			return
 		}
 
-		loginToken, err := authService.Login(req.Username, req.Password)
+		var tokens *services.TokenPair
+		var err error
+		if autoRegister {
+			tokens, err = authService.LoginOrRegister(c.Request.Context(), req.Username, req.Password, c.ClientIP())
+		} else {
+			tokens, err = authService.Login(c.Request.Context(), req.Username, req.Password, c.ClientIP())
+		}
+		recordAuthEvent(tokens, err)
 		if err != nil {
-			regToken, regErr := authService.Register(req.Username, req.Password)
-			if regErr != nil {
-				c.JSON(http.StatusUnauthorized, gin.H{"errors": regErr.Error()})
+			writeAuthError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, newAuthResponse(tokens))
+	}
+}
+
+// RegisterHandler godoc
+// @Summary      Register a new user
+// @Description  Creates a user with the initial coin balance and returns a token pair.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      AuthRequest  true  "Registration request payload"
+// @Success      201   {object}  AuthResponse
+// @Failure      400   {object}  map[string]string "Invalid request payload"
+// @Failure      409   {object}  map[string]string "User already exists"
+// @Router       /api/register [post]
+func RegisterHandler(authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req AuthRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid request payload"})
+			return
+		}
+
+		tokens, err := authService.Register(c.Request.Context(), req.Username, req.Password)
+		recordAuthEvent(tokens, err)
+		if err != nil {
+			writeAuthError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, newAuthResponse(tokens))
+	}
+}
+
+// LoginHandler godoc
+// @Summary      Log in
+// @Description  Checks the password of an existing user and returns a token pair. Never creates users.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      AuthRequest  true  "Login request payload"
+// @Success      200   {object}  AuthResponse
+// @Failure      400   {object}  map[string]string "Invalid request payload"
+// @Failure      401   {object}  map[string]string "Invalid username or password"
+// @Failure      429   {object}  map[string]string "Too many failed login attempts"
+// @Router       /api/login [post]
+func LoginHandler(authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req AuthRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid request payload"})
+			return
+		}
+
+		tokens, err := authService.Login(c.Request.Context(), req.Username, req.Password, c.ClientIP())
+		recordAuthEvent(tokens, err)
+		if err != nil {
+			writeAuthError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, newAuthResponse(tokens))
+	}
+}
+
+// RefreshHandler godoc
+// @Summary      Renew the access token
+// @Description  Exchanges a refresh token for a new access token and a new refresh token. The used refresh token is revoked; presenting it again revokes every refresh token of the user.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      RefreshRequest  true  "Refresh token"
+// @Success      200   {object}  AuthResponse
+// @Failure      400   {object}  map[string]string "Invalid request payload"
+// @Failure      401   {object}  map[string]string "Invalid or expired refresh token"
+// @Router       /api/auth/refresh [post]
+func RefreshHandler(authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RefreshRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid request payload"})
+			return
+		}
+
+		tokens, err := authService.Refresh(c.Request.Context(), req.RefreshToken)
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, newAuthResponse(tokens))
+	}
+}
+
+// LogoutHandler godoc
+// @Summary      Log out
+// @Description  Revokes the access token used for this request and, if passed, the refresh token.
+// @Tags         auth
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      LogoutRequest  false  "Refresh token to revoke"
+// @Success      204   "Logged out"
+// @Failure      400   {object}  map[string]string "Invalid request payload"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Router       /api/auth/logout [post]
+func LogoutHandler(authService services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		var req LogoutRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid request payload"})
 				return
 			}
-			c.JSON(http.StatusOK, AuthResponse{Token: regToken})
+		}
+
+		expiresAt, _ := c.Get("tokenExpiresAt")
+		accessExpiresAt, _ := expiresAt.(time.Time)
+
+		err := authService.Logout(c.Request.Context(), userID.(uint), c.GetString("jti"), accessExpiresAt, req.RefreshToken)
+		if errors.Is(err, services.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, AuthResponse{Token: loginToken})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// recordAuthEvent counts the outcome of a login or registration. Errors other than
+// bad credentials are not login failures and are left to the request metrics.
+func recordAuthEvent(tokens *services.TokenPair, err error) {
+	switch {
+	case err == nil && tokens.Registered:
+		metrics.AuthEvent(metrics.AuthRegistration)
+	case err == nil:
+		metrics.AuthEvent(metrics.AuthLogin)
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrInvalidCredentials):
+		metrics.AuthEvent(metrics.AuthLoginFailed)
+	}
+}
+
+// writeAuthError maps auth errors to HTTP statuses. Unknown usernames and wrong
+// passwords get the same response.
+func writeAuthError(c *gin.Context, err error) {
+	var locked *services.LoginLockedError
+	switch {
+	case errors.As(err, &locked):
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"errors": services.ErrTooManyLoginAttempts.Error()})
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"errors": services.ErrInvalidCredentials.Error()})
+	case errors.Is(err, services.ErrUserExists):
+		c.JSON(http.StatusConflict, gin.H{"errors": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+	}
+}
+
+func newAuthResponse(tokens *services.TokenPair) AuthResponse {
+	return AuthResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(tokens.ExpiresIn / time.Second),
 	}
 }
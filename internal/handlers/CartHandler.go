@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// AddCartItemRequest represents the request payload for putting an item in the cart.
+// swagger:model AddCartItemRequest
+type AddCartItemRequest struct {
+	Item string `json:"item" binding:"required"`
+	// Quantity is at most services.MaxPurchaseQuantity.
+	Quantity int `json:"quantity" binding:"required,min=1,max=1000"`
+}
+
+// GetCartHandler godoc
+// @Summary      Show the cart
+// @Description  Returns the items in the authenticated user's cart with current prices and the order total.
+// @Tags         cart
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  services.CartResponse
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/cart [get]
+func GetCartHandler(cartService services.CartService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		cart, err := cartService.GetCart(c.Request.Context(), userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, cart)
+	}
+}
+
+// AddCartItemHandler godoc
+// @Summary      Put an item in the cart
+// @Description  Adds the given quantity of a merch item to the cart. Adding an item that is already there increases its quantity.
+// @Tags         cart
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      AddCartItemRequest  true  "Item and quantity"
+// @Success      200   {object}  services.CartResponse
+// @Failure      400   {object}  map[string]string "Bad request"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      404   {object}  map[string]string "Merch item not found"
+// @Router       /api/cart [post]
+func AddCartItemHandler(cartService services.CartService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		var req AddCartItemRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid JSON request"})
+			return
+		}
+
+		if err := cartService.AddItem(c.Request.Context(), userID.(uint), req.Item, req.Quantity); err != nil {
+			c.JSON(cartErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		writeCart(c, cartService, userID.(uint))
+	}
+}
+
+// RemoveCartItemHandler godoc
+// @Summary      Remove an item from the cart
+// @Tags         cart
+// @Security     BearerAuth
+// @Produce      json
+// @Param        item  path      string  true  "Merch item type"
+// @Success      200   {object}  services.CartResponse
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      404   {object}  map[string]string "Item is not in the cart"
+// @Router       /api/cart/{item} [delete]
+func RemoveCartItemHandler(cartService services.CartService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		if err := cartService.RemoveItem(c.Request.Context(), userID.(uint), c.Param("item")); err != nil {
+			c.JSON(cartErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		writeCart(c, cartService, userID.(uint))
+	}
+}
+
+// CheckoutCartHandler godoc
+// @Summary      Buy everything in the cart
+// @Description  Debits coins once for the whole cart and buys every item in a single transaction. If anything cannot be bought, nothing is and the cart is left unchanged.
+// @Tags         cart
+// @Security     BearerAuth
+// @Produce      json
+// @Param        Idempotency-Key  header  string  false  "Unique key that makes retries of this request safe"
+// @Success      200  {object}  services.CheckoutResponse
+// @Failure      400  {object}  map[string]string "Cart is empty or cannot be paid for"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      409  {object}  map[string]string "Item is out of stock or request with this idempotency key is in progress"
+// @Failure      422  {object}  map[string]string "Idempotency key reused with a different request"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/cart/checkout [post]
+func CheckoutCartHandler(cartService services.CartService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		resp, err := cartService.Checkout(c.Request.Context(), userID.(uint))
+		if err != nil {
+			c.JSON(purchaseErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func writeCart(c *gin.Context, cartService services.CartService, userID uint) {
+	cart, err := cartService.GetCart(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cart)
+}
+
+// cartErrorStatus maps cart errors to HTTP statuses.
+func cartErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrMerchItemNotFound), errors.Is(err, services.ErrCartItemNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInvalidQuantity):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateCoinRequestRequest represents the request payload for asking another user for coins.
+// swagger:model CreateCoinRequestRequest
+type CreateCoinRequestRequest struct {
+	FromUser string `json:"fromUser" binding:"required"`
+	Amount   int    `json:"amount" binding:"required"`
+	Message  string `json:"message"`
+}
+
+// CreateCoinRequestHandler godoc
+// @Summary      Ask another user for coins
+// @Description  Creates a pending coin request. No coins move until the payer accepts it; unanswered requests expire.
+// @Tags         coin requests
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      CreateCoinRequestRequest  true  "Payer, amount and optional message"
+// @Success      201   {object}  services.CoinRequestInfo
+// @Failure      400   {object}  map[string]string "Bad request"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Router       /api/coinRequests [post]
+func CreateCoinRequestHandler(requestService services.CoinRequestService, userRepo repositories.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateCoinRequestRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid JSON request"})
+			return
+		}
+
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		payer, err := userRepo.GetUserByName(c.Request.Context(), req.FromUser)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+		if payer == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": "target user not found"})
+			return
+		}
+
+		info, err := requestService.CreateRequest(c.Request.Context(), userID.(uint), payer.ID, req.Amount, req.Message)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, info)
+	}
+}
+
+// IncomingCoinRequestsHandler godoc
+// @Summary      List coin requests to pay
+// @Description  Returns pending, unexpired requests addressed to the authenticated user, newest first.
+// @Tags         coin requests
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}   services.CoinRequestInfo
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/coinRequests/incoming [get]
+func IncomingCoinRequestsHandler(requestService services.CoinRequestService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		requests, err := requestService.GetIncoming(c.Request.Context(), userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, requests)
+	}
+}
+
+// OutgoingCoinRequestsHandler godoc
+// @Summary      List own coin requests
+// @Description  Returns every request created by the authenticated user with its current status, newest first.
+// @Tags         coin requests
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}   services.CoinRequestInfo
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/coinRequests/outgoing [get]
+func OutgoingCoinRequestsHandler(requestService services.CoinRequestService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		requests, err := requestService.GetOutgoing(c.Request.Context(), userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, requests)
+	}
+}
+
+// AcceptCoinRequestHandler godoc
+// @Summary      Pay a coin request
+// @Description  Transfers the requested coins to the requester and marks the request as accepted in one transaction.
+// @Tags         coin requests
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path  int  true  "Coin request ID"
+// @Param        Idempotency-Key  header  string  false  "Unique key that makes retries of this request safe"
+// @Success      200  {object}  services.CoinRequestInfo
+// @Failure      400  {object}  map[string]string "Transfer failed, e.g. not enough coins"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Transfer limit exceeded; code tells which one"
+// @Failure      404  {object}  map[string]string "Coin request not found"
+// @Failure      409  {object}  map[string]string "Coin request was already answered or has expired"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/coinRequests/{id}/accept [post]
+func AcceptCoinRequestHandler(requestService services.CoinRequestService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, requestID, ok := coinRequestParams(c)
+		if !ok {
+			return
+		}
+
+		info, err := requestService.Accept(c.Request.Context(), userID, requestID)
+		if err != nil {
+			if status := coinRequestErrorStatus(err); status != http.StatusBadRequest {
+				c.JSON(status, gin.H{"errors": err.Error()})
+				return
+			}
+			writeTransferError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, info)
+	}
+}
+
+// DeclineCoinRequestHandler godoc
+// @Summary      Decline a coin request
+// @Tags         coin requests
+// @Security     BearerAuth
+// @Param        id  path  int  true  "Coin request ID"
+// @Success      204
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      404  {object}  map[string]string "Coin request not found"
+// @Failure      409  {object}  map[string]string "Coin request was already answered or has expired"
+// @Router       /api/coinRequests/{id}/decline [post]
+func DeclineCoinRequestHandler(requestService services.CoinRequestService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, requestID, ok := coinRequestParams(c)
+		if !ok {
+			return
+		}
+
+		if err := requestService.Decline(c.Request.Context(), userID, requestID); err != nil {
+			c.JSON(coinRequestErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// CancelCoinRequestHandler godoc
+// @Summary      Withdraw an own coin request
+// @Tags         coin requests
+// @Security     BearerAuth
+// @Param        id  path  int  true  "Coin request ID"
+// @Success      204
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      404  {object}  map[string]string "Coin request not found"
+// @Failure      409  {object}  map[string]string "Coin request was already answered or has expired"
+// @Router       /api/coinRequests/{id}/cancel [post]
+func CancelCoinRequestHandler(requestService services.CoinRequestService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, requestID, ok := coinRequestParams(c)
+		if !ok {
+			return
+		}
+
+		if err := requestService.Cancel(c.Request.Context(), userID, requestID); err != nil {
+			c.JSON(coinRequestErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// coinRequestParams reads the authenticated user and the request ID from the path,
+// answering the request itself when either is missing.
+func coinRequestParams(c *gin.Context) (uint, uint, bool) {
+	userID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+		return 0, 0, false
+	}
+
+	requestID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"errors": services.ErrCoinRequestNotFound.Error()})
+		return 0, 0, false
+	}
+
+	return userID.(uint), uint(requestID), true
+}
+
+// coinRequestErrorStatus maps coin request errors to HTTP statuses.
+// Errors of the transfer itself are client errors, as with /api/sendCoin.
+func coinRequestErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrCoinRequestNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrCoinRequestNotPending), errors.Is(err, services.ErrCoinRequestExpired):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// HealthzHandler godoc
+// @Summary      Liveness probe
+// @Description  Answers as long as the process is running and serving HTTP. Does not touch the database. /ping is an alias kept for existing monitoring.
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  map[string]string "status: ok"
+// @Router       /healthz [get]
+// @Router       /ping [get]
+func HealthzHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// ReadyzHandler godoc
+// @Summary      Readiness probe
+// @Description  Answers 200 when the database is reachable and its migrations are applied, 503 otherwise.
+// @Tags         health
+// @Produce      json
+// @Success      200  {object}  map[string]string "status: ready"
+// @Failure      503  {object}  map[string]string "Not ready, with the reason"
+// @Router       /readyz [get]
+func ReadyzHandler(healthService services.HealthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := healthService.Ready(c.Request.Context()); err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"errors": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ready"})
+	}
+}
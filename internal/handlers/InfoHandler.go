@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"avito-tech-go/internal/services"
 	"github.com/gin-gonic/gin"
@@ -25,7 +29,7 @@ func InfoHandler(userService services.UserService) gin.HandlerFunc {
 			return
 		}
 
-		info, err := userService.GetInfo(userID.(uint))
+		info, err := userService.GetInfo(c.Request.Context(), userID.(uint))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
 			return
@@ -34,3 +38,80 @@ func InfoHandler(userService services.UserService) gin.HandlerFunc {
 		c.JSON(http.StatusOK, info)
 	}
 }
+
+// HistoryHandler godoc
+// @Summary      Get a page of the user's coin history
+// @Description  Returns the user's transactions, newest first, with cursor-based pagination. Pass nextCursor of the previous page as cursor to get the next one.
+// @Tags         user
+// @Security     BearerAuth
+// @Produce      json
+// @Param        type          query     string  false  "Transaction type: transfer, purchase, reversal, refund or grant"
+// @Param        direction     query     string  false  "in for received coins, out for spent coins"
+// @Param        counterparty  query     string  false  "Username of the other side of a transfer"
+// @Param        category      query     string  false  "Transfer category, e.g. thanks"
+// @Param        from          query     string  false  "Only transactions at or after this time (RFC 3339)"
+// @Param        to            query     string  false  "Only transactions before this time (RFC 3339)"
+// @Param        cursor        query     string  false  "Cursor from the previous page"
+// @Param        limit         query     int     false  "Page size, 1 to 100 (default 20)"
+// @Success      200  {object}  services.HistoryPage
+// @Failure      400  {object}  map[string]string "Invalid query"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/history [get]
+func HistoryHandler(userService services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		req := services.HistoryRequest{
+			Type:         c.Query("type"),
+			Direction:    c.Query("direction"),
+			Counterparty: c.Query("counterparty"),
+			Category:     c.Query("category"),
+			Cursor:       c.Query("cursor"),
+		}
+
+		var err error
+		if req.From, err = parseTimeQuery(c, "from"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+			return
+		}
+		if req.To, err = parseTimeQuery(c, "to"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+			return
+		}
+		if limit := c.Query("limit"); limit != "" {
+			if req.Limit, err = strconv.Atoi(limit); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"errors": "limit must be a number"})
+				return
+			}
+		}
+
+		page, err := userService.GetHistory(c.Request.Context(), userID.(uint), req)
+		if errors.Is(err, services.ErrInvalidHistoryQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 time", name)
+	}
+	return &t, nil
+}
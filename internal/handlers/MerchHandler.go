@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
 	"avito-tech-go/internal/services"
 	"github.com/gin-gonic/gin"
@@ -14,9 +19,13 @@ import (
 // @Security     BearerAuth
 // @Produce      json
 // @Param        item  path      string  true  "Merch item type"
+// @Param        Idempotency-Key  header  string  false  "Unique key that makes retries of this request safe"
 // @Success      200   {object}  map[string]interface{} "Successful purchase response"
 // @Failure      400   {object}  map[string]string "Bad request"
 // @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      409   {object}  map[string]string "Item is out of stock or request with this idempotency key is in progress"
+// @Failure      422   {object}  map[string]string "Idempotency key reused with a different request"
+// @Failure      500  {object}  map[string]string "Internal server error"
 // @Router       /api/buy/{item} [get]
 func BuyMerchHandler(merchService services.MerchService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -32,9 +41,8 @@ func BuyMerchHandler(merchService services.MerchService) gin.HandlerFunc {
 			return
 		}
 
-		err := merchService.BuyItem(userID.(uint), itemType)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+		if err := merchService.BuyItem(c.Request.Context(), userID.(uint), itemType); err != nil {
+			c.JSON(purchaseErrorStatus(err), gin.H{"errors": err.Error()})
 			return
 		}
 
@@ -44,3 +52,184 @@ func BuyMerchHandler(merchService services.MerchService) gin.HandlerFunc {
 		})
 	}
 }
+
+// PurchaseLineRequest is a single line of a purchase.
+// swagger:model PurchaseLineRequest
+type PurchaseLineRequest struct {
+	Item string `json:"item" binding:"required"`
+	// Quantity is at most services.MaxPurchaseQuantity.
+	Quantity int `json:"quantity" binding:"required,min=1,max=1000"`
+}
+
+// BuyMerchItemsRequest represents the request payload for buying several items at once.
+// swagger:model BuyMerchItemsRequest
+type BuyMerchItemsRequest struct {
+	Items []PurchaseLineRequest `json:"items" binding:"required,dive"`
+}
+
+// BuyMerchItemsHandler godoc
+// @Summary      Purchase several merchandise items at once
+// @Description  Buys every line of the order in a single transaction: either all items are bought or none of them.
+// @Tags         merch
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      BuyMerchItemsRequest  true  "Items and quantities to buy"
+// @Param        Idempotency-Key  header  string  false  "Unique key that makes retries of this request safe"
+// @Success      200   {object}  map[string]interface{} "Successful purchase response"
+// @Failure      400   {object}  map[string]string "Bad request"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      409   {object}  map[string]string "Item is out of stock or request with this idempotency key is in progress"
+// @Failure      422   {object}  map[string]string "Idempotency key reused with a different request"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/buy [post]
+func BuyMerchItemsHandler(merchService services.MerchService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		var req BuyMerchItemsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid JSON request"})
+			return
+		}
+
+		lines := make([]services.PurchaseLine, 0, len(req.Items))
+		for _, item := range req.Items {
+			lines = append(lines, services.PurchaseLine{ItemType: item.Item, Quantity: item.Quantity})
+		}
+
+		spent, err := merchService.BuyItems(c.Request.Context(), userID.(uint), lines)
+		if err != nil {
+			c.JSON(purchaseErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Товары успешно куплены",
+			"items":   req.Items,
+			"spent":   spent,
+		})
+	}
+}
+
+// MerchCatalogHandler godoc
+// @Summary      List merch available in the shop
+// @Description  Returns every merch item with its price and whether the authenticated user can afford it. Supports conditional requests via ETag and If-None-Match.
+// @Tags         merch
+// @Security     BearerAuth
+// @Produce      json
+// @Param        If-None-Match  header    string  false  "ETag of a previously received catalog"
+// @Success      200  {object}  services.CatalogResponse
+// @Success      304  "Catalog has not changed"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/merch [get]
+func MerchCatalogHandler(merchService services.MerchService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		catalog, err := merchService.GetCatalog(c.Request.Context(), userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		writeJSONWithETag(c, catalog)
+	}
+}
+
+// MerchItemHandler godoc
+// @Summary      Get a single merch item
+// @Description  Returns the price of the merch item and whether the authenticated user can afford it. Supports conditional requests via ETag and If-None-Match.
+// @Tags         merch
+// @Security     BearerAuth
+// @Produce      json
+// @Param        item           path      string  true   "Merch item type"
+// @Param        If-None-Match  header    string  false  "ETag of a previously received item"
+// @Success      200  {object}  services.CatalogItem
+// @Success      304  "Item has not changed"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      404  {object}  map[string]string "Merch item not found"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/merch/{item} [get]
+func MerchItemHandler(merchService services.MerchService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		item, err := merchService.GetCatalogItem(c.Request.Context(), userID.(uint), c.Param("item"))
+		if errors.Is(err, services.ErrMerchItemNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"errors": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		writeJSONWithETag(c, item)
+	}
+}
+
+// purchaseErrorStatus maps purchase errors to HTTP statuses. Unknown errors are server
+// errors, so an idempotent request that hit one can be retried.
+func purchaseErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrOutOfStock):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrMerchItemNotFound),
+		errors.Is(err, services.ErrNotEnoughCoins),
+		errors.Is(err, services.ErrInvalidQuantity),
+		errors.Is(err, services.ErrInvalidAmount),
+		errors.Is(err, services.ErrAmountTooLarge),
+		errors.Is(err, services.ErrEmptyPurchase),
+		errors.Is(err, services.ErrCartEmpty):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeJSONWithETag responds with the JSON body and its ETag, or with 304 Not Modified
+// when the client already holds the same representation.
+func writeJSONWithETag(c *gin.Context, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
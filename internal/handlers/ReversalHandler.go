@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ReverseTransferRequest represents the request payload for reversing a transfer.
+// Force reverses the transfer even if the recipient's balance goes negative.
+// swagger:model ReverseTransferRequest
+type ReverseTransferRequest struct {
+	Force  bool   `json:"force"`
+	Reason string `json:"reason"`
+}
+
+// ReverseTransferHandler godoc
+// @Summary      Reverse a transfer
+// @Description  Moves the coins of a transfer back from the recipient to the sender with a compensating "reversal" transaction. Fails if the recipient no longer has the coins unless force is set. Admin only.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int                     true   "Transaction ID"
+// @Param        body  body      ReverseTransferRequest  false  "Force flag and reason"
+// @Success      201   {object}  services.ReversalInfo
+// @Failure      400   {object}  map[string]string "Bad request"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      403   {object}  map[string]string "Admin role required"
+// @Failure      404   {object}  map[string]string "Transaction not found"
+// @Failure      409   {object}  map[string]string "Already reversed, not a transfer or not enough coins"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/admin/transactions/{id}/reverse [post]
+func ReverseTransferHandler(reversalService services.ReversalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transactionID, ok := transactionParam(c)
+		if !ok {
+			return
+		}
+
+		var req ReverseTransferRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid JSON request"})
+				return
+			}
+		}
+
+		info, err := reversalService.ReverseTransfer(c.Request.Context(), transactionID, req.Force, req.Reason)
+		if err != nil {
+			c.JSON(reversalErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, info)
+	}
+}
+
+// RefundPurchaseHandler godoc
+// @Summary      Refund a purchase
+// @Description  Returns a recent purchase to the shop: the items leave the inventory and the coins come back with a "refund" transaction.
+// @Tags         merch
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path  int  true  "Purchase transaction ID, as shown in /api/history"
+// @Param        Idempotency-Key  header  string  false  "Unique key that makes retries of this request safe"
+// @Success      201  {object}  services.ReversalInfo
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      404  {object}  map[string]string "Purchase not found"
+// @Failure      409  {object}  map[string]string "Already refunded, refund window expired or items no longer owned"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/purchases/{id}/refund [post]
+func RefundPurchaseHandler(reversalService services.ReversalService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		transactionID, ok := transactionParam(c)
+		if !ok {
+			return
+		}
+
+		info, err := reversalService.RefundPurchase(c.Request.Context(), userID.(uint), transactionID)
+		if err != nil {
+			c.JSON(reversalErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, info)
+	}
+}
+
+func transactionParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"errors": services.ErrTransactionNotFound.Error()})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// reversalErrorStatus maps reversal and refund errors to HTTP statuses.
+func reversalErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTransactionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrNotReversible),
+		errors.Is(err, services.ErrNotRefundable),
+		errors.Is(err, services.ErrAlreadyReversed),
+		errors.Is(err, services.ErrReversalInsufficientFunds),
+		errors.Is(err, services.ErrRefundWindowExpired),
+		errors.Is(err, services.ErrRefundItemsMissing):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
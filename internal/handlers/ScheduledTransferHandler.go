@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ScheduledTransferRequest represents the request payload for a scheduled transfer.
+// Exactly one of RunAt (RFC 3339, one-shot) and Schedule (cron expression such as
+// "0 10 * * mon", recurring) must be given.
+// swagger:model ScheduledTransferRequest
+type ScheduledTransferRequest struct {
+	ToUser   string     `json:"toUser" binding:"required"`
+	Amount   int        `json:"amount" binding:"required"`
+	Message  string     `json:"message"`
+	Category string     `json:"category"`
+	RunAt    *time.Time `json:"runAt"`
+	Schedule string     `json:"schedule"`
+}
+
+// CreateScheduledTransferHandler godoc
+// @Summary      Schedule a transfer
+// @Description  Schedules a one-shot transfer at runAt or a recurring transfer on a cron schedule. Coins are sent by the server when the transfer is due.
+// @Tags         scheduled transfers
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      ScheduledTransferRequest  true  "Recipient, amount and schedule"
+// @Success      201   {object}  services.ScheduledTransferInfo
+// @Failure      400   {object}  map[string]string "Bad request"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Router       /api/scheduledTransfers [post]
+func CreateScheduledTransferHandler(scheduledService services.ScheduledTransferService, userRepo repositories.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		req, ok := bindScheduledTransfer(c, userRepo)
+		if !ok {
+			return
+		}
+
+		info, err := scheduledService.Create(c.Request.Context(), userID.(uint), req)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, info)
+	}
+}
+
+// ListScheduledTransfersHandler godoc
+// @Summary      List own scheduled transfers
+// @Tags         scheduled transfers
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {array}   services.ScheduledTransferInfo
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/scheduledTransfers [get]
+func ListScheduledTransfersHandler(scheduledService services.ScheduledTransferService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		transfers, err := scheduledService.List(c.Request.Context(), userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, transfers)
+	}
+}
+
+// GetScheduledTransferHandler godoc
+// @Summary      Show a scheduled transfer
+// @Description  Returns the transfer with the outcome of its latest runs, including failures such as not enough coins.
+// @Tags         scheduled transfers
+// @Security     BearerAuth
+// @Produce      json
+// @Param        id  path  int  true  "Scheduled transfer ID"
+// @Success      200  {object}  services.ScheduledTransferInfo
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      404  {object}  map[string]string "Scheduled transfer not found"
+// @Router       /api/scheduledTransfers/{id} [get]
+func GetScheduledTransferHandler(scheduledService services.ScheduledTransferService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, id, ok := scheduledTransferParams(c)
+		if !ok {
+			return
+		}
+
+		info, err := scheduledService.Get(c.Request.Context(), userID, id)
+		if err != nil {
+			c.JSON(scheduledTransferErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, info)
+	}
+}
+
+// UpdateScheduledTransferHandler godoc
+// @Summary      Change a scheduled transfer
+// @Description  Replaces the recipient, amount, note and schedule. A finished one-shot transfer becomes active again.
+// @Tags         scheduled transfers
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        id    path      int                       true  "Scheduled transfer ID"
+// @Param        body  body      ScheduledTransferRequest  true  "Recipient, amount and schedule"
+// @Success      200   {object}  services.ScheduledTransferInfo
+// @Failure      400   {object}  map[string]string "Bad request"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      404   {object}  map[string]string "Scheduled transfer not found"
+// @Failure      409   {object}  map[string]string "Transfer ran while being changed"
+// @Router       /api/scheduledTransfers/{id} [put]
+func UpdateScheduledTransferHandler(scheduledService services.ScheduledTransferService, userRepo repositories.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, id, ok := scheduledTransferParams(c)
+		if !ok {
+			return
+		}
+
+		req, ok := bindScheduledTransfer(c, userRepo)
+		if !ok {
+			return
+		}
+
+		info, err := scheduledService.Update(c.Request.Context(), userID, id, req)
+		if err != nil {
+			c.JSON(scheduledTransferErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, info)
+	}
+}
+
+// DeleteScheduledTransferHandler godoc
+// @Summary      Delete a scheduled transfer
+// @Tags         scheduled transfers
+// @Security     BearerAuth
+// @Param        id  path  int  true  "Scheduled transfer ID"
+// @Success      204
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      404  {object}  map[string]string "Scheduled transfer not found"
+// @Router       /api/scheduledTransfers/{id} [delete]
+func DeleteScheduledTransferHandler(scheduledService services.ScheduledTransferService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, id, ok := scheduledTransferParams(c)
+		if !ok {
+			return
+		}
+
+		if err := scheduledService.Delete(c.Request.Context(), userID, id); err != nil {
+			c.JSON(scheduledTransferErrorStatus(err), gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// bindScheduledTransfer reads the request body and resolves the recipient,
+// answering the request itself when either fails.
+func bindScheduledTransfer(c *gin.Context, userRepo repositories.UserRepository) (services.ScheduledTransferRequest, bool) {
+	var req ScheduledTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid JSON request"})
+		return services.ScheduledTransferRequest{}, false
+	}
+
+	toUser, err := userRepo.GetUserByName(c.Request.Context(), req.ToUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		return services.ScheduledTransferRequest{}, false
+	}
+	if toUser == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"errors": "target user not found"})
+		return services.ScheduledTransferRequest{}, false
+	}
+
+	return services.ScheduledTransferRequest{
+		ToUserID: toUser.ID,
+		Amount:   req.Amount,
+		Note:     services.TransferNote{Message: req.Message, Category: req.Category},
+		RunAt:    req.RunAt,
+		Schedule: req.Schedule,
+	}, true
+}
+
+func scheduledTransferParams(c *gin.Context) (uint, uint, bool) {
+	userID, ok := c.Get("userID")
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+		return 0, 0, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"errors": services.ErrScheduledTransferNotFound.Error()})
+		return 0, 0, false
+	}
+
+	return userID.(uint), uint(id), true
+}
+
+// scheduledTransferErrorStatus maps scheduled transfer errors to HTTP statuses.
+func scheduledTransferErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrScheduledTransferNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrScheduledTransferRunning):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
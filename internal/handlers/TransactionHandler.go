@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 
 	"avito-tech-go/internal/repositories"
@@ -9,10 +10,13 @@ import (
 )
 
 // SendCoinRequest represents the request payload for sending coins.
+// Message and Category are optional notes shown to both sides of the transfer.
 // swagger:model SendCoinRequest
 type SendCoinRequest struct {
-	ToUser string `json:"toUser" binding:"required"`
-	Amount int    `json:"amount" binding:"required"`
+	ToUser   string `json:"toUser" binding:"required"`
+	Amount   int    `json:"amount" binding:"required"`
+	Message  string `json:"message"`
+	Category string `json:"category"`
 }
 
 // SendCoinHandler godoc
@@ -23,9 +27,14 @@ type SendCoinRequest struct {
 // @Accept       json
 // @Produce      json
 // @Param        body  body      SendCoinRequest  true  "Send coin request payload"
+// @Param        Idempotency-Key  header  string  false  "Unique key that makes retries of this request safe"
 // @Success      200   {object}  map[string]interface{} "Successful coin transfer response"
 // @Failure      400   {object}  map[string]string "Bad request"
 // @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      403   {object}  map[string]string "Transfer limit exceeded; code tells which one"
+// @Failure      409   {object}  map[string]string "Request with this idempotency key is in progress"
+// @Failure      422   {object}  map[string]string "Idempotency key reused with a different request"
+// @Failure      500  {object}  map[string]string "Internal server error"
 // @Router       /api/sendCoin [post]
 func SendCoinHandler(txService services.TransactionService, userRepo repositories.UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -41,7 +50,7 @@ func SendCoinHandler(txService services.TransactionService, userRepo repositorie
 			return
 		}
 
-		toUser, err := userRepo.GetUserByName(req.ToUser)
+		toUser, err := userRepo.GetUserByName(c.Request.Context(), req.ToUser)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
 			return
@@ -51,9 +60,10 @@ func SendCoinHandler(txService services.TransactionService, userRepo repositorie
 			return
 		}
 
-		err = txService.TransferCoins(fromUserID.(uint), toUser.ID, req.Amount)
+		note := services.TransferNote{Message: req.Message, Category: req.Category}
+		err = txService.TransferCoins(c.Request.Context(), fromUserID.(uint), toUser.ID, req.Amount, note)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+			writeTransferError(c, err)
 			return
 		}
 
@@ -64,3 +74,94 @@ func SendCoinHandler(txService services.TransactionService, userRepo repositorie
 		})
 	}
 }
+
+// BatchTransferLine is one recipient of a batch transfer.
+// swagger:model BatchTransferLine
+type BatchTransferLine struct {
+	ToUser string `json:"toUser" binding:"required"`
+	Amount int    `json:"amount" binding:"required"`
+}
+
+// SendCoinBatchRequest represents the request payload for sending coins to several users.
+// Message and Category are attached to every transfer of the batch.
+// swagger:model SendCoinBatchRequest
+type SendCoinBatchRequest struct {
+	Transfers []BatchTransferLine `json:"transfers" binding:"required,dive"`
+	Message   string              `json:"message"`
+	Category  string              `json:"category"`
+}
+
+// SendCoinBatchResponse lists the outcome of every line of a batch transfer.
+// swagger:model SendCoinBatchResponse
+type SendCoinBatchResponse struct {
+	Results []services.BatchTransferResult `json:"results"`
+}
+
+// SendCoinBatchHandler godoc
+// @Summary      Send coins to several users
+// @Description  Transfers coins to every listed user in one transaction: either all transfers are made or none is. Recipients and amounts (at most 1000000000 per line) are checked up front and the total is checked against the balance. When some lines are invalid the response lists the error of each of them.
+// @Tags         transaction
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        body  body      SendCoinBatchRequest  true  "Recipients and amounts"
+// @Param        Idempotency-Key  header  string  false  "Unique key that makes retries of this request safe"
+// @Success      200   {object}  SendCoinBatchResponse
+// @Failure      400   {object}  map[string]interface{} "Bad request, with per-recipient results when lines are invalid"
+// @Failure      401   {object}  map[string]string "Unauthorized"
+// @Failure      403   {object}  map[string]string "Transfer limit exceeded; code tells which one"
+// @Failure      409   {object}  map[string]string "Request with this idempotency key is in progress"
+// @Failure      422   {object}  map[string]string "Idempotency key reused with a different request"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/sendCoin/batch [post]
+func SendCoinBatchHandler(txService services.TransactionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SendCoinBatchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid JSON request"})
+			return
+		}
+
+		fromUserID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		lines := make([]services.BatchTransferLine, 0, len(req.Transfers))
+		for _, line := range req.Transfers {
+			lines = append(lines, services.BatchTransferLine{ToUser: line.ToUser, Amount: line.Amount})
+		}
+
+		note := services.TransferNote{Message: req.Message, Category: req.Category}
+		results, err := txService.TransferCoinsBatch(c.Request.Context(), fromUserID.(uint), lines, note)
+		if err != nil {
+			var batchErr *services.BatchTransferError
+			if errors.As(err, &batchErr) {
+				c.JSON(http.StatusBadRequest, gin.H{"errors": err.Error(), "results": batchErr.Results})
+				return
+			}
+			writeTransferError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, SendCoinBatchResponse{Results: results})
+	}
+}
+
+// writeTransferError answers a failed transfer. Limit violations get 403 with a code
+// naming the limit and invalid or unaffordable transfers 400; anything else is a server
+// error, so an idempotent request that hit one can be retried.
+func writeTransferError(c *gin.Context, err error) {
+	var limitErr *services.TransferLimitError
+	if errors.As(err, &limitErr) {
+		c.JSON(http.StatusForbidden, gin.H{"errors": err.Error(), "code": limitErr.Code})
+		return
+	}
+	switch services.TransferFailureReason(err) {
+	case services.FailureNotEnoughCoins, services.FailureInvalid:
+		c.JSON(http.StatusBadRequest, gin.H{"errors": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// MyTransferLimitsHandler godoc
+// @Summary      Show own transfer limits
+// @Description  Returns the transfer limits in effect for the authenticated user and how much of the rolling 24h window is used. Zero means no limit.
+// @Tags         transaction
+// @Security     BearerAuth
+// @Produce      json
+// @Success      200  {object}  services.TransferLimitsInfo
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      500  {object}  map[string]string "Internal server error"
+// @Router       /api/limits [get]
+func MyTransferLimitsHandler(limitService services.TransferLimitService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		info, err := limitService.GetLimits(c.Request.Context(), userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, info)
+	}
+}
+
+// GetTransferLimitsHandler godoc
+// @Summary      Show the transfer limits of a user
+// @Description  Returns the limits in effect, the user's override if any, and the usage of the rolling 24h window. Admin only.
+// @Tags         admin
+// @Security     BearerAuth
+// @Produce      json
+// @Param        username  path  string  true  "Username"
+// @Success      200  {object}  services.TransferLimitsInfo
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Admin role required"
+// @Failure      404  {object}  map[string]string "User not found"
+// @Router       /api/admin/limits/{username} [get]
+func GetTransferLimitsHandler(limitService services.TransferLimitService, userRepo repositories.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := limitsUser(c, userRepo)
+		if !ok {
+			return
+		}
+
+		info, err := limitService.GetLimits(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, info)
+	}
+}
+
+// SetTransferLimitsHandler godoc
+// @Summary      Override the transfer limits of a user
+// @Description  Replaces the user's override. Null fields use the configured default, zero removes the limit. Admin only.
+// @Tags         admin
+// @Security     BearerAuth
+// @Accept       json
+// @Produce      json
+// @Param        username  path      string                          true  "Username"
+// @Param        body      body      services.TransferLimitOverride  true  "Limits"
+// @Success      200  {object}  services.TransferLimitsInfo
+// @Failure      400  {object}  map[string]string "Bad request"
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Admin role required"
+// @Failure      404  {object}  map[string]string "User not found"
+// @Router       /api/admin/limits/{username} [put]
+func SetTransferLimitsHandler(limitService services.TransferLimitService, userRepo repositories.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req services.TransferLimitOverride
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": "invalid JSON request"})
+			return
+		}
+
+		userID, ok := limitsUser(c, userRepo)
+		if !ok {
+			return
+		}
+
+		if err := limitService.SetOverride(c.Request.Context(), userID, req); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, services.ErrInvalidTransferLimit) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"errors": err.Error()})
+			return
+		}
+
+		info, err := limitService.GetLimits(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, info)
+	}
+}
+
+// ClearTransferLimitsHandler godoc
+// @Summary      Reset the transfer limits of a user
+// @Description  Removes the user's override so the configured defaults apply. Admin only.
+// @Tags         admin
+// @Security     BearerAuth
+// @Param        username  path  string  true  "Username"
+// @Success      204
+// @Failure      401  {object}  map[string]string "Unauthorized"
+// @Failure      403  {object}  map[string]string "Admin role required"
+// @Failure      404  {object}  map[string]string "User not found"
+// @Router       /api/admin/limits/{username} [delete]
+func ClearTransferLimitsHandler(limitService services.TransferLimitService, userRepo repositories.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := limitsUser(c, userRepo)
+		if !ok {
+			return
+		}
+
+		if err := limitService.ClearOverride(c.Request.Context(), userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// limitsUser resolves the username from the path, answering the request itself
+// when the user does not exist.
+func limitsUser(c *gin.Context, userRepo repositories.UserRepository) (uint, bool) {
+	user, err := userRepo.GetUserByName(c.Request.Context(), c.Param("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+		return 0, false
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"errors": "user not found"})
+		return 0, false
+	}
+	return user.ID, true
+}
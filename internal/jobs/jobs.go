@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"avito-tech-go/internal/tracing"
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// RunPeriodically calls fn every interval until ctx is cancelled. Each run gets its
+// own span, so the queries of a run are traced together.
+// Errors are logged and do not stop the loop. A run in progress when ctx is cancelled
+// is not interrupted; wg is done once the loop has stopped, so the caller can wait for
+// it before closing the database.
+func RunPeriodically(ctx context.Context, wg *sync.WaitGroup, logger *slog.Logger, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	ticker := time.NewTicker(interval)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run(context.WithoutCancel(ctx), logger, name, fn)
+			}
+		}
+	}()
+}
+
+func run(ctx context.Context, logger *slog.Logger, name string, fn func(ctx context.Context) error) {
+	ctx, span := tracing.Start(ctx, "job "+name)
+	defer span.End()
+
+	if err := fn(ctx); err != nil {
+		span.RecordError(err)
+		logger.ErrorContext(ctx, "job failed", "job", name, "error", err)
+	}
+}
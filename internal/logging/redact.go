@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+)
+
+// Redacted replaces secrets in logs and config dumps.
+const Redacted = "[REDACTED]"
+
+// StructValue renders the exported fields of a struct as a log group. Fields tagged
+// `secret:"true"` are replaced with Redacted unless empty, so a dump still shows
+// whether a secret is set.
+func StructValue(v any) slog.Value {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return slog.AnyValue(v)
+	}
+
+	rt := rv.Type()
+	attrs := make([]slog.Attr, 0, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		value := rv.Field(i)
+		switch {
+		case field.Tag.Get("secret") == "true":
+			if value.IsZero() {
+				attrs = append(attrs, slog.String(field.Name, ""))
+			} else {
+				attrs = append(attrs, slog.String(field.Name, Redacted))
+			}
+		case value.Kind() == reflect.Pointer && !value.IsNil():
+			attrs = append(attrs, slog.String(field.Name, fmt.Sprint(value.Interface())))
+		default:
+			attrs = append(attrs, slog.Any(field.Name, value.Interface()))
+		}
+	}
+	return slog.GroupValue(attrs...)
+}
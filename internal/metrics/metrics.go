@@ -0,0 +1,124 @@
+// Package metrics exposes the Prometheus metrics of the service: HTTP traffic,
+// the database connection pool and shop activity.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "shop"
+
+// Authentication events counted by AuthEvent.
+const (
+	AuthRegistration = "registration"
+	AuthLogin        = "login"
+	AuthLoginFailed  = "login_failed"
+)
+
+// Registry holds every metric of the service.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	coinsTransferred = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coins_transferred_total",
+		Help:      "Coins moved between users by completed transfers.",
+	})
+
+	transfers = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfers_total",
+		Help:      "Completed transfers; a batch counts once per recipient.",
+	})
+
+	transferFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfer_failures_total",
+		Help:      "Rejected transfers by reason.",
+	}, []string{"reason"})
+
+	itemsPurchased = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "items_purchased_total",
+		Help:      "Merch items bought, by item type.",
+	}, []string{"item_type"})
+
+	authEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_events_total",
+		Help:      "Registrations, successful and failed logins.",
+	}, []string{"event"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		coinsTransferred,
+		transfers,
+		transferFailures,
+		itemsPurchased,
+		authEvents,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// RegisterDBStats exposes the statistics of the connection pool, sql.DB.Stats().
+// It must be called once per database.
+func RegisterDBStats(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveRequest records a served HTTP request. Route is the route pattern, not the
+// path, so that path parameters do not blow up the number of series.
+func ObserveRequest(method, route string, status int, duration time.Duration) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// TransferCompleted records a successful transfer of amount coins.
+func TransferCompleted(amount int) {
+	transfers.Inc()
+	coinsTransferred.Add(float64(amount))
+}
+
+// TransferFailed records a rejected transfer.
+func TransferFailed(reason string) {
+	transferFailures.WithLabelValues(reason).Inc()
+}
+
+// ItemsPurchased records quantity items of the type bought.
+func ItemsPurchased(itemType string, quantity int) {
+	itemsPurchased.WithLabelValues(itemType).Add(float64(quantity))
+}
+
+// AuthEvent records one of the Auth* events.
+func AuthEvent(event string) {
+	authEvents.WithLabelValues(event).Inc()
+}
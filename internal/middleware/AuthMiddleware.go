@@ -1,13 +1,25 @@
 package middleware
 
 import (
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/logging"
+	"context"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 	"net/http"
 	"strings"
+	"time"
 )
 
-func JWTAuthMiddleware(secret string) gin.HandlerFunc {
+// TokenRevocationChecker reports whether an access token was revoked before it expired.
+type TokenRevocationChecker interface {
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// JWTAuthMiddleware authenticates the request by its bearer token. Tokens without a jti
+// claim are rejected, since they could not be revoked. A nil revocations disables the
+// denylist check.
+func JWTAuthMiddleware(secret string, revocations TokenRevocationChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -39,7 +51,36 @@ func JWTAuthMiddleware(secret string) gin.HandlerFunc {
 				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token payload"})
 				return
 			}
+
+			jti, _ := claims["jti"].(string)
+			if jti == "" {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token payload"})
+				return
+			}
+			if revocations != nil {
+				revoked, err := revocations.IsTokenRevoked(c.Request.Context(), jti)
+				if err != nil {
+					c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check token"})
+					return
+				}
+				if revoked {
+					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+					return
+				}
+			}
+
 			c.Set("userID", uint(userIDFloat))
+			c.Request = c.Request.WithContext(logging.WithUserID(c.Request.Context(), uint(userIDFloat)))
+			c.Set("jti", jti)
+			if exp, ok := claims["exp"].(float64); ok {
+				c.Set("tokenExpiresAt", time.Unix(int64(exp), 0))
+			}
+
+			role, _ := claims["role"].(string)
+			if role == "" {
+				role = domain.RoleUser
+			}
+			c.Set("role", role)
 		} else {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "failed to parse token claims"})
 			return
@@ -48,3 +89,32 @@ func JWTAuthMiddleware(secret string) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// AdminUserLookup loads the current state of a user.
+type AdminUserLookup interface {
+	GetUserByID(ctx context.Context, id uint) (*domain.User, error)
+}
+
+// AdminOnlyMiddleware rejects requests of non-admin users. Must be placed after JWTAuthMiddleware.
+// The role claim of the token is re-checked against the stored user, so an admin demoted
+// by SyncAdmins loses access at once instead of when the access token expires.
+func AdminOnlyMiddleware(users AdminUserLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if role, _ := c.Get("role"); role != domain.RoleAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			return
+		}
+
+		user, err := users.GetUserByID(c.Request.Context(), c.GetUint("userID"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check role"})
+			return
+		}
+		if user == nil || user.Role != domain.RoleAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotentReplayedContent = "application/json; charset=utf-8"
+	completeAttempts          = 3
+	// idempotencySaveTimeout bounds each call that stores or releases a key after the
+	// handler has run, when the request context may already be done.
+	idempotencySaveTimeout = 5 * time.Second
+)
+
+// responseRecorder keeps a copy of everything written to the client.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware makes the wrapped handler safe to retry. When the request carries an
+// Idempotency-Key header, the first response is stored and returned again for every retry
+// with the same key and body. Must be placed after JWTAuthMiddleware.
+func IdempotencyMiddleware(idempotencyService services.IdempotencyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": "idempotency key is too long"})
+			return
+		}
+
+		userID, ok := c.Get("userID")
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"errors": "unauthorized"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"errors": "failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		stored, err := idempotencyService.Begin(c.Request.Context(), userID.(uint), key, requestHash(c.Request, body))
+		switch {
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"errors": err.Error()})
+			return
+		case errors.Is(err, services.ErrIdempotencyKeyInProgress):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"errors": err.Error()})
+			return
+		case err != nil:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"errors": err.Error()})
+			return
+		}
+
+		if stored != nil {
+			c.Header(idempotentReplayedHeader, "true")
+			c.Data(stored.StatusCode, idempotentReplayedContent, stored.ResponseBody)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		release := func() {
+			ctx, cancel := saveContext(c)
+			defer cancel()
+			_ = idempotencyService.Release(ctx, userID.(uint), key)
+		}
+		// Recovery runs outside this middleware, so a panicking handler would otherwise
+		// leave the key in progress until it expires.
+		defer func() {
+			if p := recover(); p != nil {
+				release()
+				panic(p)
+			}
+		}()
+
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			release()
+			return
+		}
+		// The operation has been carried out, so the key must never be released from here
+		// on: a retry would run it a second time. If the response cannot be stored, the
+		// key stays in progress and retries get 409 until it expires.
+		for attempt := 0; attempt < completeAttempts; attempt++ {
+			ctx, cancel := saveContext(c)
+			err := idempotencyService.Complete(ctx, userID.(uint), key, status, recorder.body.Bytes())
+			cancel()
+			if err == nil {
+				return
+			}
+		}
+	}
+}
+
+// saveContext is the context of the calls made after the handler: it keeps the values of
+// the request context but not its cancellation or deadline, so a client that hung up or
+// a request that ran out of time still gets its key stored or released.
+func saveContext(c *gin.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(c.Request.Context()), idempotencySaveTimeout)
+}
+
+// requestHash fingerprints the parts of the request that define the operation.
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
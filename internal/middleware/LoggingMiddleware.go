@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"avito-tech-go/internal/logging"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	RequestIDHeader        = "X-Request-ID"
+	maxRequestIDLength     = 128
+	generatedRequestIDSize = 16
+)
+
+// RequestIDMiddleware takes the request ID from the X-Request-ID header, or generates
+// one, echoes it in the response and stores it in the request context so every log
+// line of the request carries it. Must be the first middleware.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Set("requestID", requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), requestID))
+
+		c.Next()
+	}
+}
+
+// RequestLoggerMiddleware logs every request once it is served. Server errors are
+// logged as errors and client errors as warnings. Must be placed after RequestIDMiddleware.
+func RequestLoggerMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", routeOf(c)),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		// JWTAuthMiddleware replaces the request context, so it may carry the user ID by now.
+		logger.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// RecoveryMiddleware turns a panic into a 500 response and logs it.
+func RecoveryMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(nil, func(c *gin.Context, recovered any) {
+		logger.ErrorContext(c.Request.Context(), "panic while serving request", "panic", recovered)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"errors": "internal server error"})
+	})
+}
+
+// validRequestID accepts IDs of visible ASCII characters only, so a client can not
+// inject arbitrary content into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, generatedRequestIDSize)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// routeOf returns the route pattern of the request, or "unmatched" for unknown paths.
+func routeOf(c *gin.Context) string {
+	if route := c.FullPath(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"avito-tech-go/internal/metrics"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// MetricsMiddleware counts requests and their latency per route. Must be placed before
+// RecoveryMiddleware, so that panics are counted as 500s.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		metrics.ObserveRequest(c.Request.Method, routeOf(c), c.Writer.Status(), time.Since(start))
+	}
+}
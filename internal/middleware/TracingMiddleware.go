@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"avito-tech-go/internal/logging"
+	"avito-tech-go/internal/tracing"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+const TraceIDHeader = "X-Trace-ID"
+
+// TracingMiddleware starts the server span of the request, continuing the trace of an
+// incoming traceparent header, and returns the trace ID in the X-Trace-ID header.
+// Must be placed after RequestIDMiddleware and before RequestLoggerMiddleware, so that
+// the request log line carries the trace ID.
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := tracing.Extract(c.Request.Context(), c.Request.Header)
+		ctx, span := tracing.Start(ctx, fmt.Sprintf("%s %s", c.Request.Method, routeOf(c)),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(routeOf(c)),
+				semconv.URLPath(c.Request.URL.Path),
+				attribute.String("request.id", logging.RequestID(ctx)),
+			))
+		defer span.End()
+
+		if traceID := tracing.TraceID(ctx); traceID != "" {
+			c.Header(TraceIDHeader, traceID)
+		}
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if userID, ok := logging.UserID(c.Request.Context()); ok {
+			span.SetAttributes(attribute.Int64("user.id", int64(userID)))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
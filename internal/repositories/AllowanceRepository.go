@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"avito-tech-go/internal/domain"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AllowanceRepository interface {
+	GetUserIDsWithoutGrant(ctx context.Context, period string, createdBefore time.Time, limit int) ([]uint, error)
+	ClaimGrant(ctx context.Context, grant *domain.AllowanceGrant) (bool, error)
+	UpdateGrant(ctx context.Context, grant *domain.AllowanceGrant) error
+}
+
+type allowanceRepository struct {
+	db *gorm.DB
+}
+
+func NewAllowanceRepository(db *gorm.DB) AllowanceRepository {
+	return &allowanceRepository{db: db}
+}
+
+// GetUserIDsWithoutGrant returns up to limit users created before createdBefore that
+// have not got the allowance of the period yet, in ID order.
+func (r *allowanceRepository) GetUserIDsWithoutGrant(ctx context.Context, period string, createdBefore time.Time, limit int) ([]uint, error) {
+	var ids []uint
+	err := r.db.WithContext(ctx).Model(&domain.User{}).
+		Where("created_at < ?", createdBefore).
+		Where("id NOT IN (?)", r.db.WithContext(ctx).Model(&domain.AllowanceGrant{}).Select("user_id").Where("period = ?", period)).
+		Order("id").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// ClaimGrant inserts the grant unless the user already has one for the period.
+// It reports whether the grant was inserted.
+func (r *allowanceRepository) ClaimGrant(ctx context.Context, grant *domain.AllowanceGrant) (bool, error) {
+	res := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(grant)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *allowanceRepository) UpdateGrant(ctx context.Context, grant *domain.AllowanceGrant) error {
+	return r.db.WithContext(ctx).Save(grant).Error
+}
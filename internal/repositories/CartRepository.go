@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"avito-tech-go/internal/domain"
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CartRepository interface {
+	AddItem(ctx context.Context, userID uint, itemType string, quantity, maxQuantity int) (bool, error)
+	RemoveItem(ctx context.Context, userID uint, itemType string) (bool, error)
+	GetItems(ctx context.Context, userID uint) ([]domain.CartItem, error)
+	Clear(ctx context.Context, userID uint) error
+}
+
+type cartRepository struct {
+	db *gorm.DB
+}
+
+func NewCartRepository(db *gorm.DB) CartRepository {
+	return &cartRepository{db: db}
+}
+
+// AddItem puts the item in the cart or, if it is already there, increases its quantity.
+// It reports false and leaves the cart as is when the quantity would exceed maxQuantity.
+func (r *cartRepository) AddItem(ctx context.Context, userID uint, itemType string, quantity, maxQuantity int) (bool, error) {
+	item := &domain.CartItem{UserID: userID, ItemType: itemType, Quantity: quantity}
+	res := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "item_type"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"quantity":   gorm.Expr("cart_items.quantity + ?", quantity),
+			"updated_at": gorm.Expr("CURRENT_TIMESTAMP"),
+		}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			gorm.Expr("cart_items.quantity + ? <= ?", quantity, maxQuantity),
+		}},
+	}).Create(item)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *cartRepository) RemoveItem(ctx context.Context, userID uint, itemType string) (bool, error) {
+	res := r.db.WithContext(ctx).Where("user_id = ? AND item_type = ?", userID, itemType).Delete(&domain.CartItem{})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *cartRepository) GetItems(ctx context.Context, userID uint) ([]domain.CartItem, error) {
+	var items []domain.CartItem
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("item_type").Find(&items).Error
+	return items, err
+}
+
+func (r *cartRepository) Clear(ctx context.Context, userID uint) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&domain.CartItem{}).Error
+}
@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"avito-tech-go/internal/domain"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type CoinRequestRepository interface {
+	CreateRequest(ctx context.Context, request *domain.CoinRequest) error
+	GetRequestByID(ctx context.Context, id uint) (*domain.CoinRequest, error)
+	GetPendingByPayer(ctx context.Context, payerID uint, now time.Time) ([]domain.CoinRequest, error)
+	GetByRequester(ctx context.Context, requesterID uint) ([]domain.CoinRequest, error)
+	ResolveRequest(ctx context.Context, id uint, status domain.CoinRequestStatus, now time.Time) (bool, error)
+	SetTransaction(ctx context.Context, id uint, transactionID uint) error
+	ExpirePending(ctx context.Context, now time.Time) (int64, error)
+}
+
+type coinRequestRepository struct {
+	db *gorm.DB
+}
+
+func NewCoinRequestRepository(db *gorm.DB) CoinRequestRepository {
+	return &coinRequestRepository{db: db}
+}
+
+func (r *coinRequestRepository) CreateRequest(ctx context.Context, request *domain.CoinRequest) error {
+	return r.db.WithContext(ctx).Create(request).Error
+}
+
+func (r *coinRequestRepository) GetRequestByID(ctx context.Context, id uint) (*domain.CoinRequest, error) {
+	var request domain.CoinRequest
+	err := r.db.WithContext(ctx).First(&request, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &request, err
+}
+
+func (r *coinRequestRepository) GetPendingByPayer(ctx context.Context, payerID uint, now time.Time) ([]domain.CoinRequest, error) {
+	var requests []domain.CoinRequest
+	err := r.db.WithContext(ctx).
+		Where("payer_id = ? AND status = ? AND expires_at > ?", payerID, domain.CoinRequestPending, now).
+		Order("created_at DESC").Order("id DESC").
+		Find(&requests).Error
+	return requests, err
+}
+
+func (r *coinRequestRepository) GetByRequester(ctx context.Context, requesterID uint) ([]domain.CoinRequest, error) {
+	var requests []domain.CoinRequest
+	err := r.db.WithContext(ctx).
+		Where("requester_id = ?", requesterID).
+		Order("created_at DESC").Order("id DESC").
+		Find(&requests).Error
+	return requests, err
+}
+
+// ResolveRequest moves a pending, unexpired request to the given status and reports
+// whether it did. Of two concurrent answers to the same request only one wins.
+func (r *coinRequestRepository) ResolveRequest(ctx context.Context, id uint, status domain.CoinRequestStatus, now time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&domain.CoinRequest{}).
+		Where("id = ? AND status = ? AND expires_at > ?", id, domain.CoinRequestPending, now).
+		Updates(map[string]interface{}{"status": status, "updated_at": now})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *coinRequestRepository) SetTransaction(ctx context.Context, id uint, transactionID uint) error {
+	return r.db.WithContext(ctx).Model(&domain.CoinRequest{}).
+		Where("id = ?", id).
+		Update("transaction_id", transactionID).Error
+}
+
+// ExpirePending marks pending requests that expired before now.
+func (r *coinRequestRepository) ExpirePending(ctx context.Context, now time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Model(&domain.CoinRequest{}).
+		Where("status = ? AND expires_at <= ?", domain.CoinRequestPending, now).
+		Updates(map[string]interface{}{"status": domain.CoinRequestExpired, "updated_at": now})
+	return res.RowsAffected, res.Error
+}
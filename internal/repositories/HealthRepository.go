@@ -0,0 +1,47 @@
+package repositories
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type HealthRepository interface {
+	Ping(ctx context.Context) error
+	MissingTables(ctx context.Context) ([]string, error)
+}
+
+type healthRepository struct {
+	db     *gorm.DB
+	models []any
+}
+
+// NewHealthRepository checks the database the service runs on; models are the
+// tables migrations are expected to have created.
+func NewHealthRepository(db *gorm.DB, models ...any) HealthRepository {
+	return &healthRepository{db: db, models: models}
+}
+
+func (r *healthRepository) Ping(ctx context.Context) error {
+	sqlDB, err := r.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// MissingTables returns the names of the tables of the models that do not exist.
+func (r *healthRepository) MissingTables(ctx context.Context) ([]string, error) {
+	db := r.db.WithContext(ctx)
+	var missing []string
+	for _, model := range r.models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		if !db.Migrator().HasTable(stmt.Schema.Table) {
+			missing = append(missing, stmt.Schema.Table)
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"avito-tech-go/internal/domain"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, key *domain.IdempotencyKey) (bool, error)
+	Get(ctx context.Context, userID uint, key string) (*domain.IdempotencyKey, error)
+	SaveResponse(ctx context.Context, userID uint, key string, statusCode int, body []byte) error
+	Delete(ctx context.Context, userID uint, key string) error
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
+
+type idempotencyRepository struct {
+	db *gorm.DB
+}
+
+func NewIdempotencyRepository(db *gorm.DB) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+// Reserve inserts the key unless it is already present and reports whether the row was created.
+func (r *idempotencyRepository) Reserve(ctx context.Context, key *domain.IdempotencyKey) (bool, error) {
+	res := r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (r *idempotencyRepository) Get(ctx context.Context, userID uint, key string) (*domain.IdempotencyKey, error) {
+	var record domain.IdempotencyKey
+	err := r.db.WithContext(ctx).Where("user_id = ? AND idempotency_key = ?", userID, key).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &record, err
+}
+
+func (r *idempotencyRepository) SaveResponse(ctx context.Context, userID uint, key string, statusCode int, body []byte) error {
+	return r.db.WithContext(ctx).Model(&domain.IdempotencyKey{}).
+		Where("user_id = ? AND idempotency_key = ?", userID, key).
+		Updates(map[string]interface{}{
+			"status_code":   statusCode,
+			"response_body": body,
+		}).Error
+}
+
+func (r *idempotencyRepository) Delete(ctx context.Context, userID uint, key string) error {
+	return r.db.WithContext(ctx).Where("user_id = ? AND idempotency_key = ?", userID, key).
+		Delete(&domain.IdempotencyKey{}).Error
+}
+
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	res := r.db.WithContext(ctx).Where("created_at < ?", before).Delete(&domain.IdempotencyKey{})
+	return res.RowsAffected, res.Error
+}
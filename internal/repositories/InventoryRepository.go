@@ -2,16 +2,17 @@ package repositories
 
 import (
 	"avito-tech-go/internal/domain"
+	"context"
 	"errors"
 	"gorm.io/gorm"
 )
 
 type InventoryRepository interface {
-	CreateItem(item *domain.InventoryItem) error
-	UpdateItem(item *domain.InventoryItem) error
-	GetByUserAndType(userID uint, itemType string) (*domain.InventoryItem, error)
-	GetAllByUser(userID uint) ([]domain.InventoryItem, error)
-	DeleteItem(item *domain.InventoryItem) error
+	CreateItem(ctx context.Context, item *domain.InventoryItem) error
+	UpdateItem(ctx context.Context, item *domain.InventoryItem) error
+	GetByUserAndType(ctx context.Context, userID uint, itemType string) (*domain.InventoryItem, error)
+	GetAllByUser(ctx context.Context, userID uint) ([]domain.InventoryItem, error)
+	DeleteItem(ctx context.Context, item *domain.InventoryItem) error
 }
 
 type inventoryRepository struct {
@@ -22,17 +23,17 @@ func NewInventoryRepository(db *gorm.DB) InventoryRepository {
 	return &inventoryRepository{db: db}
 }
 
-func (r *inventoryRepository) CreateItem(item *domain.InventoryItem) error {
-	return r.db.Create(item).Error
+func (r *inventoryRepository) CreateItem(ctx context.Context, item *domain.InventoryItem) error {
+	return r.db.WithContext(ctx).Create(item).Error
 }
 
-func (r *inventoryRepository) UpdateItem(item *domain.InventoryItem) error {
-	return r.db.Save(item).Error
+func (r *inventoryRepository) UpdateItem(ctx context.Context, item *domain.InventoryItem) error {
+	return r.db.WithContext(ctx).Save(item).Error
 }
 
-func (r *inventoryRepository) GetByUserAndType(userID uint, itemType string) (*domain.InventoryItem, error) {
+func (r *inventoryRepository) GetByUserAndType(ctx context.Context, userID uint, itemType string) (*domain.InventoryItem, error) {
 	var item domain.InventoryItem
-	err := r.db.Where("user_id = ? AND item_type = ?", userID, itemType).First(&item).Error
+	err := r.db.WithContext(ctx).Where("user_id = ? AND item_type = ?", userID, itemType).First(&item).Error
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -42,12 +43,12 @@ func (r *inventoryRepository) GetByUserAndType(userID uint, itemType string) (*d
 	return &item, nil
 }
 
-func (r *inventoryRepository) GetAllByUser(userID uint) ([]domain.InventoryItem, error) {
+func (r *inventoryRepository) GetAllByUser(ctx context.Context, userID uint) ([]domain.InventoryItem, error) {
 	var items []domain.InventoryItem
-	err := r.db.Where("user_id = ?", userID).Find(&items).Error
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&items).Error
 	return items, err
 }
 
-func (r *inventoryRepository) DeleteItem(item *domain.InventoryItem) error {
-	return r.db.Delete(item).Error
+func (r *inventoryRepository) DeleteItem(ctx context.Context, item *domain.InventoryItem) error {
+	return r.db.WithContext(ctx).Delete(item).Error
 }
@@ -2,17 +2,25 @@ package repositories
 
 import (
 	"avito-tech-go/internal/domain"
+	"context"
 	"errors"
 
 	"gorm.io/gorm"
 )
 
+// ErrOutOfStock is returned by DecrementStock when fewer items are left than requested.
+var ErrOutOfStock = errors.New("out of stock")
+
 type MerchRepository interface {
-	CreateMerchItem(item *domain.MerchItem) error
-	UpdateMerchItem(item *domain.MerchItem) error
-	GetMerchItemByType(itemType string) (*domain.MerchItem, error)
-	GetAllMerchItems() ([]domain.MerchItem, error)
-	DeleteMerchItem(itemType string) error
+	CreateMerchItem(ctx context.Context, item *domain.MerchItem) error
+	UpdateMerchItem(ctx context.Context, item *domain.MerchItem) error
+	GetMerchItemByType(ctx context.Context, itemType string) (*domain.MerchItem, error)
+	GetAllMerchItems(ctx context.Context) ([]domain.MerchItem, error)
+	DeleteMerchItem(ctx context.Context, itemType string) error
+	RestoreMerchItem(ctx context.Context, item *domain.MerchItem) (bool, error)
+	SetStock(ctx context.Context, itemType string, stock *int) error
+	DecrementStock(ctx context.Context, itemType string, quantity int) error
+	IncrementStock(ctx context.Context, itemType string, quantity int) error
 }
 
 type merchRepository struct {
@@ -23,30 +31,85 @@ func NewMerchRepository(db *gorm.DB) MerchRepository {
 	return &merchRepository{db: db}
 }
 
-func (r *merchRepository) CreateMerchItem(item *domain.MerchItem) error {
-	return r.db.Create(item).Error
+func (r *merchRepository) CreateMerchItem(ctx context.Context, item *domain.MerchItem) error {
+	return r.db.WithContext(ctx).Create(item).Error
 }
 
-func (r *merchRepository) UpdateMerchItem(item *domain.MerchItem) error {
-	return r.db.Save(item).Error
+// UpdateMerchItem saves everything but the stock, which is only changed through
+// SetStock and DecrementStock so that concurrent purchases are never overwritten.
+func (r *merchRepository) UpdateMerchItem(ctx context.Context, item *domain.MerchItem) error {
+	return r.db.WithContext(ctx).Omit("stock").Save(item).Error
 }
 
-func (r *merchRepository) GetMerchItemByType(itemType string) (*domain.MerchItem, error) {
+func (r *merchRepository) GetMerchItemByType(ctx context.Context, itemType string) (*domain.MerchItem, error) {
 	var item domain.MerchItem
-	err := r.db.Where("item_type = ?", itemType).First(&item).Error
+	err := r.db.WithContext(ctx).Where("item_type = ?", itemType).First(&item).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
 	return &item, err
 }
 
-func (r *merchRepository) GetAllMerchItems() ([]domain.MerchItem, error) {
+func (r *merchRepository) GetAllMerchItems(ctx context.Context) ([]domain.MerchItem, error) {
 	var items []domain.MerchItem
-	err := r.db.Find(&items).Error
+	err := r.db.WithContext(ctx).Order("item_type").Find(&items).Error
 	return items, err
 }
 
-func (r *merchRepository) DeleteMerchItem(itemType string) error {
-	res := r.db.Where("item_type = ?", itemType).Delete(&domain.MerchItem{})
+func (r *merchRepository) DeleteMerchItem(ctx context.Context, itemType string) error {
+	res := r.db.WithContext(ctx).Where("item_type = ?", itemType).Delete(&domain.MerchItem{})
 	return res.Error
 }
+
+// RestoreMerchItem brings a retired item back with the given price and reports whether
+// a retired item was found.
+func (r *merchRepository) RestoreMerchItem(ctx context.Context, item *domain.MerchItem) (bool, error) {
+	res := r.db.WithContext(ctx).Unscoped().Model(&domain.MerchItem{}).
+		Where("item_type = ? AND deleted_at IS NOT NULL", item.ItemType).
+		Updates(map[string]interface{}{
+			"price":      item.Price,
+			"stock":      item.Stock,
+			"deleted_at": nil,
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *merchRepository) SetStock(ctx context.Context, itemType string, stock *int) error {
+	return r.db.WithContext(ctx).Model(&domain.MerchItem{}).
+		Where("item_type = ?", itemType).
+		Update("stock", stock).Error
+}
+
+// IncrementStock puts quantity items back on sale. Items with unlimited stock
+// are left untouched.
+func (r *merchRepository) IncrementStock(ctx context.Context, itemType string, quantity int) error {
+	return r.db.WithContext(ctx).Model(&domain.MerchItem{}).
+		Where("item_type = ? AND stock IS NOT NULL", itemType).
+		Update("stock", gorm.Expr("stock + ?", quantity)).Error
+}
+
+// DecrementStock atomically takes quantity items from a stock-limited item.
+// Items with unlimited stock are left untouched.
+func (r *merchRepository) DecrementStock(ctx context.Context, itemType string, quantity int) error {
+	res := r.db.WithContext(ctx).Model(&domain.MerchItem{}).
+		Where("item_type = ? AND stock IS NOT NULL AND stock >= ?", itemType, quantity).
+		Update("stock", gorm.Expr("stock - ?", quantity))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected > 0 {
+		return nil
+	}
+
+	var unlimited int64
+	err := r.db.WithContext(ctx).Model(&domain.MerchItem{}).
+		Where("item_type = ? AND stock IS NULL", itemType).
+		Count(&unlimited).Error
+	if err != nil {
+		return err
+	}
+	if unlimited == 0 {
+		return ErrOutOfStock
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"avito-tech-go/internal/domain"
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ScheduledTransferRepository interface {
+	CreateScheduledTransfer(ctx context.Context, transfer *domain.ScheduledTransfer) error
+	UpdateScheduledTransfer(ctx context.Context, transfer *domain.ScheduledTransfer, prevNextRunAt *time.Time) (bool, error)
+	DeleteScheduledTransfer(ctx context.Context, id uint) error
+	GetScheduledTransferByID(ctx context.Context, id uint) (*domain.ScheduledTransfer, error)
+	GetScheduledTransfersByOwner(ctx context.Context, ownerID uint) ([]domain.ScheduledTransfer, error)
+	GetDueScheduledTransfers(ctx context.Context, now time.Time, limit int) ([]domain.ScheduledTransfer, error)
+	ClaimScheduledRun(ctx context.Context, id uint, scheduledFor time.Time, nextRunAt *time.Time) (bool, error)
+	RecordScheduledRun(ctx context.Context, run *domain.ScheduledTransferRun) error
+	GetScheduledRuns(ctx context.Context, scheduledTransferID uint, limit int) ([]domain.ScheduledTransferRun, error)
+}
+
+type scheduledTransferRepository struct {
+	db *gorm.DB
+}
+
+func NewScheduledTransferRepository(db *gorm.DB) ScheduledTransferRepository {
+	return &scheduledTransferRepository{db: db}
+}
+
+func (r *scheduledTransferRepository) CreateScheduledTransfer(ctx context.Context, transfer *domain.ScheduledTransfer) error {
+	return r.db.WithContext(ctx).Create(transfer).Error
+}
+
+// UpdateScheduledTransfer writes the settings the owner can change, provided the
+// transfer is still due at prevNextRunAt, and reports whether it did. A run claimed in
+// the meantime moves next_run_at, so its bookkeeping is never overwritten.
+func (r *scheduledTransferRepository) UpdateScheduledTransfer(ctx context.Context, transfer *domain.ScheduledTransfer, prevNextRunAt *time.Time) (bool, error) {
+	db := r.db.WithContext(ctx).Model(transfer)
+	if prevNextRunAt == nil {
+		db = db.Where("next_run_at IS NULL")
+	} else {
+		db = db.Where("next_run_at = ?", *prevNextRunAt)
+	}
+	res := db.Select("ToUserID", "Amount", "Message", "Category", "Schedule", "Active", "NextRunAt", "LastError", "UpdatedAt").
+		Updates(transfer)
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *scheduledTransferRepository) DeleteScheduledTransfer(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("scheduled_transfer_id = ?", id).Delete(&domain.ScheduledTransferRun{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&domain.ScheduledTransfer{}, id).Error
+	})
+}
+
+func (r *scheduledTransferRepository) GetScheduledTransferByID(ctx context.Context, id uint) (*domain.ScheduledTransfer, error) {
+	var transfer domain.ScheduledTransfer
+	err := r.db.WithContext(ctx).First(&transfer, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &transfer, err
+}
+
+func (r *scheduledTransferRepository) GetScheduledTransfersByOwner(ctx context.Context, ownerID uint) ([]domain.ScheduledTransfer, error) {
+	var transfers []domain.ScheduledTransfer
+	err := r.db.WithContext(ctx).Where("owner_id = ?", ownerID).Order("id").Find(&transfers).Error
+	return transfers, err
+}
+
+// GetDueScheduledTransfers returns active transfers whose next run is not after now,
+// oldest first.
+func (r *scheduledTransferRepository) GetDueScheduledTransfers(ctx context.Context, now time.Time, limit int) ([]domain.ScheduledTransfer, error) {
+	var transfers []domain.ScheduledTransfer
+	err := r.db.WithContext(ctx).
+		Where("active = ? AND next_run_at <= ?", true, now).
+		Order("next_run_at").Order("id").
+		Limit(limit).
+		Find(&transfers).Error
+	return transfers, err
+}
+
+// ClaimScheduledRun moves a transfer that is still due at scheduledFor to its next run
+// and reports whether it did, so that each run is executed by one scheduler only.
+// A nil nextRunAt deactivates the transfer.
+func (r *scheduledTransferRepository) ClaimScheduledRun(ctx context.Context, id uint, scheduledFor time.Time, nextRunAt *time.Time) (bool, error) {
+	res := r.db.WithContext(ctx).Model(&domain.ScheduledTransfer{}).
+		Where("id = ? AND active = ? AND next_run_at = ?", id, true, scheduledFor).
+		Updates(map[string]interface{}{
+			"next_run_at": nextRunAt,
+			"active":      nextRunAt != nil,
+			"last_run_at": scheduledFor,
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+// RecordScheduledRun stores the outcome of a run and copies its error to the transfer.
+func (r *scheduledTransferRepository) RecordScheduledRun(ctx context.Context, run *domain.ScheduledTransferRun) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(run).Error; err != nil {
+			return err
+		}
+		return tx.Model(&domain.ScheduledTransfer{}).
+			Where("id = ?", run.ScheduledTransferID).
+			Update("last_error", run.Error).Error
+	})
+}
+
+// GetScheduledRuns returns the latest runs of a transfer, newest first.
+func (r *scheduledTransferRepository) GetScheduledRuns(ctx context.Context, scheduledTransferID uint, limit int) ([]domain.ScheduledTransferRun, error) {
+	var runs []domain.ScheduledTransferRun
+	err := r.db.WithContext(ctx).
+		Where("scheduled_transfer_id = ?", scheduledTransferID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&runs).Error
+	return runs, err
+}
@@ -0,0 +1,31 @@
+package repositories
+
+import (
+	"avito-tech-go/internal/domain"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type SecurityEventRepository interface {
+	CreateEvent(ctx context.Context, event *domain.SecurityEvent) error
+	GetEventsByType(ctx context.Context, eventType string) ([]domain.SecurityEvent, error)
+}
+
+type securityEventRepository struct {
+	db *gorm.DB
+}
+
+func NewSecurityEventRepository(db *gorm.DB) SecurityEventRepository {
+	return &securityEventRepository{db: db}
+}
+
+func (r *securityEventRepository) CreateEvent(ctx context.Context, event *domain.SecurityEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+func (r *securityEventRepository) GetEventsByType(ctx context.Context, eventType string) ([]domain.SecurityEvent, error) {
+	var events []domain.SecurityEvent
+	err := r.db.WithContext(ctx).Where("type = ?", eventType).Order("id").Find(&events).Error
+	return events, err
+}
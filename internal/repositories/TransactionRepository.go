@@ -2,13 +2,67 @@ package repositories
 
 import (
 	"avito-tech-go/internal/domain"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// TransactionRepository stores coin transactions together with their double-entry
+// ledger postings. Every transaction written through it is balanced in the ledger.
 type TransactionRepository interface {
-	CreateTransaction(tx *domain.Transaction) error
-	GetUserTransactions(userID uint) ([]domain.Transaction, error)
-	GetTransactionsByType(userID uint, txType domain.TransactionType) ([]domain.Transaction, error)
+	CreateTransaction(ctx context.Context, tx *domain.Transaction) error
+	GetUserTransactions(ctx context.Context, userID uint) ([]domain.Transaction, error)
+	GetTransactionsByType(ctx context.Context, userID uint, txType domain.TransactionType) ([]domain.Transaction, error)
+	GetUserHistory(ctx context.Context, query HistoryQuery) ([]domain.Transaction, error)
+	GetTransactionByID(ctx context.Context, id uint) (*domain.Transaction, error)
+	GetReversalOf(ctx context.Context, id uint) (*domain.Transaction, error)
+	GetTransferStats(ctx context.Context, userID uint, since time.Time) (TransferStats, error)
+	IssueCoins(ctx context.Context, userID uint, amount int) error
+	GetAccountBalance(ctx context.Context, code string) (int, error)
+	GetLedgerTotal(ctx context.Context) (int, error)
+	GetBalanceDrifts(ctx context.Context) ([]domain.BalanceDrift, error)
+	GetUnbalancedTransactionIDs(ctx context.Context) ([]uint, error)
+	GetUserIDsWithoutAccount(ctx context.Context) ([]uint, error)
+	HasUserAccount(ctx context.Context, userID uint) (bool, error)
+}
+
+// History directions relative to the user.
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// creditTypes are transactions owned by FromUserID that bring coins to the user.
+var creditTypes = []domain.TransactionType{domain.Refund, domain.Grant}
+
+// HistoryCursor points at the last transaction of the previous page.
+type HistoryCursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+// HistoryQuery selects a page of a user's transactions, newest first. Zero fields do
+// not filter. Counterparty matches the other user of a transfer or reversal.
+type HistoryQuery struct {
+	UserID       uint
+	Types        []domain.TransactionType
+	Direction    string
+	Category     string
+	Counterparty *uint
+	From         *time.Time
+	To           *time.Time
+	After        *HistoryCursor
+	Limit        int
+}
+
+// TransferStats sums the transfers a user sent in a period.
+type TransferStats struct {
+	Amount int
+	Count  int
 }
 
 type transactionRepository struct {
@@ -19,20 +73,273 @@ func NewTransactionRepository(db *gorm.DB) TransactionRepository {
 	return &transactionRepository{db: db}
 }
 
-func (r *transactionRepository) CreateTransaction(tx *domain.Transaction) error {
-	return r.db.Create(tx).Error
+// posting is a pending ledger entry addressed by account code.
+type posting struct {
+	code   string
+	userID *uint
+	amount int
+}
+
+func userPosting(userID uint, amount int) posting {
+	return posting{code: domain.UserAccountCode(userID), userID: &userID, amount: amount}
+}
+
+func systemPosting(code string, amount int) posting {
+	return posting{code: code, amount: amount}
+}
+
+// postingsFor returns the balanced ledger postings of a transaction.
+func postingsFor(tx *domain.Transaction) ([]posting, error) {
+	switch tx.Type {
+	case domain.Transfer:
+		if tx.ToUserID == nil {
+			return nil, errors.New("transfer without recipient")
+		}
+		return []posting{
+			userPosting(tx.FromUserID, -tx.Amount),
+			userPosting(*tx.ToUserID, tx.Amount),
+		}, nil
+	case domain.Purchase:
+		return []posting{
+			userPosting(tx.FromUserID, -tx.Amount),
+			systemPosting(domain.ShopAccountCode, tx.Amount),
+		}, nil
+	case domain.Reversal:
+		if tx.ToUserID == nil || tx.ReversalOfID == nil {
+			return nil, errors.New("reversal without original sender")
+		}
+		return []posting{
+			userPosting(tx.FromUserID, -tx.Amount),
+			userPosting(*tx.ToUserID, tx.Amount),
+		}, nil
+	case domain.Refund:
+		if tx.ReversalOfID == nil {
+			return nil, errors.New("refund without purchase")
+		}
+		return []posting{
+			systemPosting(domain.ShopAccountCode, -tx.Amount),
+			userPosting(tx.FromUserID, tx.Amount),
+		}, nil
+	case domain.Grant:
+		return []posting{
+			systemPosting(domain.IssuanceAccountCode, -tx.Amount),
+			userPosting(tx.FromUserID, tx.Amount),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown transaction type %q", tx.Type)
+	}
+}
+
+func (r *transactionRepository) CreateTransaction(ctx context.Context, tx *domain.Transaction) error {
+	postings, err := postingsFor(tx)
+	if err != nil {
+		return err
+	}
+
+	return r.db.WithContext(ctx).Transaction(func(db *gorm.DB) error {
+		if err := db.Create(tx).Error; err != nil {
+			return err
+		}
+		return post(db, &tx.ID, postings)
+	})
+}
+
+// IssueCoins credits the user's account from the issuance account.
+func (r *transactionRepository) IssueCoins(ctx context.Context, userID uint, amount int) error {
+	return r.db.WithContext(ctx).Transaction(func(db *gorm.DB) error {
+		return post(db, nil, []posting{
+			systemPosting(domain.IssuanceAccountCode, -amount),
+			userPosting(userID, amount),
+		})
+	})
+}
+
+func post(db *gorm.DB, txID *uint, postings []posting) error {
+	entries := make([]domain.LedgerEntry, 0, len(postings))
+	for _, p := range postings {
+		account, err := ensureAccount(db, p.code, p.userID)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, domain.LedgerEntry{
+			TransactionID: txID,
+			AccountID:     account.ID,
+			Amount:        p.amount,
+		})
+	}
+	return db.Create(&entries).Error
+}
+
+// ensureAccount returns the account with the given code, opening it on first use.
+func ensureAccount(db *gorm.DB, code string, userID *uint) (*domain.LedgerAccount, error) {
+	var account domain.LedgerAccount
+	res := db.Where("code = ?", code).Limit(1).Find(&account)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return &account, nil
+	}
+
+	account = domain.LedgerAccount{Code: code, UserID: userID}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return nil, err
+	}
+	if account.ID != 0 {
+		return &account, nil
+	}
+
+	// Opened concurrently by another transaction.
+	if err := db.Where("code = ?", code).First(&account).Error; err != nil {
+		return nil, err
+	}
+	return &account, nil
 }
 
-func (r *transactionRepository) GetUserTransactions(userID uint) ([]domain.Transaction, error) {
+func (r *transactionRepository) GetUserTransactions(ctx context.Context, userID uint) ([]domain.Transaction, error) {
 	var transactions []domain.Transaction
-	err := r.db.
+	err := r.db.WithContext(ctx).
 		Where("from_user_id = ? OR to_user_id = ?", userID, userID).
 		Find(&transactions).Error
 	return transactions, err
 }
 
-func (r *transactionRepository) GetTransactionsByType(userID uint, txType domain.TransactionType) ([]domain.Transaction, error) {
+// GetUserHistory returns up to query.Limit transactions ordered by creation time and ID,
+// both descending, starting after query.After.
+func (r *transactionRepository) GetUserHistory(ctx context.Context, query HistoryQuery) ([]domain.Transaction, error) {
+	db := r.db.WithContext(ctx).Model(&domain.Transaction{})
+
+	switch query.Direction {
+	case DirectionIn:
+		db = db.Where("(to_user_id = ? OR (from_user_id = ? AND type IN ?))", query.UserID, query.UserID, creditTypes)
+	case DirectionOut:
+		db = db.Where("from_user_id = ? AND type NOT IN ?", query.UserID, creditTypes)
+	default:
+		db = db.Where("(from_user_id = ? OR to_user_id = ?)", query.UserID, query.UserID)
+	}
+
+	if len(query.Types) > 0 {
+		db = db.Where("type IN ?", query.Types)
+	}
+	if query.Category != "" {
+		db = db.Where("category = ?", query.Category)
+	}
+	if query.Counterparty != nil {
+		db = db.Where("((from_user_id = ? AND to_user_id = ?) OR (from_user_id = ? AND to_user_id = ?))",
+			query.UserID, *query.Counterparty, *query.Counterparty, query.UserID)
+	}
+	if query.From != nil {
+		db = db.Where("created_at >= ?", *query.From)
+	}
+	if query.To != nil {
+		db = db.Where("created_at < ?", *query.To)
+	}
+	if query.After != nil {
+		db = db.Where("(created_at < ? OR (created_at = ? AND id < ?))",
+			query.After.CreatedAt, query.After.CreatedAt, query.After.ID)
+	}
+
 	var transactions []domain.Transaction
-	err := r.db.Where("(from_user_id = ? OR to_user_id = ?) AND type = ?", userID, userID, txType).Find(&transactions).Error
+	err := db.Order("created_at DESC").Order("id DESC").Limit(query.Limit).Find(&transactions).Error
 	return transactions, err
 }
+
+func (r *transactionRepository) GetTransactionByID(ctx context.Context, id uint) (*domain.Transaction, error) {
+	var transaction domain.Transaction
+	err := r.db.WithContext(ctx).First(&transaction, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &transaction, err
+}
+
+// GetReversalOf returns the reversal or refund of the transaction, or nil if it was not undone.
+func (r *transactionRepository) GetReversalOf(ctx context.Context, id uint) (*domain.Transaction, error) {
+	var transaction domain.Transaction
+	err := r.db.WithContext(ctx).Where("reversal_of_id = ?", id).First(&transaction).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &transaction, err
+}
+
+func (r *transactionRepository) GetTransactionsByType(ctx context.Context, userID uint, txType domain.TransactionType) ([]domain.Transaction, error) {
+	var transactions []domain.Transaction
+	err := r.db.WithContext(ctx).Where("(from_user_id = ? OR to_user_id = ?) AND type = ?", userID, userID, txType).Find(&transactions).Error
+	return transactions, err
+}
+
+// GetTransferStats returns the total and number of transfers sent by the user after since.
+func (r *transactionRepository) GetTransferStats(ctx context.Context, userID uint, since time.Time) (TransferStats, error) {
+	var stats TransferStats
+	err := r.db.WithContext(ctx).Model(&domain.Transaction{}).
+		Where("from_user_id = ? AND type = ? AND created_at > ?", userID, domain.Transfer, since).
+		Select("COALESCE(SUM(amount), 0) AS amount, COUNT(*) AS count").
+		Scan(&stats).Error
+	return stats, err
+}
+
+func (r *transactionRepository) GetAccountBalance(ctx context.Context, code string) (int, error) {
+	var balance int
+	err := r.db.WithContext(ctx).Model(&domain.LedgerEntry{}).
+		Joins("JOIN ledger_accounts ON ledger_accounts.id = ledger_entries.account_id").
+		Where("ledger_accounts.code = ?", code).
+		Select("COALESCE(SUM(ledger_entries.amount), 0)").
+		Scan(&balance).Error
+	return balance, err
+}
+
+// GetLedgerTotal returns the sum of all entries, which is zero for a consistent ledger.
+func (r *transactionRepository) GetLedgerTotal(ctx context.Context) (int, error) {
+	var total int
+	err := r.db.WithContext(ctx).Model(&domain.LedgerEntry{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&total).Error
+	return total, err
+}
+
+// GetBalanceDrifts compares cached user balances with their ledger accounts in a single
+// query, so the result is consistent even while transfers are running.
+func (r *transactionRepository) GetBalanceDrifts(ctx context.Context) ([]domain.BalanceDrift, error) {
+	var drifts []domain.BalanceDrift
+	err := r.db.WithContext(ctx).Table("users").
+		Select("users.id AS user_id, users.username, users.coins AS cached_coins, " +
+			"COALESCE(SUM(ledger_entries.amount), 0) AS ledger_coins").
+		Joins("LEFT JOIN ledger_accounts ON ledger_accounts.user_id = users.id").
+		Joins("LEFT JOIN ledger_entries ON ledger_entries.account_id = ledger_accounts.id").
+		Group("users.id, users.username, users.coins").
+		Having("users.coins <> COALESCE(SUM(ledger_entries.amount), 0)").
+		Order("users.id").
+		Scan(&drifts).Error
+	return drifts, err
+}
+
+func (r *transactionRepository) GetUnbalancedTransactionIDs(ctx context.Context) ([]uint, error) {
+	var ids []uint
+	err := r.db.WithContext(ctx).Model(&domain.LedgerEntry{}).
+		Where("transaction_id IS NOT NULL").
+		Group("transaction_id").
+		Having("SUM(amount) <> 0").
+		Order("transaction_id").
+		Pluck("transaction_id", &ids).Error
+	return ids, err
+}
+
+func (r *transactionRepository) GetUserIDsWithoutAccount(ctx context.Context) ([]uint, error) {
+	var ids []uint
+	err := r.db.WithContext(ctx).Table("users").
+		Joins("LEFT JOIN ledger_accounts ON ledger_accounts.user_id = users.id").
+		Where("ledger_accounts.id IS NULL").
+		Order("users.id").
+		Pluck("users.id", &ids).Error
+	return ids, err
+}
+
+// HasUserAccount reports whether the ledger account of the user has been opened.
+func (r *transactionRepository) HasUserAccount(ctx context.Context, userID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&domain.LedgerAccount{}).
+		Where("user_id = ?", userID).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,46 @@
+package repositories
+
+import (
+	"avito-tech-go/internal/domain"
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TransferLimitRepository interface {
+	GetLimit(ctx context.Context, userID uint) (*domain.TransferLimit, error)
+	SetLimit(ctx context.Context, limit *domain.TransferLimit) error
+	DeleteLimit(ctx context.Context, userID uint) (bool, error)
+}
+
+type transferLimitRepository struct {
+	db *gorm.DB
+}
+
+func NewTransferLimitRepository(db *gorm.DB) TransferLimitRepository {
+	return &transferLimitRepository{db: db}
+}
+
+func (r *transferLimitRepository) GetLimit(ctx context.Context, userID uint) (*domain.TransferLimit, error) {
+	var limit domain.TransferLimit
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&limit).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &limit, err
+}
+
+// SetLimit creates or replaces the override of limit.UserID.
+func (r *transferLimitRepository) SetLimit(ctx context.Context, limit *domain.TransferLimit) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"max_amount", "daily_amount", "daily_count", "updated_at"}),
+	}).Create(limit).Error
+}
+
+func (r *transferLimitRepository) DeleteLimit(ctx context.Context, userID uint) (bool, error) {
+	res := r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&domain.TransferLimit{})
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+)
+
+// Repositories groups repositories that share one database handle.
+type Repositories struct {
+	Users        UserRepository
+	Inventory    InventoryRepository
+	Merch        MerchRepository
+	Transactions TransactionRepository
+	Cart         CartRepository
+	Tokens       TokenRepository
+	CoinRequests CoinRequestRepository
+	Limits       TransferLimitRepository
+	Allowances   AllowanceRepository
+}
+
+// NewRepositories builds every repository on top of the given handle.
+func NewRepositories(db *gorm.DB) *Repositories {
+	return &Repositories{
+		Users:        NewUserRepository(db),
+		Inventory:    NewInventoryRepository(db),
+		Merch:        NewMerchRepository(db),
+		Transactions: NewTransactionRepository(db),
+		Cart:         NewCartRepository(db),
+		Tokens:       NewTokenRepository(db),
+		CoinRequests: NewCoinRequestRepository(db),
+		Limits:       NewTransferLimitRepository(db),
+		Allowances:   NewAllowanceRepository(db),
+	}
+}
+
+// UnitOfWork runs a function inside a single database transaction.
+// Repositories passed to the function are bound to that transaction and to ctx, so
+// either all of their changes are committed or none of them are, and their queries
+// are traced as part of the caller's span.
+type UnitOfWork interface {
+	Do(ctx context.Context, fn func(repos *Repositories) error) error
+	// ReadSnapshot runs fn in a read-only REPEATABLE READ transaction, so every query of
+	// fn sees the database as of the same moment.
+	ReadSnapshot(ctx context.Context, fn func(repos *Repositories) error) error
+}
+
+type unitOfWork struct {
+	db *gorm.DB
+}
+
+func NewUnitOfWork(db *gorm.DB) UnitOfWork {
+	return &unitOfWork{db: db}
+}
+
+func (u *unitOfWork) Do(ctx context.Context, fn func(repos *Repositories) error) error {
+	return u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(NewRepositories(tx))
+	})
+}
+
+func (u *unitOfWork) ReadSnapshot(ctx context.Context, fn func(repos *Repositories) error) error {
+	return u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(NewRepositories(tx))
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+}
@@ -2,19 +2,29 @@ package repositories
 
 import (
 	"avito-tech-go/internal/domain"
+	"context"
 	"errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrInsufficientCoins is returned by ChangeCoins when a debit would make the balance negative.
+var ErrInsufficientCoins = errors.New("insufficient coins")
+
 type UserRepository interface {
-	CreateUser(*domain.User) error
-	UpdateUser(*domain.User) error
-	GetUserByID(uint) (*domain.User, error)
-	DeleteUser(*domain.User) error
-	GetUserByName(username string) (*domain.User, error)
-	ExistsByUsername(username string) (bool, error)
-	ChangeCoins(userID int, delta int) error
-	GetUsernamesByIDs(ids []uint) (map[uint]string, error)
+	CreateUser(ctx context.Context, user *domain.User) error
+	UpdateUser(ctx context.Context, user *domain.User) error
+	GetUserByID(ctx context.Context, id uint) (*domain.User, error)
+	DeleteUser(ctx context.Context, user *domain.User) error
+	GetUserByName(ctx context.Context, username string) (*domain.User, error)
+	ExistsByUsername(ctx context.Context, username string) (bool, error)
+	ChangeCoins(ctx context.Context, userID uint, delta int) error
+	ForceChangeCoins(ctx context.Context, userID uint, delta int) error
+	GetUsernamesByIDs(ctx context.Context, ids []uint) (map[uint]string, error)
+	GetUsersByNames(ctx context.Context, usernames []string) (map[string]*domain.User, error)
+	LockUsersByIDs(ctx context.Context, ids []uint) (map[uint]*domain.User, error)
+	GetAllUsers(ctx context.Context) ([]domain.User, error)
+	SyncAdmins(ctx context.Context, usernames []string) error
 }
 
 type userRepository struct {
@@ -25,17 +35,17 @@ func NewUserRepository(db *gorm.DB) UserRepository {
 	return &userRepository{db: db}
 }
 
-func (u *userRepository) CreateUser(user *domain.User) error {
-	return u.db.Create(user).Error
+func (u *userRepository) CreateUser(ctx context.Context, user *domain.User) error {
+	return u.db.WithContext(ctx).Create(user).Error
 }
 
-func (u *userRepository) UpdateUser(user *domain.User) error {
-	return u.db.Save(user).Error
+func (u *userRepository) UpdateUser(ctx context.Context, user *domain.User) error {
+	return u.db.WithContext(ctx).Save(user).Error
 }
 
-func (u *userRepository) GetUserByID(ID uint) (*domain.User, error) {
+func (u *userRepository) GetUserByID(ctx context.Context, ID uint) (*domain.User, error) {
 	var user domain.User
-	err := u.db.Where("ID = ?", ID).First(&user).Error
+	err := u.db.WithContext(ctx).Where("ID = ?", ID).First(&user).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -43,9 +53,9 @@ func (u *userRepository) GetUserByID(ID uint) (*domain.User, error) {
 	return &user, err
 }
 
-func (u *userRepository) GetUserByName(username string) (*domain.User, error) {
+func (u *userRepository) GetUserByName(ctx context.Context, username string) (*domain.User, error) {
 	var user domain.User
-	err := u.db.Where("username = ?", username).First(&user).Error
+	err := u.db.WithContext(ctx).Where("username = ?", username).First(&user).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
@@ -53,13 +63,13 @@ func (u *userRepository) GetUserByName(username string) (*domain.User, error) {
 	return &user, err
 }
 
-func (u *userRepository) DeleteUser(user *domain.User) error {
-	return u.db.Delete(user).Error
+func (u *userRepository) DeleteUser(ctx context.Context, user *domain.User) error {
+	return u.db.WithContext(ctx).Delete(user).Error
 }
 
-func (u *userRepository) ExistsByUsername(username string) (bool, error) {
+func (u *userRepository) ExistsByUsername(ctx context.Context, username string) (bool, error) {
 	var count int64
-	err := u.db.Model(&domain.User{}).
+	err := u.db.WithContext(ctx).Model(&domain.User{}).
 		Where("username = ?", username).
 		Count(&count).Error
 	if err != nil {
@@ -69,8 +79,31 @@ func (u *userRepository) ExistsByUsername(username string) (bool, error) {
 	return count > 0, err
 }
 
-func (u *userRepository) ChangeCoins(userID int, delta int) error {
-	res := u.db.Model(&domain.User{}).
+// ChangeCoins atomically adds delta to the user's balance. Debits are applied
+// only while the balance stays non-negative, otherwise ErrInsufficientCoins is returned.
+func (u *userRepository) ChangeCoins(ctx context.Context, userID uint, delta int) error {
+	query := u.db.WithContext(ctx).Model(&domain.User{}).Where("ID = ?", userID)
+	if delta < 0 {
+		query = query.Where("coins >= ?", -delta)
+	}
+
+	res := query.Update("coins", gorm.Expr("coins + ?", delta))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		if delta < 0 {
+			return ErrInsufficientCoins
+		}
+		return errors.New("no rows affected (users not found?)")
+	}
+	return nil
+}
+
+// ForceChangeCoins adds delta to the user's balance even if it becomes negative.
+// It is meant for corrections such as forced reversals only.
+func (u *userRepository) ForceChangeCoins(ctx context.Context, userID uint, delta int) error {
+	res := u.db.WithContext(ctx).Model(&domain.User{}).
 		Where("ID = ?", userID).
 		Update("coins", gorm.Expr("coins + ?", delta))
 	if res.Error != nil {
@@ -82,9 +115,9 @@ func (u *userRepository) ChangeCoins(userID int, delta int) error {
 	return nil
 }
 
-func (u *userRepository) GetUsernamesByIDs(ids []uint) (map[uint]string, error) {
+func (u *userRepository) GetUsernamesByIDs(ctx context.Context, ids []uint) (map[uint]string, error) {
 	var users []domain.User
-	if err := u.db.Where("id IN ?", ids).Find(&users).Error; err != nil {
+	if err := u.db.WithContext(ctx).Where("id IN ?", ids).Find(&users).Error; err != nil {
 		return nil, err
 	}
 	result := make(map[uint]string, len(users))
@@ -93,3 +126,62 @@ func (u *userRepository) GetUsernamesByIDs(ids []uint) (map[uint]string, error)
 	}
 	return result, nil
 }
+
+// GetUsersByNames loads users by username in one query.
+// Unknown names are absent from the returned map.
+func (u *userRepository) GetUsersByNames(ctx context.Context, usernames []string) (map[string]*domain.User, error) {
+	var users []domain.User
+	if err := u.db.WithContext(ctx).Where("username IN ?", usernames).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[string]*domain.User, len(users))
+	for i := range users {
+		result[users[i].Username] = &users[i]
+	}
+	return result, nil
+}
+
+// LockUsersByIDs loads users with SELECT ... FOR UPDATE. Rows are locked in ascending
+// ID order so concurrent callers touching the same users can not deadlock.
+// Missing users are absent from the returned map.
+func (u *userRepository) LockUsersByIDs(ctx context.Context, ids []uint) (map[uint]*domain.User, error) {
+	var users []domain.User
+	err := u.db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id IN ?", ids).
+		Order("id").
+		Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint]*domain.User, len(users))
+	for i := range users {
+		result[users[i].ID] = &users[i]
+	}
+	return result, nil
+}
+
+func (u *userRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	var users []domain.User
+	err := u.db.WithContext(ctx).Order("id").Find(&users).Error
+	return users, err
+}
+
+// SyncAdmins makes the listed users admins and demotes the admins that are no longer
+// listed to regular users.
+func (u *userRepository) SyncAdmins(ctx context.Context, usernames []string) error {
+	return u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		demoted := tx.Model(&domain.User{}).Where("role = ?", domain.RoleAdmin)
+		if len(usernames) > 0 {
+			demoted = demoted.Where("username NOT IN ?", usernames)
+		}
+		if err := demoted.Update("role", domain.RoleUser).Error; err != nil {
+			return err
+		}
+		if len(usernames) == 0 {
+			return nil
+		}
+		return tx.Model(&domain.User{}).
+			Where("username IN ?", usernames).
+			Update("role", domain.RoleAdmin).Error
+	})
+}
@@ -3,16 +3,24 @@ package server
 import (
 	_ "avito-tech-go/docs"
 	"avito-tech-go/internal/config"
-	"avito-tech-go/internal/domain"
 	"avito-tech-go/internal/handlers"
+	"avito-tech-go/internal/jobs"
+	"avito-tech-go/internal/metrics"
 	"avito-tech-go/internal/middleware"
 	"avito-tech-go/internal/repositories"
 	"avito-tech-go/internal/services"
+	"avito-tech-go/internal/tracing"
 	"avito-tech-go/pkg/database"
+	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
 )
 
 // @title           API Avito shop
@@ -26,17 +34,35 @@ import (
 // @securityDefinitions.apikey BearerAuth
 // @in header
 // @name Authorization
-func Run(cfg *config.Config) error {
-	db, err := database.NewDBConnection(cfg)
+func Run(ctx context.Context, cfg *config.Config, logger *slog.Logger) error {
+	shutdownTracing, err := tracing.Setup(ctx, cfg.TracingExporter)
+	if err != nil {
+		return fmt.Errorf("failed to init tracing: %w", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.WithoutCancel(ctx)); err != nil {
+			logger.Error("failed to flush traces", "error", err)
+		}
+	}()
+
+	db, err := database.NewDBConnection(cfg, logger)
 	if err != nil {
 		return fmt.Errorf("failed to init db: %w", err)
 	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to init db: %w", err)
+	}
+	defer func() {
+		if err := sqlDB.Close(); err != nil {
+			logger.Error("failed to close db", "error", err)
+		}
+	}()
+	if err := metrics.RegisterDBStats(sqlDB, cfg.DBName); err != nil {
+		return fmt.Errorf("failed to register db metrics: %w", err)
+	}
 
-	if err := db.AutoMigrate(
-		&domain.User{},
-		&domain.MerchItem{},
-		&domain.InventoryItem{},
-		&domain.Transaction{}); err != nil {
+	if err := database.Migrate(db); err != nil {
 		return fmt.Errorf("failed to migrate db: %w", err)
 	}
 
@@ -48,28 +74,208 @@ func Run(cfg *config.Config) error {
 	merchRepo := repositories.NewMerchRepository(db)
 	invRepo := repositories.NewInventoryRepository(db)
 	txRepo := repositories.NewTransactionRepository(db)
+	idempotencyRepo := repositories.NewIdempotencyRepository(db)
+	cartRepo := repositories.NewCartRepository(db)
+	tokenRepo := repositories.NewTokenRepository(db)
+	securityEventRepo := repositories.NewSecurityEventRepository(db)
+	coinRequestRepo := repositories.NewCoinRequestRepository(db)
+	scheduledTransferRepo := repositories.NewScheduledTransferRepository(db)
+	transferLimitRepo := repositories.NewTransferLimitRepository(db)
+	allowanceRepo := repositories.NewAllowanceRepository(db)
+	uow := repositories.NewUnitOfWork(db)
+
+	if err := userRepo.SyncAdmins(ctx, cfg.AdminUsernames); err != nil {
+		return fmt.Errorf("failed to sync admins: %w", err)
+	}
 
-	authService := services.NewAuthService(userRepo, cfg.JWTSecret)
+	loginThrottler := services.NewLoginThrottler(services.NewMemoryLoginAttemptStore(), securityEventRepo, services.LoginThrottlePolicy{
+		UserAttempts: cfg.LoginMaxAttempts,
+		IPAttempts:   cfg.LoginMaxAttemptsPerIP,
+		BaseLockout:  cfg.LoginLockoutBase,
+		MaxLockout:   cfg.LoginLockoutMax,
+	}, nil)
+	authService := services.NewAuthService(userRepo, tokenRepo, uow, services.AuthOptions{
+		JWTSecret:       cfg.JWTSecret,
+		AdminUsernames:  cfg.AdminUsernames,
+		AccessTokenTTL:  cfg.AccessTokenTTL,
+		RefreshTokenTTL: cfg.RefreshTokenTTL,
+		Throttler:       loginThrottler,
+		Logger:          logger,
+	})
 	userService := services.NewUserService(userRepo, invRepo, txRepo)
-	transactionService := services.NewTransactionService(userRepo, txRepo, db)
-	merchService := services.NewMerchService(merchRepo, userRepo, txRepo, invRepo, db)
+	transferLimitService := services.NewTransferLimitService(transferLimitRepo, txRepo, services.TransferLimits{
+		MaxAmount:   cfg.TransferMaxAmount,
+		DailyAmount: cfg.TransferDailyAmount,
+		DailyCount:  cfg.TransferDailyCount,
+	}, nil)
+	transactionService := services.NewTransactionService(uow, transferLimitService)
+	merchService := services.NewMerchService(merchRepo, userRepo, uow)
+	cartService := services.NewCartService(cartRepo, merchRepo, uow)
+	coinRequestService := services.NewCoinRequestService(coinRequestRepo, userRepo, uow, transferLimitService, cfg.CoinRequestTTL, nil)
+	scheduledTransferService := services.NewScheduledTransferService(scheduledTransferRepo, userRepo, transactionService, cfg.ScheduleLocation, logger, nil)
+	idempotencyService := services.NewIdempotencyService(idempotencyRepo, cfg.IdempotencyTTL)
+	ledgerService := services.NewLedgerService(uow, txRepo)
+	reversalService := services.NewReversalService(uow, cfg.RefundWindow, logger, nil)
+	allowanceService := services.NewAllowanceService(allowanceRepo, uow, services.AllowanceOptions{
+		Amount:     cfg.AllowanceAmount,
+		Period:     cfg.AllowancePeriod,
+		MaxBalance: cfg.AllowanceMaxBalance,
+		Location:   cfg.ScheduleLocation,
+		Logger:     logger,
+	}, nil)
+
+	if _, err := ledgerService.OpenMissingAccounts(ctx); err != nil {
+		return fmt.Errorf("failed to open ledger accounts: %w", err)
+	}
 
-	r := gin.Default()
+	// Jobs stop with the server; a run in progress is waited for before the database
+	// is closed.
+	jobsCtx, stopJobs := context.WithCancel(ctx)
+	var jobsDone sync.WaitGroup
+	defer func() {
+		stopJobs()
+		jobsDone.Wait()
+	}()
 
-	r.GET("/ping", func(c *gin.Context) {
-		c.JSON(200, gin.H{"message": "pong"})
+	jobs.RunPeriodically(jobsCtx, &jobsDone, logger, "idempotency-cleanup", time.Hour, func(ctx context.Context) error {
+		_, err := idempotencyService.Cleanup(ctx)
+		return err
+	})
+	jobs.RunPeriodically(jobsCtx, &jobsDone, logger, "token-cleanup", time.Hour, func(ctx context.Context) error {
+		_, err := authService.CleanupTokens(ctx)
+		return err
+	})
+	jobs.RunPeriodically(jobsCtx, &jobsDone, logger, "login-throttle-prune", 10*time.Minute, func(context.Context) error {
+		loginThrottler.Prune()
+		return nil
+	})
+	jobs.RunPeriodically(jobsCtx, &jobsDone, logger, "coin-request-expiry", 10*time.Minute, func(ctx context.Context) error {
+		_, err := coinRequestService.ExpireStale(ctx)
+		return err
+	})
+	jobs.RunPeriodically(jobsCtx, &jobsDone, logger, "scheduled-transfers", time.Minute, func(ctx context.Context) error {
+		_, err := scheduledTransferService.RunDue(ctx)
+		return err
+	})
+	jobs.RunPeriodically(jobsCtx, &jobsDone, logger, "allowance", 10*time.Minute, func(ctx context.Context) error {
+		_, err := allowanceService.IssueDue(ctx)
+		return err
 	})
+	jobs.RunPeriodically(jobsCtx, &jobsDone, logger, "ledger-reconcile", time.Hour, func(ctx context.Context) error {
+		report, err := ledgerService.Reconcile(ctx)
+		if err != nil {
+			return err
+		}
+		if !report.Consistent() {
+			return fmt.Errorf("ledger is inconsistent: %d balance drifts, total %d, %d unbalanced transactions",
+				len(report.Drifts), report.LedgerTotal, len(report.UnbalancedTransactions))
+		}
+		return nil
+	})
+
+	r := gin.New()
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+	r.Use(middleware.RequestIDMiddleware(), middleware.TracingMiddleware(), middleware.RequestLoggerMiddleware(logger),
+		middleware.MetricsMiddleware(), middleware.RecoveryMiddleware(logger),
+		middleware.TimeoutMiddleware(cfg.RequestTimeout))
 
+	healthService := services.NewHealthService(repositories.NewHealthRepository(db, database.Models...))
+	r.GET("/healthz", handlers.HealthzHandler())
+	// /ping predates the probes and is kept for existing monitoring.
+	r.GET("/ping", handlers.HealthzHandler())
+	r.GET("/readyz", handlers.ReadyzHandler(healthService))
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	r.POST("/api/auth", handlers.AuthHandler(authService))
+	authMw := middleware.JWTAuthMiddleware(cfg.JWTSecret, authService)
 
-	authMw := middleware.JWTAuthMiddleware(cfg.JWTSecret)
+	r.POST("/api/auth", handlers.AuthHandler(authService, cfg.AuthAutoRegister))
+	r.POST("/api/register", handlers.RegisterHandler(authService))
+	r.POST("/api/login", handlers.LoginHandler(authService))
+	r.POST("/api/auth/refresh", handlers.RefreshHandler(authService))
+	r.POST("/api/auth/logout", authMw, handlers.LogoutHandler(authService))
+
+	idempotencyMw := middleware.IdempotencyMiddleware(idempotencyService)
 
 	r.GET("/api/info", authMw, handlers.InfoHandler(userService))
-	r.POST("/api/sendCoin", authMw, handlers.SendCoinHandler(transactionService, userRepo))
-	r.GET("/api/buy/:item", authMw, handlers.BuyMerchHandler(merchService))
+	r.GET("/api/history", authMw, handlers.HistoryHandler(userService))
+	r.GET("/api/limits", authMw, handlers.MyTransferLimitsHandler(transferLimitService))
+	r.POST("/api/sendCoin", authMw, idempotencyMw, handlers.SendCoinHandler(transactionService, userRepo))
+	r.POST("/api/sendCoin/batch", authMw, idempotencyMw, handlers.SendCoinBatchHandler(transactionService))
+	r.GET("/api/buy/:item", authMw, idempotencyMw, handlers.BuyMerchHandler(merchService))
+	r.POST("/api/buy", authMw, idempotencyMw, handlers.BuyMerchItemsHandler(merchService))
+	r.GET("/api/merch", authMw, handlers.MerchCatalogHandler(merchService))
+	r.GET("/api/merch/:item", authMw, handlers.MerchItemHandler(merchService))
+	r.POST("/api/purchases/:id/refund", authMw, idempotencyMw, handlers.RefundPurchaseHandler(reversalService))
+
+	cart := r.Group("/api/cart", authMw)
+	cart.GET("", handlers.GetCartHandler(cartService))
+	cart.POST("", handlers.AddCartItemHandler(cartService))
+	cart.DELETE("/:item", handlers.RemoveCartItemHandler(cartService))
+	cart.POST("/checkout", idempotencyMw, handlers.CheckoutCartHandler(cartService))
+
+	coinRequests := r.Group("/api/coinRequests", authMw)
+	coinRequests.POST("", handlers.CreateCoinRequestHandler(coinRequestService, userRepo))
+	coinRequests.GET("/incoming", handlers.IncomingCoinRequestsHandler(coinRequestService))
+	coinRequests.GET("/outgoing", handlers.OutgoingCoinRequestsHandler(coinRequestService))
+	coinRequests.POST("/:id/accept", idempotencyMw, handlers.AcceptCoinRequestHandler(coinRequestService))
+	coinRequests.POST("/:id/decline", handlers.DeclineCoinRequestHandler(coinRequestService))
+	coinRequests.POST("/:id/cancel", handlers.CancelCoinRequestHandler(coinRequestService))
+
+	scheduled := r.Group("/api/scheduledTransfers", authMw)
+	scheduled.POST("", handlers.CreateScheduledTransferHandler(scheduledTransferService, userRepo))
+	scheduled.GET("", handlers.ListScheduledTransfersHandler(scheduledTransferService))
+	scheduled.GET("/:id", handlers.GetScheduledTransferHandler(scheduledTransferService))
+	scheduled.PUT("/:id", handlers.UpdateScheduledTransferHandler(scheduledTransferService, userRepo))
+	scheduled.DELETE("/:id", handlers.DeleteScheduledTransferHandler(scheduledTransferService))
+
+	admin := r.Group("/api/admin", authMw, middleware.AdminOnlyMiddleware(userRepo))
+	admin.POST("/merch", handlers.CreateMerchItemHandler(merchService))
+	admin.PUT("/merch/:item", handlers.UpdateMerchItemHandler(merchService))
+	admin.PUT("/merch/:item/stock", handlers.SetMerchItemStockHandler(merchService))
+	admin.DELETE("/merch/:item", handlers.RetireMerchItemHandler(merchService))
+	admin.GET("/limits/:username", handlers.GetTransferLimitsHandler(transferLimitService, userRepo))
+	admin.PUT("/limits/:username", handlers.SetTransferLimitsHandler(transferLimitService, userRepo))
+	admin.DELETE("/limits/:username", handlers.ClearTransferLimitsHandler(transferLimitService, userRepo))
+	admin.POST("/transactions/:id/reverse", handlers.ReverseTransferHandler(reversalService))
 
 	addr := fmt.Sprintf(":%s", cfg.AppPort)
-	return r.Run(addr)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	logger.Info("server listening", "addr", addr)
+	srv := &http.Server{
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return Serve(ctx, srv, ln, cfg.ShutdownTimeout, logger)
+}
+
+// Serve serves HTTP on ln until ctx is cancelled. It then stops accepting connections
+// and gives the requests in flight up to drainTimeout to finish before closing their
+// connections.
+func Serve(ctx context.Context, srv *http.Server, ln net.Listener, drainTimeout time.Duration, logger *slog.Logger) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-served:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	logger.Info("shutting down", "drain_timeout", drainTimeout)
+	drainCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), drainTimeout)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		_ = srv.Close()
+		return fmt.Errorf("failed to drain requests: %w", err)
+	}
+	logger.Info("server stopped")
+	return nil
 }
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/logging"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/tracing"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Allowance periods. Each user gets the allowance once per calendar period, on the
+// first run of the job in that period. Users who registered during a period get
+// their first allowance in the next one.
+const (
+	AllowanceDaily   = "daily"
+	AllowanceWeekly  = "weekly"
+	AllowanceMonthly = "monthly"
+)
+
+// allowanceBatch is how many users one query of the allowance job picks.
+const allowanceBatch = 500
+
+// AllowanceOptions configure the periodic allowance. A zero Amount disables it; a zero
+// MaxBalance issues it regardless of the balance. Periods follow the calendar of
+// Location, UTC when nil. A nil Logger discards logs.
+type AllowanceOptions struct {
+	Amount     int
+	Period     string
+	MaxBalance int
+	Location   *time.Location
+	Logger     *slog.Logger
+}
+
+// AllowanceService issues the periodic coin allowance.
+type AllowanceService interface {
+	// IssueDue gives the allowance of the current period to every user that existed
+	// when the period started and has not got it yet, and returns how many users were
+	// credited. Running it again in the same period issues nothing.
+	IssueDue(ctx context.Context) (int, error)
+}
+
+type allowanceService struct {
+	repo repositories.AllowanceRepository
+	uow  repositories.UnitOfWork
+	opts AllowanceOptions
+	now  func() time.Time
+}
+
+// NewAllowanceService creates the service. A nil now means time.Now.
+func NewAllowanceService(
+	repo repositories.AllowanceRepository,
+	uow repositories.UnitOfWork,
+	opts AllowanceOptions,
+	now func() time.Time,
+) AllowanceService {
+	if opts.Location == nil {
+		opts.Location = time.UTC
+	}
+	opts.Logger = logging.OrDiscard(opts.Logger)
+	if now == nil {
+		now = time.Now
+	}
+	return &allowanceService{repo: repo, uow: uow, opts: opts, now: now}
+}
+
+func (s *allowanceService) IssueDue(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "AllowanceService.IssueDue")
+	defer span.End()
+
+	if s.opts.Amount <= 0 {
+		return 0, nil
+	}
+	now := s.now().In(s.opts.Location)
+	period := AllowancePeriod(s.opts.Period, now)
+	periodStart := AllowancePeriodStart(s.opts.Period, now)
+
+	issued := 0
+	for {
+		ids, err := s.repo.GetUserIDsWithoutGrant(ctx, period, periodStart, allowanceBatch)
+		if err != nil {
+			return issued, err
+		}
+		if len(ids) == 0 {
+			if issued > 0 {
+				s.opts.Logger.InfoContext(ctx, "allowance issued", "period", period, "users", issued)
+			}
+			return issued, nil
+		}
+		for _, id := range ids {
+			credited, err := s.grant(ctx, id, period)
+			if err != nil {
+				return issued, err
+			}
+			if credited {
+				issued++
+			}
+		}
+	}
+}
+
+// grant issues the allowance of the period to one user. The grant row is claimed in
+// the same transaction as the credit, so a concurrent or repeated run can not issue
+// it twice.
+func (s *allowanceService) grant(ctx context.Context, userID uint, period string) (bool, error) {
+	credited := false
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		grant := &domain.AllowanceGrant{UserID: userID, Period: period}
+		claimed, err := repos.Allowances.ClaimGrant(ctx, grant)
+		if err != nil || !claimed {
+			return err
+		}
+
+		users, err := repos.Users.LockUsersByIDs(ctx, []uint{userID})
+		if err != nil {
+			return err
+		}
+		user, ok := users[userID]
+		if !ok {
+			return fmt.Errorf("user %d not found", userID)
+		}
+
+		amount := s.opts.Amount
+		if s.opts.MaxBalance > 0 {
+			amount = min(amount, s.opts.MaxBalance-user.Coins)
+		}
+		if amount <= 0 {
+			return nil
+		}
+
+		if err := repos.Users.ChangeCoins(ctx, userID, amount); err != nil {
+			return err
+		}
+		transaction := &domain.Transaction{
+			FromUserID: userID,
+			Amount:     amount,
+			Type:       domain.Grant,
+			Message:    "allowance for " + period,
+		}
+		if err := repos.Transactions.CreateTransaction(ctx, transaction); err != nil {
+			return err
+		}
+
+		grant.Amount = amount
+		grant.TransactionID = &transaction.ID
+		credited = true
+		return repos.Allowances.UpdateGrant(ctx, grant)
+	})
+	if err != nil {
+		return false, err
+	}
+	return credited, nil
+}
+
+// AllowancePeriod returns the key of the period t falls in: "2006-01-02" for daily,
+// the ISO week such as "2006-W01" for weekly and "2006-01" for monthly allowances.
+func AllowancePeriod(period string, t time.Time) string {
+	switch period {
+	case AllowanceDaily:
+		return t.Format("2006-01-02")
+	case AllowanceWeekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	default:
+		return t.Format("2006-01")
+	}
+}
+
+// AllowancePeriodStart returns the start of the period t falls in, in the time zone of t:
+// midnight for daily, Monday midnight for weekly and the first of the month for monthly
+// allowances.
+func AllowancePeriodStart(period string, t time.Time) time.Time {
+	year, month, day := t.Date()
+	switch period {
+	case AllowanceDaily:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	case AllowanceWeekly:
+		sinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-sinceMonday, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+	}
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/tracing"
+	"context"
+	"fmt"
+	"sort"
+)
+
+// BalanceMismatch describes a user whose stored balance differs from the balance
+// recomputed from the transactions table.
+type BalanceMismatch struct {
+	UserID        uint   `json:"userId"`
+	Username      string `json:"username"`
+	StoredCoins   int    `json:"storedCoins"`
+	ExpectedCoins int    `json:"expectedCoins"`
+}
+
+// InventoryMismatch describes an inventory item whose quantity differs from the number
+// of purchases. An empty ItemType means the totals over all items were compared, which
+// happens when some purchases predate item tracking.
+type InventoryMismatch struct {
+	UserID    uint   `json:"userId"`
+	Username  string `json:"username"`
+	ItemType  string `json:"itemType"`
+	Quantity  int    `json:"quantity"`
+	Purchased int    `json:"purchased"`
+}
+
+// AuditReport is the result of recomputing every balance and inventory from history.
+type AuditReport struct {
+	UsersChecked        int                 `json:"usersChecked"`
+	BalanceMismatches   []BalanceMismatch   `json:"balanceMismatches"`
+	InventoryMismatches []InventoryMismatch `json:"inventoryMismatches"`
+}
+
+// HasMismatches reports whether the audit found any inconsistency.
+func (r *AuditReport) HasMismatches() bool {
+	return len(r.BalanceMismatches) > 0 || len(r.InventoryMismatches) > 0
+}
+
+type AuditService interface {
+	Audit(ctx context.Context) (*AuditReport, error)
+	FixBalances(ctx context.Context, report *AuditReport) (int, error)
+}
+
+type auditService struct {
+	uow repositories.UnitOfWork
+}
+
+func NewAuditService(uow repositories.UnitOfWork) AuditService {
+	return &auditService{uow: uow}
+}
+
+// Audit walks every user, recomputes the expected balance as the initial balance plus
+// received transfers minus sent transfers and purchases, and compares inventory
+// quantities with purchased quantities. All reads share one snapshot, so transfers
+// committed while the audit runs can not show up as mismatches.
+func (s *auditService) Audit(ctx context.Context) (*AuditReport, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.Audit")
+	defer span.End()
+
+	report := &AuditReport{
+		BalanceMismatches:   []BalanceMismatch{},
+		InventoryMismatches: []InventoryMismatch{},
+	}
+	err := s.uow.ReadSnapshot(ctx, func(repos *repositories.Repositories) error {
+		users, err := repos.Users.GetAllUsers(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := range users {
+			user := &users[i]
+			transactions, err := repos.Transactions.GetUserTransactions(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+			inventory, err := repos.Inventory.GetAllByUser(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+
+			if expected := expectedBalance(user.ID, transactions); expected != user.Coins {
+				report.BalanceMismatches = append(report.BalanceMismatches, BalanceMismatch{
+					UserID:        user.ID,
+					Username:      user.Username,
+					StoredCoins:   user.Coins,
+					ExpectedCoins: expected,
+				})
+			}
+			report.InventoryMismatches = append(report.InventoryMismatches,
+				inventoryMismatches(user, transactions, inventory)...)
+			report.UsersChecked++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// FixBalances sets every mismatched balance to the expected one and posts the difference
+// to the ledger, so that the cached balance, the ledger and the history agree again.
+// The report only names the users to look at: the audit ran without locks, so each
+// user's expected balance is recomputed after locking the user's row, and users whose
+// balance and ledger agree with their history by then are left alone.
+func (s *auditService) FixBalances(ctx context.Context, report *AuditReport) (int, error) {
+	ctx, span := tracing.Start(ctx, "AuditService.FixBalances")
+	defer span.End()
+
+	fixed := 0
+	for _, mismatch := range report.BalanceMismatches {
+		changed := false
+		err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+			users, err := repos.Users.LockUsersByIDs(ctx, []uint{mismatch.UserID})
+			if err != nil {
+				return err
+			}
+			user, ok := users[mismatch.UserID]
+			if !ok {
+				return fmt.Errorf("user %d not found", mismatch.UserID)
+			}
+
+			transactions, err := repos.Transactions.GetUserTransactions(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+			expected := expectedBalance(user.ID, transactions)
+			ledgerCoins, err := repos.Transactions.GetAccountBalance(ctx, domain.UserAccountCode(user.ID))
+			if err != nil {
+				return err
+			}
+
+			if delta := expected - ledgerCoins; delta != 0 {
+				if err := repos.Transactions.IssueCoins(ctx, user.ID, delta); err != nil {
+					return err
+				}
+				changed = true
+			}
+			if delta := expected - user.Coins; delta != 0 {
+				if err := repos.Users.ChangeCoins(ctx, user.ID, delta); err != nil {
+					return err
+				}
+				changed = true
+			}
+			return nil
+		})
+		if err != nil {
+			return fixed, err
+		}
+		if changed {
+			fixed++
+		}
+	}
+	return fixed, nil
+}
+
+func expectedBalance(userID uint, transactions []domain.Transaction) int {
+	balance := domain.InitialCoins
+	for _, tx := range transactions {
+		switch tx.Type {
+		case domain.Transfer, domain.Reversal:
+			if tx.FromUserID == userID {
+				balance -= tx.Amount
+			} else {
+				balance += tx.Amount
+			}
+		case domain.Purchase:
+			balance -= tx.Amount
+		case domain.Refund, domain.Grant:
+			balance += tx.Amount
+		}
+	}
+	return balance
+}
+
+func inventoryMismatches(user *domain.User, transactions []domain.Transaction, inventory []domain.InventoryItem) []InventoryMismatch {
+	purchased := make(map[string]int)
+	totalPurchased, untracked := 0, false
+	for _, tx := range transactions {
+		quantity := tx.Quantity
+		switch tx.Type {
+		case domain.Purchase:
+		case domain.Refund:
+			quantity = -quantity
+		default:
+			continue
+		}
+		totalPurchased += quantity
+		if tx.ItemType == "" {
+			untracked = true
+			continue
+		}
+		purchased[tx.ItemType] += quantity
+	}
+
+	quantities := make(map[string]int)
+	totalQuantity := 0
+	for _, item := range inventory {
+		quantities[item.ItemType] += item.Quantity
+		totalQuantity += item.Quantity
+	}
+
+	var mismatches []InventoryMismatch
+	if untracked {
+		if totalQuantity != totalPurchased {
+			mismatches = append(mismatches, InventoryMismatch{
+				UserID:    user.ID,
+				Username:  user.Username,
+				Quantity:  totalQuantity,
+				Purchased: totalPurchased,
+			})
+		}
+		return mismatches
+	}
+
+	itemTypes := make(map[string]struct{})
+	for itemType := range purchased {
+		itemTypes[itemType] = struct{}{}
+	}
+	for itemType := range quantities {
+		itemTypes[itemType] = struct{}{}
+	}
+	sorted := make([]string, 0, len(itemTypes))
+	for itemType := range itemTypes {
+		sorted = append(sorted, itemType)
+	}
+	sort.Strings(sorted)
+
+	for _, itemType := range sorted {
+		if quantities[itemType] != purchased[itemType] {
+			mismatches = append(mismatches, InventoryMismatch{
+				UserID:    user.ID,
+				Username:  user.Username,
+				ItemType:  itemType,
+				Quantity:  quantities[itemType],
+				Purchased: purchased[itemType],
+			})
+		}
+	}
+	return mismatches
+}
@@ -2,30 +2,134 @@ package services
 
 import (
 	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/logging"
 	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/tracing"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt"
 	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"sync"
 	"time"
 )
 
+const (
+	// DefaultAccessTokenTTL is used when AuthOptions.AccessTokenTTL is not set.
+	DefaultAccessTokenTTL = 15 * time.Minute
+	// DefaultRefreshTokenTTL is used when AuthOptions.RefreshTokenTTL is not set.
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	// ErrUserNotFound is returned when logging in with an unknown username.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalidCredentials is returned when the password does not match.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrUserExists is returned when registering a username that is already taken.
+	ErrUserExists = errors.New("user already exists")
+	// ErrInvalidRefreshToken is returned for unknown, expired, revoked or reused refresh tokens.
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+)
+
+// TokenPair is a short-lived access token together with the refresh token that renews it.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+	// Registered is set when the call created the user.
+	Registered bool
+}
+
+// AuthOptions configures token issuing. Users listed in AdminUsernames get the admin
+// role when they register.
+type AuthOptions struct {
+	JWTSecret       string
+	AdminUsernames  []string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// Throttler limits failed logins; nil disables the limit.
+	Throttler LoginThrottler
+	// Logger records registrations, failed logins and refresh token reuse; nil
+	// discards them.
+	Logger *slog.Logger
+}
+
 type AuthService interface {
-	Register(username, password string) (string, error)
-	Login(username, password string) (string, error)
+	Register(ctx context.Context, username, password string) (*TokenPair, error)
+	Login(ctx context.Context, username, password, ip string) (*TokenPair, error)
+	LoginOrRegister(ctx context.Context, username, password, ip string) (*TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string) (*TokenPair, error)
+	Logout(ctx context.Context, userID uint, jti string, accessExpiresAt time.Time, refreshToken string) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	CleanupTokens(ctx context.Context) (int64, error)
 }
 
 type authService struct {
-	userRepo  repositories.UserRepository
-	jwtSecret string
+	userRepo        repositories.UserRepository
+	tokenRepo       repositories.TokenRepository
+	uow             repositories.UnitOfWork
+	jwtSecret       string
+	adminUsernames  map[string]struct{}
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	throttler       LoginThrottler
+	log             *slog.Logger
+	now             func() time.Time
 }
 
-func NewAuthService(userRepo repositories.UserRepository, jwtSecret string) AuthService {
+func NewAuthService(
+	userRepo repositories.UserRepository,
+	tokenRepo repositories.TokenRepository,
+	uow repositories.UnitOfWork,
+	opts AuthOptions,
+) AuthService {
+	admins := make(map[string]struct{}, len(opts.AdminUsernames))
+	for _, username := range opts.AdminUsernames {
+		admins[username] = struct{}{}
+	}
+	if opts.AccessTokenTTL <= 0 {
+		opts.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if opts.RefreshTokenTTL <= 0 {
+		opts.RefreshTokenTTL = DefaultRefreshTokenTTL
+	}
 	return &authService{
-		userRepo:  userRepo,
-		jwtSecret: jwtSecret,
+		userRepo:        userRepo,
+		tokenRepo:       tokenRepo,
+		uow:             uow,
+		jwtSecret:       opts.JWTSecret,
+		adminUsernames:  admins,
+		accessTokenTTL:  opts.AccessTokenTTL,
+		refreshTokenTTL: opts.RefreshTokenTTL,
+		throttler:       opts.Throttler,
+		log:             logging.OrDiscard(opts.Logger),
+		now:             time.Now,
 	}
 }
 
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// dummyPasswordHash returns a valid bcrypt hash that no password is expected to match.
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		hash, err := HashPassword("dummy password for unknown users")
+		if err != nil {
+			panic(err)
+		}
+		dummyHash = hash
+	})
+	return dummyHash
+}
+
 func HashPassword(s string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(s), bcrypt.DefaultCost)
 	if err != nil {
@@ -38,10 +142,19 @@ func CheckPassword(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
 func (a *authService) generateJWT(user *domain.User) (string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := a.now()
 	claims := jwt.MapClaims{
 		"username": user.Username,
 		"user_id":  user.ID,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
+		"role":     user.Role,
+		"jti":      jti,
+		"iat":      now.Unix(),
+		"exp":      now.Add(a.accessTokenTTL).Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -54,53 +167,258 @@ func (a *authService) generateJWT(user *domain.User) (string, error) {
 	return tokenString, nil
 }
 
-func (a *authService) Register(username, password string) (string, error) {
-	exists, err := a.userRepo.ExistsByUsername(username)
+// issueTokens signs an access token and stores a new refresh token with tokenRepo.
+func (a *authService) issueTokens(ctx context.Context, tokenRepo repositories.TokenRepository, user *domain.User) (*TokenPair, error) {
+	accessToken, err := a.generateJWT(user)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	err = tokenRepo.CreateRefreshToken(ctx, &domain.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: a.now().Add(a.refreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    a.accessTokenTTL,
+	}, nil
+}
+
+func (a *authService) Register(ctx context.Context, username, password string) (*TokenPair, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Register")
+	defer span.End()
+
+	exists, err := a.userRepo.ExistsByUsername(ctx, username)
+	if err != nil {
+		return nil, err
 	}
 	if exists {
-		return "", fmt.Errorf("user '%s' already exists", username)
+		return nil, fmt.Errorf("%w: %s", ErrUserExists, username)
 	}
 
 	hashed, err := HashPassword(password)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	user := &domain.User{
 		Username:     username,
-		PasswordHash: hashed}
-
-	if err := a.userRepo.CreateUser(user); err != nil {
-		return "", err
+		PasswordHash: hashed,
+		Coins:        domain.InitialCoins,
+		Role:         domain.RoleUser,
+	}
+	if _, ok := a.adminUsernames[username]; ok {
+		user.Role = domain.RoleAdmin
 	}
 
-	token, err := a.generateJWT(user)
+	var tokens *TokenPair
+	err = a.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		if err := repos.Users.CreateUser(ctx, user); err != nil {
+			return err
+		}
+		if err := repos.Transactions.IssueCoins(ctx, user.ID, user.Coins); err != nil {
+			return err
+		}
+		tokens, err = a.issueTokens(ctx, repos.Tokens, user)
+		return err
+	})
 	if err != nil {
-		return "", err
+		// A concurrent registration with the same name wins the unique index.
+		if exists, existsErr := a.userRepo.ExistsByUsername(ctx, username); existsErr == nil && exists {
+			return nil, fmt.Errorf("%w: %s", ErrUserExists, username)
+		}
+		return nil, err
 	}
 
-	return token, nil
+	a.log.InfoContext(ctx, "user registered", "user_id", user.ID, "username", username, "role", user.Role)
+	tokens.Registered = true
+	return tokens, nil
 }
 
-func (a *authService) Login(username, password string) (string, error) {
-	user, err := a.userRepo.GetUserByName(username)
+func (a *authService) Login(ctx context.Context, username, password, ip string) (*TokenPair, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Login")
+	defer span.End()
+
+	return a.login(ctx, username, password, ip, false)
+}
+
+// LoginOrRegister logs the user in or, if the username is unknown, registers it.
+// A wrong password for an existing user is never treated as a registration.
+func (a *authService) LoginOrRegister(ctx context.Context, username, password, ip string) (*TokenPair, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.LoginOrRegister")
+	defer span.End()
+
+	return a.login(ctx, username, password, ip, true)
+}
+
+func (a *authService) login(ctx context.Context, username, password, ip string, register bool) (*TokenPair, error) {
+	var reservation *LoginReservation
+	if a.throttler != nil {
+		var err error
+		if reservation, err = a.throttler.Reserve(username, ip); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := a.userRepo.GetUserByName(ctx, username)
 	if err != nil {
-		return "", err
+		a.releaseAttempt(reservation)
+		return nil, err
 	}
 	if user == nil {
-		return "", fmt.Errorf("user '%s' not found", username)
+		if register {
+			a.releaseAttempt(reservation)
+			return a.Register(ctx, username, password)
+		}
+		// Spend the same time as for an existing user, so response times do not
+		// reveal which usernames exist.
+		_ = CheckPassword(dummyPasswordHash(), password)
+		return nil, a.loginFailed(ctx, fmt.Errorf("%w: %s", ErrUserNotFound, username), username, ip, reservation)
 	}
 
 	if err := CheckPassword(user.PasswordHash, password); err != nil {
-		return "", err
+		return nil, a.loginFailed(ctx, ErrInvalidCredentials, username, ip, reservation)
+	}
+
+	if reservation != nil {
+		a.throttler.Succeeded(reservation)
+	}
+	return a.issueTokens(ctx, a.tokenRepo, user)
+}
+
+// loginFailed records the failure and returns loginErr, or the error of recording it.
+func (a *authService) loginFailed(ctx context.Context, loginErr error, username, ip string, reservation *LoginReservation) error {
+	a.log.WarnContext(ctx, "login failed", "username", username, "ip", ip, "error", loginErr)
+	if reservation == nil {
+		return loginErr
+	}
+	if err := a.throttler.Failed(ctx, reservation); err != nil {
+		return err
+	}
+	return loginErr
+}
+
+// releaseAttempt takes back a reserved attempt whose password was never checked.
+func (a *authService) releaseAttempt(reservation *LoginReservation) {
+	if reservation != nil {
+		a.throttler.Release(reservation)
 	}
+}
+
+// Refresh exchanges a refresh token for a new token pair and revokes the used one.
+// A refresh token that has already been used is a sign of theft, so presenting it
+// again revokes every refresh token of the user.
+func (a *authService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.Refresh")
+	defer span.End()
 
-	token, err := a.generateJWT(user)
+	stored, err := a.tokenRepo.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
 	if err != nil {
+		return nil, err
+	}
+	if stored == nil || !stored.ExpiresAt.After(a.now()) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var tokens *TokenPair
+	reused := stored.Revoked()
+	if !reused {
+		err = a.uow.Do(ctx, func(repos *repositories.Repositories) error {
+			revoked, err := repos.Tokens.RevokeRefreshToken(ctx, stored.ID, a.now())
+			if err != nil {
+				return err
+			}
+			if !revoked {
+				reused = true
+				return nil
+			}
+
+			user, err := repos.Users.GetUserByID(ctx, stored.UserID)
+			if err != nil {
+				return err
+			}
+			if user == nil {
+				return ErrInvalidRefreshToken
+			}
+
+			tokens, err = a.issueTokens(ctx, repos.Tokens, user)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if reused {
+		a.log.WarnContext(ctx, "refresh token reused, revoking all refresh tokens of the user", "user_id", stored.UserID)
+		if err := a.tokenRepo.RevokeUserRefreshTokens(ctx, stored.UserID, a.now()); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return tokens, nil
+}
+
+// Logout revokes the access token with the given ID and, if passed, the user's refresh token.
+func (a *authService) Logout(ctx context.Context, userID uint, jti string, accessExpiresAt time.Time, refreshToken string) error {
+	ctx, span := tracing.Start(ctx, "AuthService.Logout")
+	defer span.End()
+
+	return a.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		if err := repos.Tokens.RevokeAccessToken(ctx, jti, accessExpiresAt); err != nil {
+			return err
+		}
+		if refreshToken == "" {
+			return nil
+		}
+
+		stored, err := repos.Tokens.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+		if err != nil {
+			return err
+		}
+		if stored == nil || stored.UserID != userID {
+			return ErrInvalidRefreshToken
+		}
+		_, err = repos.Tokens.RevokeRefreshToken(ctx, stored.ID, a.now())
+		return err
+	})
+}
+
+func (a *authService) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.IsTokenRevoked")
+	defer span.End()
+
+	return a.tokenRepo.IsAccessTokenRevoked(ctx, jti)
+}
+
+// CleanupTokens removes expired refresh tokens and denylist entries.
+func (a *authService) CleanupTokens(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "AuthService.CleanupTokens")
+	defer span.End()
+
+	return a.tokenRepo.DeleteExpired(ctx, a.now())
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
 		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
 
-	return token, nil
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
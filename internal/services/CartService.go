@@ -0,0 +1,170 @@
+package services
+
+import (
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCartEmpty is returned when checking out a cart with nothing in it.
+	ErrCartEmpty = errors.New("cart is empty")
+	// ErrCartItemNotFound is returned when removing an item that is not in the cart.
+	ErrCartItemNotFound = errors.New("item is not in the cart")
+)
+
+// CartLine is a cart item together with its current price.
+// Available is false for items that were retired or sold out since they were added.
+// swagger:model CartLine
+type CartLine struct {
+	Type      string `json:"type"`
+	Quantity  int    `json:"quantity"`
+	Price     int    `json:"price"`
+	Subtotal  int    `json:"subtotal"`
+	Available bool   `json:"available"`
+}
+
+// CartResponse is the content of a user's cart.
+// swagger:model CartResponse
+type CartResponse struct {
+	Items []CartLine `json:"items"`
+	Total int        `json:"total"`
+}
+
+// CheckoutResponse is the result of a successful checkout.
+// swagger:model CheckoutResponse
+type CheckoutResponse struct {
+	Spent int `json:"spent"`
+}
+
+type CartService interface {
+	AddItem(ctx context.Context, userID uint, itemType string, quantity int) error
+	RemoveItem(ctx context.Context, userID uint, itemType string) error
+	GetCart(ctx context.Context, userID uint) (*CartResponse, error)
+	Checkout(ctx context.Context, userID uint) (*CheckoutResponse, error)
+}
+
+type cartService struct {
+	cartRepo  repositories.CartRepository
+	merchRepo repositories.MerchRepository
+	uow       repositories.UnitOfWork
+}
+
+func NewCartService(
+	cartRepo repositories.CartRepository,
+	merchRepo repositories.MerchRepository,
+	uow repositories.UnitOfWork,
+) CartService {
+	return &cartService{
+		cartRepo:  cartRepo,
+		merchRepo: merchRepo,
+		uow:       uow,
+	}
+}
+
+func (s *cartService) AddItem(ctx context.Context, userID uint, itemType string, quantity int) error {
+	ctx, span := tracing.Start(ctx, "CartService.AddItem")
+	defer span.End()
+
+	if quantity <= 0 || quantity > MaxPurchaseQuantity {
+		return ErrInvalidQuantity
+	}
+
+	merchItem, err := s.merchRepo.GetMerchItemByType(ctx, itemType)
+	if err != nil {
+		return err
+	}
+	if merchItem == nil {
+		return ErrMerchItemNotFound
+	}
+
+	added, err := s.cartRepo.AddItem(ctx, userID, itemType, quantity, MaxPurchaseQuantity)
+	if err != nil {
+		return err
+	}
+	if !added {
+		return fmt.Errorf("%w: the cart can not hold more pieces of %s", ErrInvalidQuantity, itemType)
+	}
+	return nil
+}
+
+func (s *cartService) RemoveItem(ctx context.Context, userID uint, itemType string) error {
+	ctx, span := tracing.Start(ctx, "CartService.RemoveItem")
+	defer span.End()
+
+	removed, err := s.cartRepo.RemoveItem(ctx, userID, itemType)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrCartItemNotFound
+	}
+	return nil
+}
+
+func (s *cartService) GetCart(ctx context.Context, userID uint) (*CartResponse, error) {
+	ctx, span := tracing.Start(ctx, "CartService.GetCart")
+	defer span.End()
+
+	cartItems, err := s.cartRepo.GetItems(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &CartResponse{Items: make([]CartLine, 0, len(cartItems))}
+	for _, cartItem := range cartItems {
+		line := CartLine{Type: cartItem.ItemType, Quantity: cartItem.Quantity}
+
+		merchItem, err := s.merchRepo.GetMerchItemByType(ctx, cartItem.ItemType)
+		if err != nil {
+			return nil, err
+		}
+		if merchItem != nil {
+			line.Price = merchItem.Price
+			line.Subtotal = merchItem.Price * cartItem.Quantity
+			line.Available = merchItem.Stock == nil || *merchItem.Stock >= cartItem.Quantity
+			resp.Total += line.Subtotal
+		}
+		resp.Items = append(resp.Items, line)
+	}
+
+	return resp, nil
+}
+
+// Checkout buys everything in the cart at current prices and empties it. Coins are
+// debited once; if anything cannot be bought, nothing is and the cart is left as is.
+func (s *cartService) Checkout(ctx context.Context, userID uint) (*CheckoutResponse, error) {
+	ctx, span := tracing.Start(ctx, "CartService.Checkout")
+	defer span.End()
+
+	var spent int
+	var lines []PurchaseLine
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		cartItems, err := repos.Cart.GetItems(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if len(cartItems) == 0 {
+			return ErrCartEmpty
+		}
+
+		lines = make([]PurchaseLine, 0, len(cartItems))
+		for _, cartItem := range cartItems {
+			lines = append(lines, PurchaseLine{ItemType: cartItem.ItemType, Quantity: cartItem.Quantity})
+		}
+
+		spent, err = purchase(ctx, repos, userID, lines)
+		if err != nil {
+			return err
+		}
+		return repos.Cart.Clear(ctx, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	observePurchase(lines)
+	return &CheckoutResponse{Spent: spent}, nil
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/metrics"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/tracing"
+	"context"
+	"errors"
+	"time"
+)
+
+// DefaultCoinRequestTTL is how long a coin request waits for an answer.
+const DefaultCoinRequestTTL = 7 * 24 * time.Hour
+
+var (
+	// ErrCoinRequestNotFound is returned for unknown requests and for requests
+	// the caller is not allowed to act on.
+	ErrCoinRequestNotFound = errors.New("coin request not found")
+	// ErrCoinRequestNotPending is returned when answering a request that was already
+	// accepted, declined or cancelled.
+	ErrCoinRequestNotPending = errors.New("coin request is no longer pending")
+	// ErrCoinRequestExpired is returned when answering a request after it expired.
+	ErrCoinRequestExpired = errors.New("coin request has expired")
+)
+
+// CoinRequestInfo is a coin request as shown to its requester and payer.
+// swagger:model CoinRequestInfo
+type CoinRequestInfo struct {
+	ID        uint                     `json:"id"`
+	Requester string                   `json:"requester"`
+	Payer     string                   `json:"payer"`
+	Amount    int                      `json:"amount"`
+	Message   string                   `json:"message,omitempty"`
+	Status    domain.CoinRequestStatus `json:"status"`
+	CreatedAt time.Time                `json:"createdAt"`
+	ExpiresAt time.Time                `json:"expiresAt"`
+}
+
+// CoinRequestService lets a user ask another user for coins. The requester is paid
+// by the payer only when the payer accepts the request.
+type CoinRequestService interface {
+	CreateRequest(ctx context.Context, requesterID, payerID uint, amount int, message string) (*CoinRequestInfo, error)
+	GetIncoming(ctx context.Context, payerID uint) ([]CoinRequestInfo, error)
+	GetOutgoing(ctx context.Context, requesterID uint) ([]CoinRequestInfo, error)
+	Accept(ctx context.Context, payerID, requestID uint) (*CoinRequestInfo, error)
+	Decline(ctx context.Context, payerID, requestID uint) error
+	Cancel(ctx context.Context, requesterID, requestID uint) error
+	ExpireStale(ctx context.Context) (int64, error)
+}
+
+type coinRequestService struct {
+	requestRepo repositories.CoinRequestRepository
+	userRepo    repositories.UserRepository
+	uow         repositories.UnitOfWork
+	limits      TransferLimitService
+	ttl         time.Duration
+	now         func() time.Time
+}
+
+// NewCoinRequestService creates the service. Accepting a request is checked against
+// the payer's transfer limits unless limits is nil. A zero ttl means
+// DefaultCoinRequestTTL and a nil now means time.Now.
+func NewCoinRequestService(
+	requestRepo repositories.CoinRequestRepository,
+	userRepo repositories.UserRepository,
+	uow repositories.UnitOfWork,
+	limits TransferLimitService,
+	ttl time.Duration,
+	now func() time.Time,
+) CoinRequestService {
+	if ttl <= 0 {
+		ttl = DefaultCoinRequestTTL
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &coinRequestService{
+		requestRepo: requestRepo,
+		userRepo:    userRepo,
+		uow:         uow,
+		limits:      limits,
+		ttl:         ttl,
+		now:         now,
+	}
+}
+
+func (s *coinRequestService) CreateRequest(ctx context.Context, requesterID, payerID uint, amount int, message string) (*CoinRequestInfo, error) {
+	ctx, span := tracing.Start(ctx, "CoinRequestService.CreateRequest")
+	defer span.End()
+
+	if err := validateTransfer(payerID, requesterID, amount); err != nil {
+		return nil, err
+	}
+	note, err := TransferNote{Message: message}.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	request := &domain.CoinRequest{
+		RequesterID: requesterID,
+		PayerID:     payerID,
+		Amount:      amount,
+		Message:     note.Message,
+		Status:      domain.CoinRequestPending,
+		ExpiresAt:   now.Add(s.ttl),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.requestRepo.CreateRequest(ctx, request); err != nil {
+		return nil, err
+	}
+
+	infos, err := s.describe(ctx, []domain.CoinRequest{*request})
+	if err != nil {
+		return nil, err
+	}
+	return &infos[0], nil
+}
+
+func (s *coinRequestService) GetIncoming(ctx context.Context, payerID uint) ([]CoinRequestInfo, error) {
+	ctx, span := tracing.Start(ctx, "CoinRequestService.GetIncoming")
+	defer span.End()
+
+	requests, err := s.requestRepo.GetPendingByPayer(ctx, payerID, s.now())
+	if err != nil {
+		return nil, err
+	}
+	return s.describe(ctx, requests)
+}
+
+func (s *coinRequestService) GetOutgoing(ctx context.Context, requesterID uint) ([]CoinRequestInfo, error) {
+	ctx, span := tracing.Start(ctx, "CoinRequestService.GetOutgoing")
+	defer span.End()
+
+	requests, err := s.requestRepo.GetByRequester(ctx, requesterID)
+	if err != nil {
+		return nil, err
+	}
+	return s.describe(ctx, requests)
+}
+
+// Accept pays the request. Marking the request as accepted and the transfer itself
+// happen in one transaction, so a request is paid at most once and a failed
+// transfer leaves it pending.
+func (s *coinRequestService) Accept(ctx context.Context, payerID, requestID uint) (*CoinRequestInfo, error) {
+	ctx, span := tracing.Start(ctx, "CoinRequestService.Accept")
+	defer span.End()
+
+	var accepted domain.CoinRequest
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		now := s.now()
+		request, err := openRequest(ctx, repos.CoinRequests, requestID, now, func(r *domain.CoinRequest) bool {
+			return r.PayerID == payerID
+		})
+		if err != nil {
+			return err
+		}
+
+		ok, err := repos.CoinRequests.ResolveRequest(ctx, request.ID, domain.CoinRequestAccepted, now)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrCoinRequestNotPending
+		}
+
+		transaction, err := transfer(ctx, repos, s.limits, request.PayerID, request.RequesterID, request.Amount, TransferNote{Message: request.Message})
+		if err != nil {
+			return err
+		}
+		if err := repos.CoinRequests.SetTransaction(ctx, request.ID, transaction.ID); err != nil {
+			return err
+		}
+
+		accepted = *request
+		accepted.Status = domain.CoinRequestAccepted
+		accepted.TransactionID = &transaction.ID
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrCoinRequestNotFound) && !errors.Is(err, ErrCoinRequestNotPending) && !errors.Is(err, ErrCoinRequestExpired) {
+			metrics.TransferFailed(TransferFailureReason(err))
+		}
+		return nil, err
+	}
+	metrics.TransferCompleted(accepted.Amount)
+
+	infos, err := s.describe(ctx, []domain.CoinRequest{accepted})
+	if err != nil {
+		return nil, err
+	}
+	return &infos[0], nil
+}
+
+func (s *coinRequestService) Decline(ctx context.Context, payerID, requestID uint) error {
+	ctx, span := tracing.Start(ctx, "CoinRequestService.Decline")
+	defer span.End()
+
+	return s.resolve(ctx, requestID, domain.CoinRequestDeclined, func(r *domain.CoinRequest) bool {
+		return r.PayerID == payerID
+	})
+}
+
+func (s *coinRequestService) Cancel(ctx context.Context, requesterID, requestID uint) error {
+	ctx, span := tracing.Start(ctx, "CoinRequestService.Cancel")
+	defer span.End()
+
+	return s.resolve(ctx, requestID, domain.CoinRequestCancelled, func(r *domain.CoinRequest) bool {
+		return r.RequesterID == requesterID
+	})
+}
+
+// ExpireStale marks pending requests past their deadline as expired and returns
+// how many were changed.
+func (s *coinRequestService) ExpireStale(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "CoinRequestService.ExpireStale")
+	defer span.End()
+
+	return s.requestRepo.ExpirePending(ctx, s.now())
+}
+
+func (s *coinRequestService) resolve(ctx context.Context, requestID uint, status domain.CoinRequestStatus, allowed func(*domain.CoinRequest) bool) error {
+	now := s.now()
+	request, err := openRequest(ctx, s.requestRepo, requestID, now, allowed)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.requestRepo.ResolveRequest(ctx, request.ID, status, now)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrCoinRequestNotPending
+	}
+	return nil
+}
+
+// openRequest loads a request the caller may answer and checks that it still waits
+// for an answer. Requests of other users are reported as not found.
+func openRequest(
+	ctx context.Context,
+	repo repositories.CoinRequestRepository,
+	requestID uint,
+	now time.Time,
+	allowed func(*domain.CoinRequest) bool,
+) (*domain.CoinRequest, error) {
+	request, err := repo.GetRequestByID(ctx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil || !allowed(request) {
+		return nil, ErrCoinRequestNotFound
+	}
+	if request.Status != domain.CoinRequestPending {
+		return nil, ErrCoinRequestNotPending
+	}
+	if !request.ExpiresAt.After(now) {
+		return nil, ErrCoinRequestExpired
+	}
+	return request, nil
+}
+
+func (s *coinRequestService) describe(ctx context.Context, requests []domain.CoinRequest) ([]CoinRequestInfo, error) {
+	ids := make([]uint, 0, 2*len(requests))
+	for _, r := range requests {
+		ids = append(ids, r.RequesterID, r.PayerID)
+	}
+	names, err := s.userRepo.GetUsernamesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]CoinRequestInfo, 0, len(requests))
+	for _, r := range requests {
+		infos = append(infos, CoinRequestInfo{
+			ID:        r.ID,
+			Requester: names[r.RequesterID],
+			Payer:     names[r.PayerID],
+			Amount:    r.Amount,
+			Message:   r.Message,
+			Status:    r.Status,
+			CreatedAt: r.CreatedAt,
+			ExpiresAt: r.ExpiresAt,
+		})
+	}
+	return infos, nil
+}
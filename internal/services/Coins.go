@@ -0,0 +1,26 @@
+package services
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrAmountTooLarge is returned when the total of an order or a batch does not fit in
+// an int.
+var ErrAmountTooLarge = errors.New("total amount is too large")
+
+// addCoins returns a+b for non-negative a and b, or false if the sum overflows.
+func addCoins(a, b int) (int, bool) {
+	if a > math.MaxInt-b {
+		return 0, false
+	}
+	return a + b, true
+}
+
+// mulCoins returns a*b for non-negative a and b, or false if the product overflows.
+func mulCoins(a, b int) (int, bool) {
+	if a != 0 && b > math.MaxInt/a {
+		return 0, false
+	}
+	return a * b, true
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotReady is returned by Ready when the service cannot serve requests yet.
+var ErrNotReady = errors.New("service is not ready")
+
+type HealthService interface {
+	Ready(ctx context.Context) error
+}
+
+type healthService struct {
+	repo repositories.HealthRepository
+}
+
+func NewHealthService(repo repositories.HealthRepository) HealthService {
+	return &healthService{repo: repo}
+}
+
+// Ready checks that the database answers and that its migrations have been applied.
+// The error wraps ErrNotReady and says which check failed.
+func (s *healthService) Ready(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "HealthService.Ready")
+	defer span.End()
+
+	if err := s.repo.Ping(ctx); err != nil {
+		return fmt.Errorf("%w: database is unreachable: %v", ErrNotReady, err)
+	}
+	missing, err := s.repo.MissingTables(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: failed to check migrations: %v", ErrNotReady, err)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: migrations are not applied, missing tables: %s", ErrNotReady, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/tracing"
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrIdempotencyKeyReused is returned when a key is sent again with a different request.
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+	// ErrIdempotencyKeyInProgress is returned while the original request is still being processed.
+	ErrIdempotencyKeyInProgress = errors.New("request with this idempotency key is still in progress")
+)
+
+type IdempotencyService interface {
+	Begin(ctx context.Context, userID uint, key, requestHash string) (*domain.IdempotencyKey, error)
+	Complete(ctx context.Context, userID uint, key string, statusCode int, body []byte) error
+	Release(ctx context.Context, userID uint, key string) error
+	Cleanup(ctx context.Context) (int64, error)
+}
+
+type idempotencyService struct {
+	repo repositories.IdempotencyRepository
+	ttl  time.Duration
+	now  func() time.Time
+}
+
+func NewIdempotencyService(repo repositories.IdempotencyRepository, ttl time.Duration) IdempotencyService {
+	return &idempotencyService{repo: repo, ttl: ttl, now: time.Now}
+}
+
+// Begin reserves the key for a new request. If the key was already used for the same
+// request and its response is stored, the stored record is returned so that it can be
+// replayed; a nil record means the caller should process the request and then call
+// Complete or Release.
+func (s *idempotencyService) Begin(ctx context.Context, userID uint, key, requestHash string) (*domain.IdempotencyKey, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Begin")
+	defer span.End()
+
+	for {
+		reserved, err := s.repo.Reserve(ctx, &domain.IdempotencyKey{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: requestHash,
+			CreatedAt:   s.now(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if reserved {
+			return nil, nil
+		}
+
+		existing, err := s.repo.Get(ctx, userID, key)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			// Released or cleaned up between the insert and the lookup.
+			continue
+		}
+
+		if s.expired(existing) {
+			if err := s.repo.Delete(ctx, userID, key); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if existing.RequestHash != requestHash {
+			return nil, ErrIdempotencyKeyReused
+		}
+		if !existing.Completed() {
+			return nil, ErrIdempotencyKeyInProgress
+		}
+		return existing, nil
+	}
+}
+
+func (s *idempotencyService) Complete(ctx context.Context, userID uint, key string, statusCode int, body []byte) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Complete")
+	defer span.End()
+
+	return s.repo.SaveResponse(ctx, userID, key, statusCode, body)
+}
+
+// Release forgets the key so the request can be retried, e.g. after an internal error.
+func (s *idempotencyService) Release(ctx context.Context, userID uint, key string) error {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Release")
+	defer span.End()
+
+	return s.repo.Delete(ctx, userID, key)
+}
+
+// Cleanup removes keys older than the retention window.
+func (s *idempotencyService) Cleanup(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Start(ctx, "IdempotencyService.Cleanup")
+	defer span.End()
+
+	return s.repo.DeleteExpired(ctx, s.now().Add(-s.ttl))
+}
+
+func (s *idempotencyService) expired(key *domain.IdempotencyKey) bool {
+	return key.CreatedAt.Before(s.now().Add(-s.ttl))
+}
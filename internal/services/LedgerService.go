@@ -0,0 +1,105 @@
+package services
+
+import (
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/tracing"
+	"context"
+)
+
+// ReconciliationReport lists inconsistencies between cached balances and the ledger.
+type ReconciliationReport struct {
+	Drifts                 []domain.BalanceDrift `json:"drifts"`
+	LedgerTotal            int                   `json:"ledgerTotal"`
+	UnbalancedTransactions []uint                `json:"unbalancedTransactions"`
+}
+
+// Consistent reports whether the ledger is balanced and matches every cached balance.
+func (r *ReconciliationReport) Consistent() bool {
+	return len(r.Drifts) == 0 && r.LedgerTotal == 0 && len(r.UnbalancedTransactions) == 0
+}
+
+type LedgerService interface {
+	OpenMissingAccounts(ctx context.Context) (int, error)
+	Reconcile(ctx context.Context) (*ReconciliationReport, error)
+}
+
+type ledgerService struct {
+	uow             repositories.UnitOfWork
+	transactionRepo repositories.TransactionRepository
+}
+
+func NewLedgerService(uow repositories.UnitOfWork, txRepo repositories.TransactionRepository) LedgerService {
+	return &ledgerService{uow: uow, transactionRepo: txRepo}
+}
+
+// OpenMissingAccounts opens ledger accounts for users created before the ledger existed,
+// issuing their current cached balance as the opening balance. Each account is checked
+// again under the user's lock, so an account opened meanwhile by a transfer or by another
+// instance is not credited twice; it returns how many accounts this call opened.
+func (s *ledgerService) OpenMissingAccounts(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.OpenMissingAccounts")
+	defer span.End()
+
+	ids, err := s.transactionRepo.GetUserIDsWithoutAccount(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	opened := 0
+	for _, id := range ids {
+		issued := false
+		err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+			users, err := repos.Users.LockUsersByIDs(ctx, []uint{id})
+			if err != nil {
+				return err
+			}
+			user, ok := users[id]
+			if !ok {
+				return nil
+			}
+			exists, err := repos.Transactions.HasUserAccount(ctx, id)
+			if err != nil || exists {
+				return err
+			}
+			if err := repos.Transactions.IssueCoins(ctx, id, user.Coins); err != nil {
+				return err
+			}
+			issued = true
+			return nil
+		})
+		if err != nil {
+			return opened, err
+		}
+		if issued {
+			opened++
+		}
+	}
+	return opened, nil
+}
+
+func (s *ledgerService) Reconcile(ctx context.Context) (*ReconciliationReport, error) {
+	ctx, span := tracing.Start(ctx, "LedgerService.Reconcile")
+	defer span.End()
+
+	drifts, err := s.transactionRepo.GetBalanceDrifts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := s.transactionRepo.GetLedgerTotal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	unbalanced, err := s.transactionRepo.GetUnbalancedTransactionIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReconciliationReport{
+		Drifts:                 drifts,
+		LedgerTotal:            total,
+		UnbalancedTransactions: unbalanced,
+	}, nil
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrTooManyLoginAttempts is matched by LoginLockedError.
+var ErrTooManyLoginAttempts = errors.New("too many failed login attempts")
+
+// LoginLockedError is returned while a username or an IP is locked out.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("%s, retry in %s", ErrTooManyLoginAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LoginLockedError) Is(target error) bool {
+	return target == ErrTooManyLoginAttempts
+}
+
+// LoginAttempts is the failed-login state of a username or an IP.
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// LoginAttemptStore keeps failed-login state by key.
+type LoginAttemptStore interface {
+	Get(key string) (LoginAttempts, bool)
+	Set(key string, attempts LoginAttempts)
+	Delete(key string)
+	// DeleteStale removes entries whose last failure happened before the given time.
+	DeleteStale(before time.Time) int
+}
+
+type memoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]LoginAttempts
+}
+
+// NewMemoryLoginAttemptStore returns a store that keeps the state in process memory.
+func NewMemoryLoginAttemptStore() LoginAttemptStore {
+	return &memoryLoginAttemptStore{attempts: make(map[string]LoginAttempts)}
+}
+
+func (s *memoryLoginAttemptStore) Get(key string) (LoginAttempts, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempts, ok := s.attempts[key]
+	return attempts, ok
+}
+
+func (s *memoryLoginAttemptStore) Set(key string, attempts LoginAttempts) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts[key] = attempts
+}
+
+func (s *memoryLoginAttemptStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+}
+
+func (s *memoryLoginAttemptStore) DeleteStale(before time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := 0
+	for key, attempts := range s.attempts {
+		if attempts.LastFailure.Before(before) {
+			delete(s.attempts, key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// LoginThrottlePolicy configures the lockout. After UserAttempts failures for a username
+// (or IPAttempts for an IP) every further failure locks it for BaseLockout, doubling with
+// each failure up to MaxLockout. Failures are forgotten ResetAfter the last one.
+type LoginThrottlePolicy struct {
+	UserAttempts int
+	IPAttempts   int
+	BaseLockout  time.Duration
+	MaxLockout   time.Duration
+	ResetAfter   time.Duration
+}
+
+// DefaultLoginThrottlePolicy is used for zero fields of the policy passed to NewLoginThrottler.
+var DefaultLoginThrottlePolicy = LoginThrottlePolicy{
+	UserAttempts: 5,
+	IPAttempts:   20,
+	BaseLockout:  30 * time.Second,
+	MaxLockout:   15 * time.Minute,
+	ResetAfter:   time.Hour,
+}
+
+// LoginThrottler tracks failed logins per username and per IP.
+type LoginThrottler interface {
+	// Reserve returns a LoginLockedError if the username or the IP is locked out.
+	// Otherwise it counts the attempt as failed before the password is checked, so
+	// parallel guesses can not all get through before any of them is counted.
+	Reserve(username, ip string) (*LoginReservation, error)
+	// Failed records the lockouts started by a failed attempt.
+	Failed(ctx context.Context, reservation *LoginReservation) error
+	// Succeeded forgets failed logins of the username and takes back the attempt
+	// counted for the IP.
+	Succeeded(reservation *LoginReservation)
+	// Release takes back an attempt whose password was never checked.
+	Release(reservation *LoginReservation)
+	// Prune drops state that no longer affects lockouts.
+	Prune() int
+}
+
+// LoginReservation is a login attempt counted by Reserve.
+type LoginReservation struct {
+	attempts []reservedAttempt
+}
+
+// reservedAttempt is the failure counted for one key. Username and IP identify the key
+// in security events.
+type reservedAttempt struct {
+	key          string
+	username     string
+	ip           string
+	lockout      time.Duration
+	lockedBefore time.Time
+}
+
+type loginThrottler struct {
+	mu        sync.Mutex
+	store     LoginAttemptStore
+	eventRepo repositories.SecurityEventRepository
+	policy    LoginThrottlePolicy
+	now       func() time.Time
+}
+
+// NewLoginThrottler creates a throttler. Lockouts are recorded with eventRepo.
+func NewLoginThrottler(
+	store LoginAttemptStore,
+	eventRepo repositories.SecurityEventRepository,
+	policy LoginThrottlePolicy,
+	now func() time.Time,
+) LoginThrottler {
+	if policy.UserAttempts <= 0 {
+		policy.UserAttempts = DefaultLoginThrottlePolicy.UserAttempts
+	}
+	if policy.IPAttempts <= 0 {
+		policy.IPAttempts = DefaultLoginThrottlePolicy.IPAttempts
+	}
+	if policy.BaseLockout <= 0 {
+		policy.BaseLockout = DefaultLoginThrottlePolicy.BaseLockout
+	}
+	if policy.MaxLockout <= 0 {
+		policy.MaxLockout = DefaultLoginThrottlePolicy.MaxLockout
+	}
+	if policy.ResetAfter <= 0 {
+		policy.ResetAfter = DefaultLoginThrottlePolicy.ResetAfter
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &loginThrottler{store: store, eventRepo: eventRepo, policy: policy, now: now}
+}
+
+func (t *loginThrottler) Reserve(username, ip string) (*LoginReservation, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	var retryAfter time.Duration
+	for _, key := range t.keys(username, ip) {
+		attempts, ok := t.store.Get(key)
+		if ok && attempts.LockedUntil.After(now) && attempts.LockedUntil.Sub(now) > retryAfter {
+			retryAfter = attempts.LockedUntil.Sub(now)
+		}
+	}
+	if retryAfter > 0 {
+		return nil, &LoginLockedError{RetryAfter: retryAfter}
+	}
+
+	reservation := &LoginReservation{}
+	reservation.attempts = append(reservation.attempts,
+		t.fail(reservedAttempt{key: userKey(username), username: username}, t.policy.UserAttempts, now))
+	if ip != "" {
+		reservation.attempts = append(reservation.attempts,
+			t.fail(reservedAttempt{key: ipKey(ip), ip: ip}, t.policy.IPAttempts, now))
+	}
+	return reservation, nil
+}
+
+func (t *loginThrottler) Failed(ctx context.Context, reservation *LoginReservation) error {
+	var errs []error
+	for _, attempt := range reservation.attempts {
+		if attempt.lockout > 0 {
+			errs = append(errs, t.recordLockout(ctx, attempt.username, attempt.ip, attempt.lockout))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *loginThrottler) Succeeded(reservation *LoginReservation) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, attempt := range reservation.attempts {
+		if attempt.username != "" {
+			t.store.Delete(attempt.key)
+		} else {
+			t.release(attempt)
+		}
+	}
+}
+
+func (t *loginThrottler) Release(reservation *LoginReservation) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, attempt := range reservation.attempts {
+		t.release(attempt)
+	}
+}
+
+func (t *loginThrottler) Prune() int {
+	// A lockout never outlives MaxLockout after the last failure.
+	keep := t.policy.ResetAfter
+	if t.policy.MaxLockout > keep {
+		keep = t.policy.MaxLockout
+	}
+	return t.store.DeleteStale(t.now().Add(-keep))
+}
+
+// fail counts a failure for the key of the attempt and notes the lockout it starts, if
+// any. Must be called with t.mu held.
+func (t *loginThrottler) fail(attempt reservedAttempt, freeAttempts int, now time.Time) reservedAttempt {
+	attempts, _ := t.store.Get(attempt.key)
+	if now.Sub(attempts.LastFailure) > t.policy.ResetAfter {
+		attempts = LoginAttempts{}
+	}
+	attempt.lockedBefore = attempts.LockedUntil
+
+	attempts.Failures++
+	attempts.LastFailure = now
+
+	if over := attempts.Failures - freeAttempts; over > 0 {
+		lockout := t.policy.BaseLockout
+		for i := 1; i < over && lockout < t.policy.MaxLockout; i++ {
+			lockout *= 2
+		}
+		if lockout > t.policy.MaxLockout {
+			lockout = t.policy.MaxLockout
+		}
+		attempts.LockedUntil = now.Add(lockout)
+		attempt.lockout = lockout
+	}
+
+	t.store.Set(attempt.key, attempts)
+	return attempt
+}
+
+// release takes back the failure counted for the attempt and the lockout it started.
+// Must be called with t.mu held.
+func (t *loginThrottler) release(attempt reservedAttempt) {
+	attempts, ok := t.store.Get(attempt.key)
+	if !ok {
+		return
+	}
+	if attempts.Failures > 0 {
+		attempts.Failures--
+	}
+	if attempt.lockout > 0 {
+		attempts.LockedUntil = attempt.lockedBefore
+	}
+	t.store.Set(attempt.key, attempts)
+}
+
+func (t *loginThrottler) recordLockout(ctx context.Context, username, ip string, lockout time.Duration) error {
+	if t.eventRepo == nil {
+		return nil
+	}
+	return t.eventRepo.CreateEvent(ctx, &domain.SecurityEvent{
+		Type:      domain.SecurityEventLoginLockout,
+		Username:  username,
+		IP:        ip,
+		Details:   fmt.Sprintf("locked for %s", lockout),
+		CreatedAt: t.now(),
+	})
+}
+
+func (t *loginThrottler) keys(username, ip string) []string {
+	if ip == "" {
+		return []string{userKey(username)}
+	}
+	return []string{userKey(username), ipKey(ip)}
+}
+
+func userKey(username string) string {
+	return "user:" + username
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
@@ -2,95 +2,398 @@ package services
 
 import (
 	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/metrics"
 	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/tracing"
+	"context"
+	"errors"
 	"fmt"
-	"gorm.io/gorm"
+	"sort"
 )
 
+var (
+	// ErrMerchItemNotFound is returned when the requested merch item does not exist.
+	ErrMerchItemNotFound = errors.New("merch item not found")
+	// ErrMerchItemExists is returned when adding an item that is already on sale.
+	ErrMerchItemExists = errors.New("merch item already exists")
+	// ErrInvalidMerchItem is returned when an item has an empty type, a non-positive price
+	// or a negative stock.
+	ErrInvalidMerchItem = errors.New("merch item must have a type, a positive price and a non-negative stock")
+	// ErrOutOfStock is returned when a stock-limited item is sold out.
+	ErrOutOfStock = errors.New("merch item is out of stock")
+	// ErrInvalidQuantity is returned when a purchase line or a cart item has a quantity
+	// outside 1..MaxPurchaseQuantity.
+	ErrInvalidQuantity = fmt.Errorf("quantity must be between 1 and %d", MaxPurchaseQuantity)
+	// ErrEmptyPurchase is returned when there is nothing to buy.
+	ErrEmptyPurchase = errors.New("nothing to buy")
+)
+
+// MaxPurchaseQuantity is the most pieces of one item that can be bought at once or
+// kept in the cart.
+const MaxPurchaseQuantity = 1000
+
+// PurchaseLine is a merch item and the number of pieces to buy.
+type PurchaseLine struct {
+	ItemType string
+	Quantity int
+}
+
+// CatalogItem describes a merch item available in the shop.
+// Stock is omitted for items with unlimited stock.
+// swagger:model CatalogItem
+type CatalogItem struct {
+	Type       string `json:"type"`
+	Price      int    `json:"price"`
+	Affordable bool   `json:"affordable"`
+	InStock    bool   `json:"inStock"`
+	Stock      *int   `json:"stock,omitempty"`
+}
+
+// CatalogResponse is the shop catalog as seen by a particular user.
+// swagger:model CatalogResponse
+type CatalogResponse struct {
+	Coins int           `json:"coins"`
+	Items []CatalogItem `json:"items"`
+}
+
 type MerchService interface {
-	BuyItem(userID uint, itemType string) error
+	BuyItem(ctx context.Context, userID uint, itemType string) error
+	BuyItems(ctx context.Context, userID uint, lines []PurchaseLine) (int, error)
+	GetCatalog(ctx context.Context, userID uint) (*CatalogResponse, error)
+	GetCatalogItem(ctx context.Context, userID uint, itemType string) (*CatalogItem, error)
+	CreateItem(ctx context.Context, itemType string, price int, stock *int) error
+	UpdateItemPrice(ctx context.Context, itemType string, price int) error
+	SetItemStock(ctx context.Context, itemType string, stock *int) error
+	RetireItem(ctx context.Context, itemType string) error
 }
 
 type merchService struct {
 	merchRepo repositories.MerchRepository
 	userRepo  repositories.UserRepository
-	txRepo    repositories.TransactionRepository
-	invRepo   repositories.InventoryRepository
-	db        *gorm.DB
+	uow       repositories.UnitOfWork
 }
 
 func NewMerchService(
 	merchRepo repositories.MerchRepository,
 	userRepo repositories.UserRepository,
-	txRepo repositories.TransactionRepository,
-	invRepo repositories.InventoryRepository,
-	db *gorm.DB,
+	uow repositories.UnitOfWork,
 ) MerchService {
 	return &merchService{
 		merchRepo: merchRepo,
 		userRepo:  userRepo,
-		txRepo:    txRepo,
-		invRepo:   invRepo,
-		db:        db}
+		uow:       uow,
+	}
 }
 
-func (m *merchService) BuyItem(userID uint, itemType string) error {
-	return m.db.Transaction(func(tx *gorm.DB) error {
-		merchItem, err := m.merchRepo.GetMerchItemByType(itemType)
+func (m *merchService) GetCatalog(ctx context.Context, userID uint) (*CatalogResponse, error) {
+	ctx, span := tracing.Start(ctx, "MerchService.GetCatalog")
+	defer span.End()
+
+	user, err := m.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	merchItems, err := m.merchRepo.GetAllMerchItems(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]CatalogItem, 0, len(merchItems))
+	for i := range merchItems {
+		items = append(items, newCatalogItem(&merchItems[i], user))
+	}
+
+	return &CatalogResponse{
+		Coins: user.Coins,
+		Items: items,
+	}, nil
+}
+
+func (m *merchService) GetCatalogItem(ctx context.Context, userID uint, itemType string) (*CatalogItem, error) {
+	ctx, span := tracing.Start(ctx, "MerchService.GetCatalogItem")
+	defer span.End()
+
+	user, err := m.getUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	merchItem, err := m.merchRepo.GetMerchItemByType(ctx, itemType)
+	if err != nil {
+		return nil, err
+	}
+	if merchItem == nil {
+		return nil, ErrMerchItemNotFound
+	}
+
+	item := newCatalogItem(merchItem, user)
+	return &item, nil
+}
+
+// CreateItem puts a new item on sale. A previously retired item with the same type is
+// brought back with the new price.
+func (m *merchService) CreateItem(ctx context.Context, itemType string, price int, stock *int) error {
+	ctx, span := tracing.Start(ctx, "MerchService.CreateItem")
+	defer span.End()
+
+	if itemType == "" || price <= 0 || (stock != nil && *stock < 0) {
+		return ErrInvalidMerchItem
+	}
+
+	existing, err := m.merchRepo.GetMerchItemByType(ctx, itemType)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrMerchItemExists
+	}
+
+	item := &domain.MerchItem{ItemType: itemType, Price: price, Stock: stock}
+	restored, err := m.merchRepo.RestoreMerchItem(ctx, item)
+	if err != nil || restored {
+		return err
+	}
+	return m.merchRepo.CreateMerchItem(ctx, item)
+}
+
+func (m *merchService) UpdateItemPrice(ctx context.Context, itemType string, price int) error {
+	ctx, span := tracing.Start(ctx, "MerchService.UpdateItemPrice")
+	defer span.End()
+
+	if price <= 0 {
+		return ErrInvalidMerchItem
+	}
+
+	item, err := m.merchRepo.GetMerchItemByType(ctx, itemType)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return ErrMerchItemNotFound
+	}
+
+	item.Price = price
+	return m.merchRepo.UpdateMerchItem(ctx, item)
+}
+
+// SetItemStock sets the number of items left; nil makes the stock unlimited.
+func (m *merchService) SetItemStock(ctx context.Context, itemType string, stock *int) error {
+	ctx, span := tracing.Start(ctx, "MerchService.SetItemStock")
+	defer span.End()
+
+	if stock != nil && *stock < 0 {
+		return ErrInvalidMerchItem
+	}
+
+	item, err := m.merchRepo.GetMerchItemByType(ctx, itemType)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return ErrMerchItemNotFound
+	}
+
+	return m.merchRepo.SetStock(ctx, itemType, stock)
+}
+
+// RetireItem takes the item off sale. The item is soft-deleted, so inventories and
+// purchase history that mention it stay valid.
+func (m *merchService) RetireItem(ctx context.Context, itemType string) error {
+	ctx, span := tracing.Start(ctx, "MerchService.RetireItem")
+	defer span.End()
+
+	item, err := m.merchRepo.GetMerchItemByType(ctx, itemType)
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return ErrMerchItemNotFound
+	}
+
+	return m.merchRepo.DeleteMerchItem(ctx, itemType)
+}
+
+func (m *merchService) getUser(ctx context.Context, userID uint) (*domain.User, error) {
+	user, err := m.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("user %d not found", userID)
+	}
+	return user, nil
+}
+
+func newCatalogItem(item *domain.MerchItem, user *domain.User) CatalogItem {
+	return CatalogItem{
+		Type:       item.ItemType,
+		Price:      item.Price,
+		Affordable: user.Coins >= item.Price,
+		InStock:    item.Stock == nil || *item.Stock > 0,
+		Stock:      item.Stock,
+	}
+}
+
+func (m *merchService) BuyItem(ctx context.Context, userID uint, itemType string) error {
+	_, err := m.BuyItems(ctx, userID, []PurchaseLine{{ItemType: itemType, Quantity: 1}})
+	return err
+}
+
+// BuyItems buys every line in a single database transaction and returns the total price.
+// Either all items are bought or, if any line fails, none of them.
+func (m *merchService) BuyItems(ctx context.Context, userID uint, lines []PurchaseLine) (int, error) {
+	ctx, span := tracing.Start(ctx, "MerchService.BuyItems")
+	defer span.End()
+
+	var total int
+	err := m.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		var err error
+		total, err = purchase(ctx, repos, userID, lines)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	observePurchase(lines)
+	return total, nil
+}
+
+// purchase buys the lines using repositories bound to an open transaction. Coins are
+// debited once for the whole order; every line gets its own purchase transaction.
+func purchase(ctx context.Context, repos *repositories.Repositories, userID uint, lines []PurchaseLine) (int, error) {
+	lines, err := mergePurchaseLines(lines)
+	if err != nil {
+		return 0, err
+	}
+
+	merchItems := make([]*domain.MerchItem, len(lines))
+	costs := make([]int, len(lines))
+	total := 0
+	for i, line := range lines {
+		merchItem, err := repos.Merch.GetMerchItemByType(ctx, line.ItemType)
 		if err != nil {
-			return err
+			return 0, err
 		}
 		if merchItem == nil {
-			return fmt.Errorf("merch item '%s' not found", itemType)
+			return 0, fmt.Errorf("%w: '%s'", ErrMerchItemNotFound, line.ItemType)
 		}
-
-		user, err := m.userRepo.GetUserByID(userID)
-		if err != nil {
-			return err
+		merchItems[i] = merchItem
+		cost, ok := mulCoins(merchItem.Price, line.Quantity)
+		if ok {
+			total, ok = addCoins(total, cost)
 		}
-		if user == nil {
-			return fmt.Errorf("user %d not found", userID)
+		if !ok {
+			return 0, ErrAmountTooLarge
 		}
+		costs[i] = cost
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("%w: purchase total is %d", ErrInvalidAmount, total)
+	}
 
-		if user.Coins < merchItem.Price {
-			return fmt.Errorf("user %d does not have enough coins", userID)
-		}
+	users, err := repos.Users.LockUsersByIDs(ctx, []uint{userID})
+	if err != nil {
+		return 0, err
+	}
+	user, ok := users[userID]
+	if !ok {
+		return 0, fmt.Errorf("user %d not found", userID)
+	}
 
-		user.Coins -= merchItem.Price
-		if err := m.userRepo.UpdateUser(user); err != nil {
-			return err
-		}
+	if user.Coins < total {
+		return 0, notEnoughCoins(userID)
+	}
 
-		invItem, err := m.invRepo.GetByUserAndType(userID, itemType)
-		if err != nil {
-			return err
+	for i, line := range lines {
+		if merchItems[i].Stock == nil {
+			continue
 		}
-		if invItem == nil {
-			invItem = &domain.InventoryItem{
-				ItemType: itemType,
-				UserID:   userID,
-				Quantity: 1,
-			}
-			if err := m.invRepo.CreateItem(invItem); err != nil {
-				return err
-			}
-		} else {
-			invItem.Quantity++
-			if err := m.invRepo.UpdateItem(invItem); err != nil {
-				return err
+		if err := repos.Merch.DecrementStock(ctx, line.ItemType, line.Quantity); err != nil {
+			if errors.Is(err, repositories.ErrOutOfStock) {
+				return 0, ErrOutOfStock
 			}
+			return 0, err
+		}
+	}
+
+	if err := repos.Users.ChangeCoins(ctx, userID, -total); err != nil {
+		if errors.Is(err, repositories.ErrInsufficientCoins) {
+			return 0, notEnoughCoins(userID)
+		}
+		return 0, err
+	}
+
+	for i, line := range lines {
+		if err := addToInventory(ctx, repos, userID, line); err != nil {
+			return 0, err
 		}
 
 		txItem := &domain.Transaction{
 			FromUserID: userID,
-			Amount:     merchItem.Price,
+			Amount:     costs[i],
 			Type:       domain.Purchase,
+			ItemType:   line.ItemType,
+			Quantity:   line.Quantity,
 			ToUserID:   nil,
 		}
-		if err := m.txRepo.CreateTransaction(txItem); err != nil {
-			return err
+		if err := repos.Transactions.CreateTransaction(ctx, txItem); err != nil {
+			return 0, err
+		}
+	}
+
+	return total, nil
+}
+
+func addToInventory(ctx context.Context, repos *repositories.Repositories, userID uint, line PurchaseLine) error {
+	invItem, err := repos.Inventory.GetByUserAndType(ctx, userID, line.ItemType)
+	if err != nil {
+		return err
+	}
+	if invItem == nil {
+		invItem = &domain.InventoryItem{
+			ItemType: line.ItemType,
+			UserID:   userID,
+			Quantity: line.Quantity,
+		}
+		return repos.Inventory.CreateItem(ctx, invItem)
+	}
+
+	invItem.Quantity += line.Quantity
+	return repos.Inventory.UpdateItem(ctx, invItem)
+}
+
+// mergePurchaseLines validates the lines, sums up repeated items and sorts the result by
+// item type, so stock rows are always locked in the same order.
+func mergePurchaseLines(lines []PurchaseLine) ([]PurchaseLine, error) {
+	if len(lines) == 0 {
+		return nil, ErrEmptyPurchase
+	}
+
+	quantities := make(map[string]int, len(lines))
+	for _, line := range lines {
+		if line.Quantity <= 0 || line.Quantity > MaxPurchaseQuantity {
+			return nil, ErrInvalidQuantity
+		}
+		quantities[line.ItemType] += line.Quantity
+		if quantities[line.ItemType] > MaxPurchaseQuantity {
+			return nil, ErrInvalidQuantity
 		}
+	}
 
-		return nil
+	merged := make([]PurchaseLine, 0, len(quantities))
+	for itemType, quantity := range quantities {
+		merged = append(merged, PurchaseLine{ItemType: itemType, Quantity: quantity})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].ItemType < merged[j].ItemType
 	})
+	return merged, nil
+}
+
+// observePurchase records the items of a completed purchase in the metrics.
+func observePurchase(lines []PurchaseLine) {
+	for _, line := range lines {
+		metrics.ItemsPurchased(line.ItemType, line.Quantity)
+	}
 }
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/logging"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+var (
+	// ErrTransactionNotFound is returned for unknown transactions and, on refunds,
+	// for purchases of other users.
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrNotReversible is returned when reversing anything but a transfer.
+	ErrNotReversible = errors.New("only transfers can be reversed")
+	// ErrNotRefundable is returned when refunding anything but a purchase.
+	ErrNotRefundable = errors.New("only purchases can be refunded")
+	// ErrAlreadyReversed is returned when the transaction was already reversed or refunded.
+	ErrAlreadyReversed = errors.New("transaction was already reversed")
+	// ErrReversalInsufficientFunds is returned when the recipient of a transfer no longer
+	// has the coins and the reversal is not forced.
+	ErrReversalInsufficientFunds = errors.New("recipient does not have enough coins to reverse the transfer")
+	// ErrRefundWindowExpired is returned when the purchase is older than the refund window.
+	ErrRefundWindowExpired = errors.New("refund window has expired")
+	// ErrRefundItemsMissing is returned when the buyer no longer has the purchased items.
+	ErrRefundItemsMissing = errors.New("purchased items are no longer in the inventory")
+)
+
+// ReversalInfo describes the compensating transaction created by a reversal or refund.
+// swagger:model ReversalInfo
+type ReversalInfo struct {
+	TransactionID uint      `json:"transactionId"`
+	ReversalOf    uint      `json:"reversalOf"`
+	Type          string    `json:"type"`
+	Amount        int       `json:"amount"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// ReversalService undoes transactions with compensating transactions; the original
+// transaction is never changed.
+type ReversalService interface {
+	// ReverseTransfer moves the coins of a transfer back to its sender. Unless force is
+	// set it fails when the recipient has spent them; a forced reversal may leave the
+	// recipient with a negative balance.
+	ReverseTransfer(ctx context.Context, transactionID uint, force bool, reason string) (*ReversalInfo, error)
+	// RefundPurchase returns a purchase of the user to the shop within the refund window.
+	RefundPurchase(ctx context.Context, userID, transactionID uint) (*ReversalInfo, error)
+}
+
+type reversalService struct {
+	uow          repositories.UnitOfWork
+	refundWindow time.Duration
+	log          *slog.Logger
+	now          func() time.Time
+}
+
+// NewReversalService creates the service. A nil logger discards logs and a nil now
+// means time.Now.
+func NewReversalService(uow repositories.UnitOfWork, refundWindow time.Duration, logger *slog.Logger, now func() time.Time) ReversalService {
+	if now == nil {
+		now = time.Now
+	}
+	return &reversalService{uow: uow, refundWindow: refundWindow, log: logging.OrDiscard(logger), now: now}
+}
+
+func (s *reversalService) ReverseTransfer(ctx context.Context, transactionID uint, force bool, reason string) (*ReversalInfo, error) {
+	ctx, span := tracing.Start(ctx, "ReversalService.ReverseTransfer")
+	defer span.End()
+
+	note, err := TransferNote{Message: reason}.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	var reversal *domain.Transaction
+	err = s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		original, err := loadTransaction(ctx, repos, transactionID)
+		if err != nil {
+			return err
+		}
+		if original.Type != domain.Transfer || original.ToUserID == nil {
+			return ErrNotReversible
+		}
+		if err := ensureNotReversed(ctx, repos, original.ID); err != nil {
+			return err
+		}
+		sender, recipient := original.FromUserID, *original.ToUserID
+
+		users, err := repos.Users.LockUsersByIDs(ctx, []uint{sender, recipient})
+		if err != nil {
+			return err
+		}
+		if _, ok := users[sender]; !ok {
+			return fmt.Errorf("user %d not found", sender)
+		}
+		holder, ok := users[recipient]
+		if !ok {
+			return fmt.Errorf("user %d not found", recipient)
+		}
+
+		if force {
+			err = repos.Users.ForceChangeCoins(ctx, recipient, -original.Amount)
+		} else if holder.Coins < original.Amount {
+			return ErrReversalInsufficientFunds
+		} else {
+			err = repos.Users.ChangeCoins(ctx, recipient, -original.Amount)
+		}
+		if errors.Is(err, repositories.ErrInsufficientCoins) {
+			return ErrReversalInsufficientFunds
+		}
+		if err != nil {
+			return err
+		}
+		if err := repos.Users.ChangeCoins(ctx, sender, original.Amount); err != nil {
+			return err
+		}
+
+		reversal = &domain.Transaction{
+			FromUserID:   recipient,
+			ToUserID:     &sender,
+			Amount:       original.Amount,
+			Type:         domain.Reversal,
+			Message:      note.Message,
+			Category:     original.Category,
+			ReversalOfID: &original.ID,
+		}
+		return repos.Transactions.CreateTransaction(ctx, reversal)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.log.InfoContext(ctx, "transfer reversed", "transaction_id", transactionID, "reversal_id", reversal.ID,
+		"amount", reversal.Amount, "forced", force)
+	return reversalInfo(reversal), nil
+}
+
+func (s *reversalService) RefundPurchase(ctx context.Context, userID, transactionID uint) (*ReversalInfo, error) {
+	ctx, span := tracing.Start(ctx, "ReversalService.RefundPurchase")
+	defer span.End()
+
+	var refund *domain.Transaction
+	err := s.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		original, err := loadTransaction(ctx, repos, transactionID)
+		if err != nil {
+			return err
+		}
+		if original.FromUserID != userID {
+			return ErrTransactionNotFound
+		}
+		if original.Type != domain.Purchase {
+			return ErrNotRefundable
+		}
+		if err := ensureNotReversed(ctx, repos, original.ID); err != nil {
+			return err
+		}
+		if s.now().Sub(original.CreatedAt) > s.refundWindow {
+			return ErrRefundWindowExpired
+		}
+
+		// The buyer's row is locked first, as in purchase, so a refund and a purchase
+		// of the same user never interleave.
+		users, err := repos.Users.LockUsersByIDs(ctx, []uint{userID})
+		if err != nil {
+			return err
+		}
+		if _, ok := users[userID]; !ok {
+			return fmt.Errorf("user %d not found", userID)
+		}
+
+		item, err := repos.Inventory.GetByUserAndType(ctx, userID, original.ItemType)
+		if err != nil {
+			return err
+		}
+		if item == nil || item.Quantity < original.Quantity {
+			return ErrRefundItemsMissing
+		}
+		item.Quantity -= original.Quantity
+		if item.Quantity == 0 {
+			err = repos.Inventory.DeleteItem(ctx, item)
+		} else {
+			err = repos.Inventory.UpdateItem(ctx, item)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := repos.Merch.IncrementStock(ctx, original.ItemType, original.Quantity); err != nil {
+			return err
+		}
+		if err := repos.Users.ChangeCoins(ctx, userID, original.Amount); err != nil {
+			return err
+		}
+
+		refund = &domain.Transaction{
+			FromUserID:   userID,
+			Amount:       original.Amount,
+			Type:         domain.Refund,
+			ItemType:     original.ItemType,
+			Quantity:     original.Quantity,
+			ReversalOfID: &original.ID,
+		}
+		return repos.Transactions.CreateTransaction(ctx, refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.log.InfoContext(ctx, "purchase refunded", "user_id", userID, "transaction_id", transactionID,
+		"refund_id", refund.ID, "amount", refund.Amount)
+	return reversalInfo(refund), nil
+}
+
+func loadTransaction(ctx context.Context, repos *repositories.Repositories, transactionID uint) (*domain.Transaction, error) {
+	original, err := repos.Transactions.GetTransactionByID(ctx, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if original == nil {
+		return nil, ErrTransactionNotFound
+	}
+	return original, nil
+}
+
+// ensureNotReversed fails if the transaction was already undone. A concurrent reversal
+// that slips past the check is stopped by the unique index on reversal_of_id.
+func ensureNotReversed(ctx context.Context, repos *repositories.Repositories, transactionID uint) error {
+	existing, err := repos.Transactions.GetReversalOf(ctx, transactionID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrAlreadyReversed
+	}
+	return nil
+}
+
+func reversalInfo(tx *domain.Transaction) *ReversalInfo {
+	return &ReversalInfo{
+		TransactionID: tx.ID,
+		ReversalOf:    *tx.ReversalOfID,
+		Type:          string(tx.Type),
+		Amount:        tx.Amount,
+		CreatedAt:     tx.CreatedAt,
+	}
+}
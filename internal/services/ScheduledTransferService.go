@@ -0,0 +1,353 @@
+package services
+
+import (
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/logging"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/schedule"
+	"avito-tech-go/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	// scheduledTransferBatch is how many due transfers one scheduler tick executes.
+	scheduledTransferBatch = 100
+	// scheduledRunsShown is how many recent runs are returned with a scheduled transfer.
+	scheduledRunsShown = 10
+)
+
+var (
+	// ErrScheduledTransferNotFound is returned for unknown transfers and transfers of other users.
+	ErrScheduledTransferNotFound = errors.New("scheduled transfer not found")
+	// ErrInvalidSchedule is returned when a transfer has neither or both of runAt and
+	// schedule, a runAt in the past, or a cron expression that does not parse.
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	// ErrScheduledTransferRunning is returned when a transfer runs while it is being changed.
+	ErrScheduledTransferRunning = errors.New("scheduled transfer ran while being changed, try again")
+)
+
+// ScheduledTransferRequest describes a scheduled transfer. Exactly one of RunAt
+// (a one-shot transfer) and Schedule (a cron expression) must be set.
+type ScheduledTransferRequest struct {
+	ToUserID uint
+	Amount   int
+	Note     TransferNote
+	RunAt    *time.Time
+	Schedule string
+}
+
+// ScheduledTransferRunInfo is the outcome of one execution.
+// swagger:model ScheduledTransferRunInfo
+type ScheduledTransferRunInfo struct {
+	ScheduledFor time.Time `json:"scheduledFor"`
+	Success      bool      `json:"success"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// ScheduledTransferInfo is a scheduled transfer as shown to its owner.
+// swagger:model ScheduledTransferInfo
+type ScheduledTransferInfo struct {
+	ID        uint                       `json:"id"`
+	ToUser    string                     `json:"toUser"`
+	Amount    int                        `json:"amount"`
+	Message   string                     `json:"message,omitempty"`
+	Category  string                     `json:"category,omitempty"`
+	Schedule  string                     `json:"schedule,omitempty"`
+	Active    bool                       `json:"active"`
+	NextRunAt *time.Time                 `json:"nextRunAt,omitempty"`
+	LastRunAt *time.Time                 `json:"lastRunAt,omitempty"`
+	LastError string                     `json:"lastError,omitempty"`
+	Runs      []ScheduledTransferRunInfo `json:"runs,omitempty"`
+}
+
+// ScheduledTransferService manages transfers the server makes on behalf of their owner
+// and executes the ones that are due.
+type ScheduledTransferService interface {
+	Create(ctx context.Context, ownerID uint, req ScheduledTransferRequest) (*ScheduledTransferInfo, error)
+	List(ctx context.Context, ownerID uint) ([]ScheduledTransferInfo, error)
+	Get(ctx context.Context, ownerID, id uint) (*ScheduledTransferInfo, error)
+	Update(ctx context.Context, ownerID, id uint, req ScheduledTransferRequest) (*ScheduledTransferInfo, error)
+	Delete(ctx context.Context, ownerID, id uint) error
+	RunDue(ctx context.Context) (int, error)
+}
+
+type scheduledTransferService struct {
+	repo      repositories.ScheduledTransferRepository
+	userRepo  repositories.UserRepository
+	txService TransactionService
+	location  *time.Location
+	log       *slog.Logger
+	now       func() time.Time
+}
+
+// NewScheduledTransferService creates the service. Cron expressions are evaluated in
+// location, UTC when nil; a nil logger discards logs and a nil now means time.Now.
+func NewScheduledTransferService(
+	repo repositories.ScheduledTransferRepository,
+	userRepo repositories.UserRepository,
+	txService TransactionService,
+	location *time.Location,
+	logger *slog.Logger,
+	now func() time.Time,
+) ScheduledTransferService {
+	if location == nil {
+		location = time.UTC
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &scheduledTransferService{
+		repo:      repo,
+		userRepo:  userRepo,
+		txService: txService,
+		location:  location,
+		log:       logging.OrDiscard(logger),
+		now:       now,
+	}
+}
+
+func (s *scheduledTransferService) Create(ctx context.Context, ownerID uint, req ScheduledTransferRequest) (*ScheduledTransferInfo, error) {
+	ctx, span := tracing.Start(ctx, "ScheduledTransferService.Create")
+	defer span.End()
+
+	transfer := &domain.ScheduledTransfer{OwnerID: ownerID}
+	if err := s.apply(transfer, req); err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateScheduledTransfer(ctx, transfer); err != nil {
+		return nil, err
+	}
+	return s.describe(ctx, transfer, nil)
+}
+
+func (s *scheduledTransferService) List(ctx context.Context, ownerID uint) ([]ScheduledTransferInfo, error) {
+	ctx, span := tracing.Start(ctx, "ScheduledTransferService.List")
+	defer span.End()
+
+	transfers, err := s.repo.GetScheduledTransfersByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(transfers))
+	for _, t := range transfers {
+		ids = append(ids, t.ToUserID)
+	}
+	names, err := s.userRepo.GetUsernamesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]ScheduledTransferInfo, 0, len(transfers))
+	for i := range transfers {
+		infos = append(infos, scheduledTransferInfo(&transfers[i], names[transfers[i].ToUserID], nil))
+	}
+	return infos, nil
+}
+
+// Get returns the transfer together with its latest runs.
+func (s *scheduledTransferService) Get(ctx context.Context, ownerID, id uint) (*ScheduledTransferInfo, error) {
+	ctx, span := tracing.Start(ctx, "ScheduledTransferService.Get")
+	defer span.End()
+
+	transfer, err := s.owned(ctx, ownerID, id)
+	if err != nil {
+		return nil, err
+	}
+	runs, err := s.repo.GetScheduledRuns(ctx, transfer.ID, scheduledRunsShown)
+	if err != nil {
+		return nil, err
+	}
+	return s.describe(ctx, transfer, runs)
+}
+
+// Update replaces the transfer's settings and reactivates it.
+func (s *scheduledTransferService) Update(ctx context.Context, ownerID, id uint, req ScheduledTransferRequest) (*ScheduledTransferInfo, error) {
+	ctx, span := tracing.Start(ctx, "ScheduledTransferService.Update")
+	defer span.End()
+
+	transfer, err := s.owned(ctx, ownerID, id)
+	if err != nil {
+		return nil, err
+	}
+	prevNextRunAt := transfer.NextRunAt
+	if err := s.apply(transfer, req); err != nil {
+		return nil, err
+	}
+	updated, err := s.repo.UpdateScheduledTransfer(ctx, transfer, prevNextRunAt)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrScheduledTransferRunning
+	}
+	return s.describe(ctx, transfer, nil)
+}
+
+func (s *scheduledTransferService) Delete(ctx context.Context, ownerID, id uint) error {
+	ctx, span := tracing.Start(ctx, "ScheduledTransferService.Delete")
+	defer span.End()
+
+	transfer, err := s.owned(ctx, ownerID, id)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteScheduledTransfer(ctx, transfer.ID)
+}
+
+// RunDue executes every transfer that is due and returns how many ran, whether they
+// succeeded or not. Missed runs of a recurring transfer are not caught up: it runs
+// once and moves to its next time after now. Failures, such as not enough coins,
+// are recorded on the transfer and do not stop the others.
+func (s *scheduledTransferService) RunDue(ctx context.Context) (int, error) {
+	ctx, span := tracing.Start(ctx, "ScheduledTransferService.RunDue")
+	defer span.End()
+
+	now := s.now().UTC()
+	due, err := s.repo.GetDueScheduledTransfers(ctx, now, scheduledTransferBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	ran := 0
+	for i := range due {
+		transfer := &due[i]
+		scheduledFor := *transfer.NextRunAt
+
+		var next *time.Time
+		if transfer.Schedule != "" {
+			next, err = s.nextRun(transfer.Schedule, now)
+			if err != nil {
+				return ran, err
+			}
+		}
+
+		claimed, err := s.repo.ClaimScheduledRun(ctx, transfer.ID, scheduledFor, next)
+		if err != nil {
+			return ran, err
+		}
+		if !claimed {
+			continue
+		}
+
+		run := &domain.ScheduledTransferRun{ScheduledTransferID: transfer.ID, ScheduledFor: scheduledFor}
+		note := TransferNote{Message: transfer.Message, Category: transfer.Category}
+		if err := s.txService.TransferCoins(ctx, transfer.OwnerID, transfer.ToUserID, transfer.Amount, note); err != nil {
+			run.Error = truncate(err.Error(), 255)
+			s.log.WarnContext(ctx, "scheduled transfer failed",
+				"scheduled_transfer_id", transfer.ID, "user_id", transfer.OwnerID, "error", err)
+		}
+		if err := s.repo.RecordScheduledRun(ctx, run); err != nil {
+			return ran, err
+		}
+		ran++
+	}
+	return ran, nil
+}
+
+// apply validates req and copies it onto transfer, computing the first run.
+func (s *scheduledTransferService) apply(transfer *domain.ScheduledTransfer, req ScheduledTransferRequest) error {
+	if err := validateTransfer(transfer.OwnerID, req.ToUserID, req.Amount); err != nil {
+		return err
+	}
+	note, err := req.Note.normalize()
+	if err != nil {
+		return err
+	}
+
+	now := s.now().UTC()
+	var next *time.Time
+	switch {
+	case (req.RunAt == nil) == (req.Schedule == ""):
+		return fmt.Errorf("%w: exactly one of runAt and schedule must be set", ErrInvalidSchedule)
+	case req.RunAt != nil:
+		if !req.RunAt.After(now) {
+			return fmt.Errorf("%w: runAt must be in the future", ErrInvalidSchedule)
+		}
+		runAt := req.RunAt.UTC()
+		next = &runAt
+	default:
+		if next, err = s.nextRun(req.Schedule, now); err != nil {
+			return err
+		}
+	}
+
+	transfer.ToUserID = req.ToUserID
+	transfer.Amount = req.Amount
+	transfer.Message = note.Message
+	transfer.Category = note.Category
+	transfer.Schedule = req.Schedule
+	transfer.Active = true
+	transfer.NextRunAt = next
+	transfer.LastError = ""
+	return nil
+}
+
+// nextRun returns the first time after now matching the cron expression, in UTC.
+func (s *scheduledTransferService) nextRun(expr string, now time.Time) (*time.Time, error) {
+	cron, err := schedule.ParseCron(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	next := cron.Next(now.In(s.location))
+	if next.IsZero() {
+		return nil, fmt.Errorf("%w: schedule never runs", ErrInvalidSchedule)
+	}
+	next = next.UTC()
+	return &next, nil
+}
+
+func (s *scheduledTransferService) owned(ctx context.Context, ownerID, id uint) (*domain.ScheduledTransfer, error) {
+	transfer, err := s.repo.GetScheduledTransferByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if transfer == nil || transfer.OwnerID != ownerID {
+		return nil, ErrScheduledTransferNotFound
+	}
+	return transfer, nil
+}
+
+func (s *scheduledTransferService) describe(ctx context.Context, transfer *domain.ScheduledTransfer, runs []domain.ScheduledTransferRun) (*ScheduledTransferInfo, error) {
+	names, err := s.userRepo.GetUsernamesByIDs(ctx, []uint{transfer.ToUserID})
+	if err != nil {
+		return nil, err
+	}
+	info := scheduledTransferInfo(transfer, names[transfer.ToUserID], runs)
+	return &info, nil
+}
+
+func scheduledTransferInfo(transfer *domain.ScheduledTransfer, toUser string, runs []domain.ScheduledTransferRun) ScheduledTransferInfo {
+	info := ScheduledTransferInfo{
+		ID:        transfer.ID,
+		ToUser:    toUser,
+		Amount:    transfer.Amount,
+		Message:   transfer.Message,
+		Category:  transfer.Category,
+		Schedule:  transfer.Schedule,
+		Active:    transfer.Active,
+		NextRunAt: transfer.NextRunAt,
+		LastRunAt: transfer.LastRunAt,
+		LastError: transfer.LastError,
+	}
+	for _, run := range runs {
+		info.Runs = append(info.Runs, ScheduledTransferRunInfo{
+			ScheduledFor: run.ScheduledFor,
+			Success:      run.Error == "",
+			Error:        run.Error,
+		})
+	}
+	return info
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -2,85 +2,389 @@ package services
 
 import (
 	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/metrics"
 	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/tracing"
+	"context"
+	"errors"
 	"fmt"
-	"gorm.io/gorm"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+const (
+	// MaxBatchTransfers is the most recipients one batch transfer may have.
+	MaxBatchTransfers = 100
+	// MaxBatchTransferAmount is the largest amount of one line of a batch transfer.
+	MaxBatchTransferAmount = 1_000_000_000
+	// MaxTransferMessageLength is the longest transfer message, in characters.
+	MaxTransferMessageLength = 200
+	// MaxTransferCategoryLength is the longest transfer category.
+	MaxTransferCategoryLength = 32
+)
+
+var (
+	// ErrNotEnoughCoins is wrapped by errors of transfers and purchases the user can not afford.
+	ErrNotEnoughCoins = errors.New("does not have enough coins")
+	// ErrSelfTransfer is returned for transfers to the sender.
+	ErrSelfTransfer = errors.New("cannot transfer coins to yourself")
+	// ErrInvalidAmount is returned for non-positive transfer amounts.
+	ErrInvalidAmount = errors.New("amount must be greater than 0")
+
+	// ErrTransferMessageTooLong is returned for messages over MaxTransferMessageLength.
+	ErrTransferMessageTooLong = fmt.Errorf("message must be at most %d characters", MaxTransferMessageLength)
+	// ErrInvalidTransferCategory is returned for categories that are not a short tag.
+	ErrInvalidTransferCategory = fmt.Errorf("category must be up to %d lowercase letters, digits, '-' or '_'", MaxTransferCategoryLength)
+
+	// ErrEmptyBatch is returned for a batch transfer without recipients.
+	ErrEmptyBatch = errors.New("batch must contain at least one transfer")
+	// ErrBatchTooLarge is returned for batches over MaxBatchTransfers.
+	ErrBatchTooLarge = fmt.Errorf("batch must contain at most %d transfers", MaxBatchTransfers)
+	// ErrBatchAmountTooLarge is reported for batch lines over MaxBatchTransferAmount.
+	ErrBatchAmountTooLarge = fmt.Errorf("amount must be at most %d", MaxBatchTransferAmount)
+	// ErrBatchRejected is matched by a BatchTransferError.
+	ErrBatchRejected = errors.New("batch transfer rejected")
+
+	transferCategoryPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+)
+
+// TransferNote is optional metadata of a transfer: a free-text message and a category
+// tag such as "thanks", "bet" or "lunch".
+type TransferNote struct {
+	Message  string
+	Category string
+}
+
+// normalize trims the note, strips control and invisible formatting characters from the
+// message, lowercases the category and checks both against their limits.
+func (n TransferNote) normalize() (TransferNote, error) {
+	message := strings.Map(func(r rune) rune {
+		switch {
+		case r == '\n' || r == '\t':
+			return ' '
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r), r == utf8.RuneError:
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(n.Message, ""))
+	message = strings.TrimSpace(message)
+	if utf8.RuneCountInString(message) > MaxTransferMessageLength {
+		return TransferNote{}, ErrTransferMessageTooLong
+	}
+
+	category := strings.ToLower(strings.TrimSpace(n.Category))
+	if category != "" && (len(category) > MaxTransferCategoryLength || !transferCategoryPattern.MatchString(category)) {
+		return TransferNote{}, ErrInvalidTransferCategory
+	}
+
+	return TransferNote{Message: message, Category: category}, nil
+}
+
+// BatchTransferLine is one recipient of a batch transfer.
+type BatchTransferLine struct {
+	ToUser string
+	Amount int
+}
+
+// BatchTransferResult is the outcome of one line of a batch transfer. Error is set
+// for lines that made the batch fail; TransactionID is set when the batch succeeded.
+// swagger:model BatchTransferResult
+type BatchTransferResult struct {
+	ToUser        string `json:"toUser"`
+	Amount        int    `json:"amount"`
+	TransactionID uint   `json:"transactionId,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// BatchTransferError is returned when some lines of a batch are invalid.
+// Nothing is transferred; Results tells which lines are at fault.
+type BatchTransferError struct {
+	Results []BatchTransferResult
+}
+
+func (e *BatchTransferError) Error() string {
+	invalid := 0
+	for _, r := range e.Results {
+		if r.Error != "" {
+			invalid++
+		}
+	}
+	return fmt.Sprintf("%v: %d of %d transfers are invalid", ErrBatchRejected, invalid, len(e.Results))
+}
+
+func (e *BatchTransferError) Is(target error) bool {
+	return target == ErrBatchRejected
+}
+
 type TransactionService interface {
-	TransferCoins(fromUserID, toUserID uint, amount int) error
+	TransferCoins(ctx context.Context, fromUserID, toUserID uint, amount int, note TransferNote) error
+	TransferCoinsBatch(ctx context.Context, fromUserID uint, lines []BatchTransferLine, note TransferNote) ([]BatchTransferResult, error)
 }
 
 type transactionService struct {
-	userRepo        repositories.UserRepository
-	transactionRepo repositories.TransactionRepository
-	db              *gorm.DB
+	uow    repositories.UnitOfWork
+	limits TransferLimitService
 }
 
-func NewTransactionService(
-	userRepo repositories.UserRepository,
-	txRepo repositories.TransactionRepository,
-	db *gorm.DB,
-) TransactionService {
-	return &transactionService{userRepo: userRepo, transactionRepo: txRepo, db: db}
+// NewTransactionService creates the service. Transfers are checked against limits
+// unless it is nil.
+func NewTransactionService(uow repositories.UnitOfWork, limits TransferLimitService) TransactionService {
+	return &transactionService{uow: uow, limits: limits}
 }
 
-func (t *transactionService) TransferCoins(fromUserID, toUserID uint, amount int) error {
-	if fromUserID == toUserID {
-		return fmt.Errorf("cannot transfer coins to yourself")
-	}
+func (t *transactionService) TransferCoins(ctx context.Context, fromUserID, toUserID uint, amount int, note TransferNote) (err error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.TransferCoins")
+	defer span.End()
 
-	if amount <= 0 {
-		return fmt.Errorf("amount must be greater than 0")
+	defer func() { observeTransfer(err, amount) }()
+
+	if err := validateTransfer(fromUserID, toUserID, amount); err != nil {
+		return err
 	}
+	note, err = note.normalize()
+	if err != nil {
+		return err
+	}
+
+	return t.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		_, err := transfer(ctx, repos, t.limits, fromUserID, toUserID, amount, note)
+		return err
+	})
+}
 
-	err := t.db.Transaction(func(tx *gorm.DB) error {
-		userRepoTx := repositories.NewUserRepository(tx)
-		txRepoTx := repositories.NewTransactionRepository(tx)
+// TransferCoinsBatch sends coins to several users in one database transaction.
+// Recipients are resolved in a single query and the sender is debited once for
+// the whole batch, so either every transfer is made or none is. The note is
+// attached to each transfer.
+func (t *transactionService) TransferCoinsBatch(ctx context.Context, fromUserID uint, lines []BatchTransferLine, note TransferNote) (_ []BatchTransferResult, err error) {
+	ctx, span := tracing.Start(ctx, "TransactionService.TransferCoinsBatch")
+	defer span.End()
 
-		fromUser, err := userRepoTx.GetUserByID(fromUserID)
+	defer func() {
 		if err != nil {
-			return err
+			metrics.TransferFailed(TransferFailureReason(err))
+			return
 		}
-		if fromUser == nil {
-			return fmt.Errorf("user %d not found", fromUserID)
+		for _, line := range lines {
+			metrics.TransferCompleted(line.Amount)
 		}
+	}()
 
-		toUser, err := userRepoTx.GetUserByID(toUserID)
+	if len(lines) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	if len(lines) > MaxBatchTransfers {
+		return nil, ErrBatchTooLarge
+	}
+	note, err = note.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []BatchTransferResult
+	err = t.uow.Do(ctx, func(repos *repositories.Repositories) error {
+		names := make([]string, 0, len(lines))
+		for _, line := range lines {
+			names = append(names, line.ToUser)
+		}
+		recipients, err := repos.Users.GetUsersByNames(ctx, names)
 		if err != nil {
 			return err
 		}
-		if toUser == nil {
-			return fmt.Errorf("user %d not found", toUserID)
-		}
 
-		if fromUser.Coins < amount {
-			return fmt.Errorf("user %d does not have enough coins", fromUserID)
+		results = make([]BatchTransferResult, len(lines))
+		ids := []uint{fromUserID}
+		total := 0
+		failed := false
+		for i, line := range lines {
+			results[i] = BatchTransferResult{ToUser: line.ToUser, Amount: line.Amount}
+			recipient, ok := recipients[line.ToUser]
+			if !ok {
+				results[i].Error = "target user not found"
+				failed = true
+				continue
+			}
+			if err := validateTransfer(fromUserID, recipient.ID, line.Amount); err != nil {
+				results[i].Error = err.Error()
+				failed = true
+				continue
+			}
+			if line.Amount > MaxBatchTransferAmount {
+				results[i].Error = ErrBatchAmountTooLarge.Error()
+				failed = true
+				continue
+			}
+			ids = append(ids, recipient.ID)
+			if total, ok = addCoins(total, line.Amount); !ok {
+				return ErrAmountTooLarge
+			}
+		}
+		if failed {
+			return &BatchTransferError{Results: results}
+		}
+		if total <= 0 {
+			return ErrInvalidAmount
 		}
 
-		fromUser.Coins -= amount
-		toUser.Coins += amount
-
-		if err := userRepoTx.UpdateUser(fromUser); err != nil {
+		users, err := repos.Users.LockUsersByIDs(ctx, ids)
+		if err != nil {
 			return err
 		}
-		if err := userRepoTx.UpdateUser(toUser); err != nil {
-			return err
+		fromUser, ok := users[fromUserID]
+		if !ok {
+			return fmt.Errorf("user %d not found", fromUserID)
 		}
-
-		transaction := &domain.Transaction{
-			FromUserID: fromUserID,
-			ToUserID:   &toUserID,
-			Amount:     amount,
-			Type:       domain.Transfer,
+		if t.limits != nil {
+			amounts := make([]int, 0, len(lines))
+			for _, line := range lines {
+				amounts = append(amounts, line.Amount)
+			}
+			if err := t.limits.CheckTransfers(ctx, repos, fromUserID, amounts...); err != nil {
+				return err
+			}
 		}
-
-		if err := txRepoTx.CreateTransaction(transaction); err != nil {
+		if fromUser.Coins < total {
+			return notEnoughCoins(fromUserID)
+		}
+		if err := repos.Users.ChangeCoins(ctx, fromUserID, -total); err != nil {
+			if errors.Is(err, repositories.ErrInsufficientCoins) {
+				return notEnoughCoins(fromUserID)
+			}
 			return err
 		}
 
+		for i, line := range lines {
+			toUserID := recipients[line.ToUser].ID
+			if err := repos.Users.ChangeCoins(ctx, toUserID, line.Amount); err != nil {
+				return err
+			}
+			transaction := &domain.Transaction{
+				FromUserID: fromUserID,
+				ToUserID:   &toUserID,
+				Amount:     line.Amount,
+				Type:       domain.Transfer,
+				Message:    note.Message,
+				Category:   note.Category,
+			}
+			if err := repos.Transactions.CreateTransaction(ctx, transaction); err != nil {
+				return err
+			}
+			results[i].TransactionID = transaction.ID
+		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// validateTransfer checks transfer arguments that do not require the database.
+func validateTransfer(fromUserID, toUserID uint, amount int) error {
+	if fromUserID == toUserID {
+		return ErrSelfTransfer
+	}
+
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+
+	return nil
+}
+
+// transfer moves coins between two users using repositories bound to an open transaction.
+// Both user rows are locked before the balances change, so concurrent transfers
+// from the same account are serialized and can not overdraw it.
+// The sender's limits are checked unless limits is nil. The note must already be normalized.
+func transfer(ctx context.Context, repos *repositories.Repositories, limits TransferLimitService, fromUserID, toUserID uint, amount int, note TransferNote) (*domain.Transaction, error) {
+	users, err := repos.Users.LockUsersByIDs(ctx, []uint{fromUserID, toUserID})
+	if err != nil {
+		return nil, err
+	}
+	fromUser, ok := users[fromUserID]
+	if !ok {
+		return nil, fmt.Errorf("user %d not found", fromUserID)
+	}
+	if _, ok := users[toUserID]; !ok {
+		return nil, fmt.Errorf("user %d not found", toUserID)
+	}
 
-	return err
+	if limits != nil {
+		if err := limits.CheckTransfers(ctx, repos, fromUserID, amount); err != nil {
+			return nil, err
+		}
+	}
+
+	if fromUser.Coins < amount {
+		return nil, notEnoughCoins(fromUserID)
+	}
+
+	if err := repos.Users.ChangeCoins(ctx, fromUserID, -amount); err != nil {
+		if errors.Is(err, repositories.ErrInsufficientCoins) {
+			return nil, notEnoughCoins(fromUserID)
+		}
+		return nil, err
+	}
+	if err := repos.Users.ChangeCoins(ctx, toUserID, amount); err != nil {
+		return nil, err
+	}
+
+	transaction := &domain.Transaction{
+		FromUserID: fromUserID,
+		ToUserID:   &toUserID,
+		Amount:     amount,
+		Type:       domain.Transfer,
+		Message:    note.Message,
+		Category:   note.Category,
+	}
+	if err := repos.Transactions.CreateTransaction(ctx, transaction); err != nil {
+		return nil, err
+	}
+
+	return transaction, nil
+}
+
+func notEnoughCoins(userID uint) error {
+	return fmt.Errorf("user %d %w", userID, ErrNotEnoughCoins)
+}
+
+// Reasons of failed transfers reported by TransferFailureReason, besides the codes
+// of TransferLimitError.
+const (
+	FailureNotEnoughCoins = "not_enough_coins"
+	FailureInvalid        = "invalid"
+	FailureOther          = "other"
+)
+
+// TransferFailureReason classifies the error of a failed transfer for monitoring.
+func TransferFailureReason(err error) string {
+	var limitErr *TransferLimitError
+	switch {
+	case errors.As(err, &limitErr):
+		return limitErr.Code
+	case errors.Is(err, ErrNotEnoughCoins):
+		return FailureNotEnoughCoins
+	case errors.Is(err, ErrSelfTransfer),
+		errors.Is(err, ErrInvalidAmount),
+		errors.Is(err, ErrTransferMessageTooLong),
+		errors.Is(err, ErrInvalidTransferCategory),
+		errors.Is(err, ErrEmptyBatch),
+		errors.Is(err, ErrBatchTooLarge),
+		errors.Is(err, ErrAmountTooLarge),
+		errors.Is(err, ErrBatchRejected):
+		return FailureInvalid
+	default:
+		return FailureOther
+	}
+}
+
+// observeTransfer records the outcome of a single transfer in the metrics.
+func observeTransfer(err error, amount int) {
+	if err != nil {
+		metrics.TransferFailed(TransferFailureReason(err))
+		return
+	}
+	metrics.TransferCompleted(amount)
 }
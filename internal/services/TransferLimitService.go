@@ -0,0 +1,210 @@
+package services
+
+import (
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TransferLimitWindow is the rolling window of the daily transfer limits.
+const TransferLimitWindow = 24 * time.Hour
+
+// Codes of TransferLimitError, returned to clients so they can tell the limits apart.
+const (
+	LimitCodeMaxAmount   = "transfer_amount_limit"
+	LimitCodeDailyAmount = "daily_amount_limit"
+	LimitCodeDailyCount  = "daily_count_limit"
+)
+
+var (
+	// ErrTransferAmountLimit is matched by a TransferLimitError for a single transfer over the limit.
+	ErrTransferAmountLimit = errors.New("transfer exceeds the per-transfer limit")
+	// ErrDailyAmountLimit is matched by a TransferLimitError when the 24h total would exceed the limit.
+	ErrDailyAmountLimit = errors.New("transfer exceeds the daily amount limit")
+	// ErrDailyCountLimit is matched by a TransferLimitError when the 24h number of transfers would exceed the limit.
+	ErrDailyCountLimit = errors.New("transfer exceeds the daily number of transfers")
+	// ErrInvalidTransferLimit is returned for negative limits.
+	ErrInvalidTransferLimit = errors.New("limits must not be negative")
+)
+
+// TransferLimitError is returned when a transfer would break one of the sender's limits.
+type TransferLimitError struct {
+	Code  string
+	Limit int
+	err   error
+}
+
+func (e *TransferLimitError) Error() string {
+	return fmt.Sprintf("%v (limit %d)", e.err, e.Limit)
+}
+
+func (e *TransferLimitError) Unwrap() error {
+	return e.err
+}
+
+// TransferLimits are the limits of one user. Zero means no limit.
+// swagger:model TransferLimits
+type TransferLimits struct {
+	MaxAmount   int `json:"maxAmount"`
+	DailyAmount int `json:"dailyAmount"`
+	DailyCount  int `json:"dailyCount"`
+}
+
+// TransferLimitOverride replaces some of the default limits of one user;
+// nil fields keep the default.
+// swagger:model TransferLimitOverride
+type TransferLimitOverride struct {
+	MaxAmount   *int `json:"maxAmount"`
+	DailyAmount *int `json:"dailyAmount"`
+	DailyCount  *int `json:"dailyCount"`
+}
+
+// TransferLimitsInfo shows the limits in effect for a user and how much of the
+// rolling 24h window is used.
+// swagger:model TransferLimitsInfo
+type TransferLimitsInfo struct {
+	Limits     TransferLimits         `json:"limits"`
+	Override   *TransferLimitOverride `json:"override,omitempty"`
+	UsedAmount int                    `json:"usedAmount"`
+	UsedCount  int                    `json:"usedCount"`
+}
+
+// TransferLimitService enforces the per-transfer and rolling 24h transfer limits and
+// manages per-user overrides of the configured defaults.
+type TransferLimitService interface {
+	GetLimits(ctx context.Context, userID uint) (*TransferLimitsInfo, error)
+	SetOverride(ctx context.Context, userID uint, override TransferLimitOverride) error
+	ClearOverride(ctx context.Context, userID uint) error
+	// CheckTransfers verifies that the user may send transfers of the given amounts now.
+	// It must run inside the transaction that makes the transfers, after the sender's
+	// row is locked, so that concurrent transfers can not both fit under a limit.
+	CheckTransfers(ctx context.Context, repos *repositories.Repositories, userID uint, amounts ...int) error
+}
+
+type transferLimitService struct {
+	limitRepo repositories.TransferLimitRepository
+	txRepo    repositories.TransactionRepository
+	defaults  TransferLimits
+	now       func() time.Time
+}
+
+// NewTransferLimitService creates the service with the configured default limits.
+// A nil now means time.Now.
+func NewTransferLimitService(
+	limitRepo repositories.TransferLimitRepository,
+	txRepo repositories.TransactionRepository,
+	defaults TransferLimits,
+	now func() time.Time,
+) TransferLimitService {
+	if now == nil {
+		now = time.Now
+	}
+	return &transferLimitService{limitRepo: limitRepo, txRepo: txRepo, defaults: defaults, now: now}
+}
+
+func (s *transferLimitService) GetLimits(ctx context.Context, userID uint) (*TransferLimitsInfo, error) {
+	ctx, span := tracing.Start(ctx, "TransferLimitService.GetLimits")
+	defer span.End()
+
+	override, err := s.limitRepo.GetLimit(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.txRepo.GetTransferStats(ctx, userID, s.now().Add(-TransferLimitWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &TransferLimitsInfo{
+		Limits:     s.effective(override),
+		UsedAmount: stats.Amount,
+		UsedCount:  stats.Count,
+	}
+	if override != nil {
+		info.Override = &TransferLimitOverride{
+			MaxAmount:   override.MaxAmount,
+			DailyAmount: override.DailyAmount,
+			DailyCount:  override.DailyCount,
+		}
+	}
+	return info, nil
+}
+
+func (s *transferLimitService) SetOverride(ctx context.Context, userID uint, override TransferLimitOverride) error {
+	ctx, span := tracing.Start(ctx, "TransferLimitService.SetOverride")
+	defer span.End()
+
+	for _, v := range []*int{override.MaxAmount, override.DailyAmount, override.DailyCount} {
+		if v != nil && *v < 0 {
+			return ErrInvalidTransferLimit
+		}
+	}
+	return s.limitRepo.SetLimit(ctx, &domain.TransferLimit{
+		UserID:      userID,
+		MaxAmount:   override.MaxAmount,
+		DailyAmount: override.DailyAmount,
+		DailyCount:  override.DailyCount,
+		UpdatedAt:   s.now(),
+	})
+}
+
+func (s *transferLimitService) ClearOverride(ctx context.Context, userID uint) error {
+	ctx, span := tracing.Start(ctx, "TransferLimitService.ClearOverride")
+	defer span.End()
+
+	_, err := s.limitRepo.DeleteLimit(ctx, userID)
+	return err
+}
+
+func (s *transferLimitService) CheckTransfers(ctx context.Context, repos *repositories.Repositories, userID uint, amounts ...int) error {
+	override, err := repos.Limits.GetLimit(ctx, userID)
+	if err != nil {
+		return err
+	}
+	limits := s.effective(override)
+
+	total := 0
+	for _, amount := range amounts {
+		if limits.MaxAmount > 0 && amount > limits.MaxAmount {
+			return &TransferLimitError{Code: LimitCodeMaxAmount, Limit: limits.MaxAmount, err: ErrTransferAmountLimit}
+		}
+		total += amount
+	}
+	if limits.DailyAmount == 0 && limits.DailyCount == 0 {
+		return nil
+	}
+
+	stats, err := repos.Transactions.GetTransferStats(ctx, userID, s.now().Add(-TransferLimitWindow))
+	if err != nil {
+		return err
+	}
+	if limits.DailyAmount > 0 && stats.Amount+total > limits.DailyAmount {
+		return &TransferLimitError{Code: LimitCodeDailyAmount, Limit: limits.DailyAmount, err: ErrDailyAmountLimit}
+	}
+	if limits.DailyCount > 0 && stats.Count+len(amounts) > limits.DailyCount {
+		return &TransferLimitError{Code: LimitCodeDailyCount, Limit: limits.DailyCount, err: ErrDailyCountLimit}
+	}
+	return nil
+}
+
+// effective applies an override on top of the defaults.
+func (s *transferLimitService) effective(override *domain.TransferLimit) TransferLimits {
+	limits := s.defaults
+	if override == nil {
+		return limits
+	}
+	if override.MaxAmount != nil {
+		limits.MaxAmount = *override.MaxAmount
+	}
+	if override.DailyAmount != nil {
+		limits.DailyAmount = *override.DailyAmount
+	}
+	if override.DailyCount != nil {
+		limits.DailyCount = *override.DailyCount
+	}
+	return limits
+}
@@ -3,8 +3,15 @@ package services
 import (
 	"avito-tech-go/internal/domain"
 	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/tracing"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"golang.org/x/sync/errgroup"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type InfoResponse struct {
@@ -26,15 +33,69 @@ type CoinHistory struct {
 type ReceivedTransaction struct {
 	FromUser string `json:"fromUser"`
 	Amount   int    `json:"amount"`
+	Message  string `json:"message,omitempty"`
+	Category string `json:"category,omitempty"`
 }
 
 type SentTransaction struct {
-	ToUser string `json:"toUser"`
-	Amount int    `json:"amount"`
+	ToUser   string `json:"toUser"`
+	Amount   int    `json:"amount"`
+	Message  string `json:"message,omitempty"`
+	Category string `json:"category,omitempty"`
+}
+
+const (
+	// DefaultHistoryLimit is the page size used when the request does not set one.
+	DefaultHistoryLimit = 20
+	// MaxHistoryLimit is the largest page size a client can request.
+	MaxHistoryLimit = 100
+)
+
+// ErrInvalidHistoryQuery is returned for unknown filters or a malformed cursor.
+var ErrInvalidHistoryQuery = errors.New("invalid history query")
+
+// HistoryRequest holds the filters and the page of a history request. Empty fields do
+// not filter.
+type HistoryRequest struct {
+	Type         string
+	Direction    string
+	Counterparty string
+	Category     string
+	From         *time.Time
+	To           *time.Time
+	Cursor       string
+	Limit        int
+}
+
+// HistoryEntry is a single transaction as seen by the user. Direction is "in" for coins
+// received and "out" for coins spent; the counterparty of a purchase or refund is "shop"
+// and of an allowance grant "system".
+// ReversalOf is the transaction undone by a reversal or refund.
+// swagger:model HistoryEntry
+type HistoryEntry struct {
+	ID           uint      `json:"id"`
+	Type         string    `json:"type"`
+	Direction    string    `json:"direction"`
+	Counterparty string    `json:"counterparty"`
+	Amount       int       `json:"amount"`
+	Item         string    `json:"item,omitempty"`
+	Quantity     int       `json:"quantity,omitempty"`
+	Message      string    `json:"message,omitempty"`
+	Category     string    `json:"category,omitempty"`
+	ReversalOf   *uint     `json:"reversalOf,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// HistoryPage is a page of the history. NextCursor is empty on the last page.
+// swagger:model HistoryPage
+type HistoryPage struct {
+	Entries    []HistoryEntry `json:"entries"`
+	NextCursor string         `json:"nextCursor,omitempty"`
 }
 
 type UserService interface {
-	GetInfo(userID uint) (*InfoResponse, error)
+	GetInfo(ctx context.Context, userID uint) (*InfoResponse, error)
+	GetHistory(ctx context.Context, userID uint, req HistoryRequest) (*HistoryPage, error)
 }
 
 type userService struct {
@@ -55,9 +116,12 @@ func NewUserService(
 	}
 }
 
-func (s *userService) GetInfo(userID uint) (*InfoResponse, error) {
+func (s *userService) GetInfo(ctx context.Context, userID uint) (*InfoResponse, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetInfo")
+	defer span.End()
+
 	// Сначала получаем данные пользователя
-	user, err := s.getUser(userID)
+	user, err := s.getUser(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -70,12 +134,12 @@ func (s *userService) GetInfo(userID uint) (*InfoResponse, error) {
 		transactions []domain.Transaction
 	)
 
-	// Создаем группу для параллельного выполнения
-	var g errgroup.Group
+	// Создаем группу для параллельного выполнения; ошибка одного запроса отменяет другой
+	g, groupCtx := errgroup.WithContext(ctx)
 
 	// Запускаем запрос на получение инвентаря
 	g.Go(func() error {
-		inv, err := s.getInventoryInfo(userID)
+		inv, err := s.getInventoryInfo(groupCtx, userID)
 		if err != nil {
 			return err
 		}
@@ -85,7 +149,7 @@ func (s *userService) GetInfo(userID uint) (*InfoResponse, error) {
 
 	// Запускаем запрос на получение транзакций
 	g.Go(func() error {
-		txs, err := s.getUserTransactions(userID)
+		txs, err := s.getUserTransactions(groupCtx, userID)
 		if err != nil {
 			return err
 		}
@@ -99,7 +163,7 @@ func (s *userService) GetInfo(userID uint) (*InfoResponse, error) {
 	}
 
 	// Получаем имена пользователей, задействованных в транзакциях
-	usernamesMap, err := s.getUsernamesForTransactions(userID, transactions)
+	usernamesMap, err := s.getUsernamesForTransactions(ctx, userID, transactions)
 	if err != nil {
 		return nil, err
 	}
@@ -115,13 +179,13 @@ func (s *userService) GetInfo(userID uint) (*InfoResponse, error) {
 }
 
 // getUser получает пользователя по ID
-func (s *userService) getUser(userID uint) (*domain.User, error) {
-	return s.userRepo.GetUserByID(userID)
+func (s *userService) getUser(ctx context.Context, userID uint) (*domain.User, error) {
+	return s.userRepo.GetUserByID(ctx, userID)
 }
 
 // getInventoryInfo получает информацию об инвентаре пользователя
-func (s *userService) getInventoryInfo(userID uint) ([]ItemInfo, error) {
-	invItems, err := s.invRepo.GetAllByUser(userID)
+func (s *userService) getInventoryInfo(ctx context.Context, userID uint) ([]ItemInfo, error) {
+	invItems, err := s.invRepo.GetAllByUser(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -136,15 +200,15 @@ func (s *userService) getInventoryInfo(userID uint) ([]ItemInfo, error) {
 }
 
 // getUserTransactions получает транзакции пользователя
-func (s *userService) getUserTransactions(userID uint) ([]domain.Transaction, error) {
-	return s.transactionRepo.GetUserTransactions(userID)
+func (s *userService) getUserTransactions(ctx context.Context, userID uint) ([]domain.Transaction, error) {
+	return s.transactionRepo.GetUserTransactions(ctx, userID)
 }
 
 // getUsernamesForTransactions собирает уникальные ID и пакетно получает имена пользователей
-func (s *userService) getUsernamesForTransactions(userID uint, transactions []domain.Transaction) (map[uint]string, error) {
+func (s *userService) getUsernamesForTransactions(ctx context.Context, userID uint, transactions []domain.Transaction) (map[uint]string, error) {
 	uniqueIDs := make(map[uint]struct{})
 	for _, tx := range transactions {
-		if tx.Type == domain.Transfer {
+		if tx.Type == domain.Transfer || tx.Type == domain.Reversal {
 			if tx.FromUserID != userID {
 				uniqueIDs[tx.FromUserID] = struct{}{}
 			}
@@ -157,7 +221,7 @@ func (s *userService) getUsernamesForTransactions(userID uint, transactions []do
 	for id := range uniqueIDs {
 		ids = append(ids, id)
 	}
-	return s.userRepo.GetUsernamesByIDs(ids)
+	return s.userRepo.GetUsernamesByIDs(ctx, ids)
 }
 
 // buildCoinHistory формирует историю транзакций для ответа
@@ -165,7 +229,7 @@ func (s *userService) buildCoinHistory(userID uint, transactions []domain.Transa
 	var history CoinHistory
 	for _, tx := range transactions {
 		switch tx.Type {
-		case domain.Transfer:
+		case domain.Transfer, domain.Reversal:
 			if tx.FromUserID == userID {
 				toName := "unknown"
 				if tx.ToUserID != nil {
@@ -174,8 +238,10 @@ func (s *userService) buildCoinHistory(userID uint, transactions []domain.Transa
 					}
 				}
 				history.Sent = append(history.Sent, SentTransaction{
-					ToUser: toName,
-					Amount: tx.Amount,
+					ToUser:   toName,
+					Amount:   tx.Amount,
+					Message:  tx.Message,
+					Category: tx.Category,
 				})
 			} else {
 				fromName := "unknown"
@@ -185,6 +251,8 @@ func (s *userService) buildCoinHistory(userID uint, transactions []domain.Transa
 				history.Received = append(history.Received, ReceivedTransaction{
 					FromUser: fromName,
 					Amount:   tx.Amount,
+					Message:  tx.Message,
+					Category: tx.Category,
 				})
 			}
 		case domain.Purchase:
@@ -192,13 +260,184 @@ func (s *userService) buildCoinHistory(userID uint, transactions []domain.Transa
 				ToUser: "shop",
 				Amount: tx.Amount,
 			})
+		case domain.Refund:
+			history.Received = append(history.Received, ReceivedTransaction{
+				FromUser: "shop",
+				Amount:   tx.Amount,
+			})
+		case domain.Grant:
+			history.Received = append(history.Received, ReceivedTransaction{
+				FromUser: "system",
+				Amount:   tx.Amount,
+			})
 		}
 	}
 	return history
 }
 
-func (s *userService) getUsernameByID(userID uint) string {
-	u, err := s.userRepo.GetUserByID(userID)
+// GetHistory returns a page of the user's transactions, newest first.
+func (s *userService) GetHistory(ctx context.Context, userID uint, req HistoryRequest) (*HistoryPage, error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetHistory")
+	defer span.End()
+
+	query, err := s.historyQuery(ctx, userID, req)
+	if err != nil {
+		return nil, err
+	}
+	if query == nil {
+		return &HistoryPage{Entries: []HistoryEntry{}}, nil
+	}
+
+	// One extra row tells whether there is a next page.
+	limit := query.Limit
+	query.Limit++
+	transactions, err := s.transactionRepo.GetUserHistory(ctx, *query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &HistoryPage{Entries: make([]HistoryEntry, 0, limit)}
+	if len(transactions) > limit {
+		transactions = transactions[:limit]
+		last := transactions[limit-1]
+		page.NextCursor = encodeHistoryCursor(repositories.HistoryCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	usernamesMap, err := s.getUsernamesForTransactions(ctx, userID, transactions)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tx := range transactions {
+		page.Entries = append(page.Entries, newHistoryEntry(userID, tx, usernamesMap))
+	}
+	return page, nil
+}
+
+// historyQuery validates the request and resolves the counterparty. A nil query means
+// nothing can match, e.g. the counterparty does not exist.
+func (s *userService) historyQuery(ctx context.Context, userID uint, req HistoryRequest) (*repositories.HistoryQuery, error) {
+	query := &repositories.HistoryQuery{
+		UserID:    userID,
+		Direction: req.Direction,
+		Category:  strings.ToLower(req.Category),
+		From:      req.From,
+		To:        req.To,
+		Limit:     req.Limit,
+	}
+
+	switch domain.TransactionType(req.Type) {
+	case "":
+	case domain.Transfer, domain.Purchase, domain.Reversal, domain.Refund, domain.Grant:
+		query.Types = []domain.TransactionType{domain.TransactionType(req.Type)}
+	default:
+		return nil, fmt.Errorf("%w: unknown type '%s'", ErrInvalidHistoryQuery, req.Type)
+	}
+
+	switch req.Direction {
+	case "", repositories.DirectionIn, repositories.DirectionOut:
+	default:
+		return nil, fmt.Errorf("%w: direction must be 'in' or 'out'", ErrInvalidHistoryQuery)
+	}
+
+	switch {
+	case query.Limit == 0:
+		query.Limit = DefaultHistoryLimit
+	case query.Limit < 0 || query.Limit > MaxHistoryLimit:
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidHistoryQuery, MaxHistoryLimit)
+	}
+
+	if req.Cursor != "" {
+		cursor, err := decodeHistoryCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query.After = cursor
+	}
+
+	if req.Counterparty != "" {
+		counterparty, err := s.userRepo.GetUserByName(ctx, req.Counterparty)
+		if err != nil {
+			return nil, err
+		}
+		if counterparty == nil {
+			return nil, nil
+		}
+		query.Counterparty = &counterparty.ID
+	}
+
+	return query, nil
+}
+
+func newHistoryEntry(userID uint, tx domain.Transaction, usernamesMap map[uint]string) HistoryEntry {
+	entry := HistoryEntry{
+		ID:         tx.ID,
+		Type:       string(tx.Type),
+		Direction:  repositories.DirectionOut,
+		Amount:     tx.Amount,
+		Message:    tx.Message,
+		Category:   tx.Category,
+		ReversalOf: tx.ReversalOfID,
+		CreatedAt:  tx.CreatedAt,
+	}
+
+	switch tx.Type {
+	case domain.Transfer, domain.Reversal:
+		counterpartyID := tx.FromUserID
+		if tx.FromUserID == userID {
+			if tx.ToUserID != nil {
+				counterpartyID = *tx.ToUserID
+			}
+		} else {
+			entry.Direction = repositories.DirectionIn
+		}
+		entry.Counterparty = "unknown"
+		if name, ok := usernamesMap[counterpartyID]; ok {
+			entry.Counterparty = name
+		}
+	case domain.Purchase, domain.Refund:
+		if tx.Type == domain.Refund {
+			entry.Direction = repositories.DirectionIn
+		}
+		entry.Counterparty = "shop"
+		entry.Item = tx.ItemType
+		entry.Quantity = tx.Quantity
+	case domain.Grant:
+		entry.Direction = repositories.DirectionIn
+		entry.Counterparty = "system"
+	}
+	return entry
+}
+
+func encodeHistoryCursor(cursor repositories.HistoryCursor) string {
+	raw := strconv.FormatInt(cursor.CreatedAt.UnixNano(), 10) + ":" + strconv.FormatUint(uint64(cursor.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeHistoryCursor(encoded string) (*repositories.HistoryCursor, error) {
+	invalid := fmt.Errorf("%w: malformed cursor", ErrInvalidHistoryQuery)
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, invalid
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, invalid
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, invalid
+	}
+	txID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, invalid
+	}
+	return &repositories.HistoryCursor{CreatedAt: time.Unix(0, unixNano), ID: uint(txID)}, nil
+}
+
+func (s *userService) getUsernameByID(ctx context.Context, userID uint) string {
+	u, err := s.userRepo.GetUserByID(ctx, userID)
 	if err != nil || u == nil {
 		return fmt.Sprintf("user_%d", userID)
 	}
@@ -2,16 +2,23 @@ package database
 
 import (
 	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/logging"
+	"avito-tech-go/internal/tracing"
+	"database/sql"
 	"errors"
 	"fmt"
 	"gorm.io/driver/postgres"
+	"log/slog"
 	"time"
 
 	"avito-tech-go/internal/config"
 	"gorm.io/gorm"
 )
 
-func NewDBConnection(cfg *config.Config) (*gorm.DB, error) {
+// NewDBConnection connects to PostgreSQL, retrying while the database starts up.
+// GORM logs through logger, so queries of every repository are logged with the
+// request ID of their context, and traced as children of the span in that context.
+func NewDBConnection(cfg *config.Config, logger *slog.Logger) (*gorm.DB, error) {
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%d sslmode=disable",
 		cfg.DBHost,
@@ -24,10 +31,18 @@ func NewDBConnection(cfg *config.Config) (*gorm.DB, error) {
 	var err error
 	maxAttempts := 10
 	for i := 1; i <= maxAttempts; i++ {
-		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
+			Logger: logging.NewGormLogger(logger, cfg.DBSlowQuery),
+		})
 		if err == nil {
-			sqlDB, err := db.DB()
-			if err == nil && sqlDB.Ping() == nil {
+			err = db.Use(tracing.NewGormPlugin())
+		}
+		if err == nil {
+			var sqlDB *sql.DB
+			if sqlDB, err = db.DB(); err == nil {
+				err = sqlDB.Ping()
+			}
+			if err == nil {
 				// Настраиваем пул соединений
 				sqlDB.SetMaxOpenConns(95)                  // Максимальное число открытых соединений
 				sqlDB.SetMaxIdleConns(50)                  // Максимальное число простаивающих соединений
@@ -36,12 +51,37 @@ func NewDBConnection(cfg *config.Config) (*gorm.DB, error) {
 				return db, nil
 			}
 		}
-		fmt.Printf("Попытка подключения к базе (%d/%d) не удалась: %v\n", i, maxAttempts, err)
+		logger.Warn("database connection failed", "attempt", i, "max_attempts", maxAttempts, "error", err)
 		time.Sleep(5 * time.Second)
 	}
 	return nil, errors.New("database not ready after multiple attempts")
 }
 
+// Models are the tables of the service, in the order they are migrated.
+var Models = []any{
+	&domain.User{},
+	&domain.MerchItem{},
+	&domain.InventoryItem{},
+	&domain.Transaction{},
+	&domain.LedgerAccount{},
+	&domain.LedgerEntry{},
+	&domain.IdempotencyKey{},
+	&domain.CartItem{},
+	&domain.RefreshToken{},
+	&domain.RevokedToken{},
+	&domain.SecurityEvent{},
+	&domain.CoinRequest{},
+	&domain.ScheduledTransfer{},
+	&domain.ScheduledTransferRun{},
+	&domain.TransferLimit{},
+	&domain.AllowanceGrant{},
+}
+
+// Migrate creates or updates the tables of Models.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(Models...)
+}
+
 func SeedMerch(db *gorm.DB) error {
 	items := []domain.MerchItem{
 		{ItemType: "t-shirt", Price: 80},
@@ -57,7 +97,8 @@ func SeedMerch(db *gorm.DB) error {
 	}
 
 	for _, item := range items {
-		if err := db.Where("item_type = ?", item.ItemType).
+		// Unscoped so that items retired by an admin are not brought back.
+		if err := db.Unscoped().Where("item_type = ?", item.ItemType).
 			FirstOrCreate(&item).Error; err != nil {
 			return err
 		}
@@ -0,0 +1,158 @@
+package integration
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_Allowance(t *testing.T) {
+	ctx := context.Background()
+	db := setupIntegrationDB(t)
+
+	uow := repositories.NewUnitOfWork(db)
+	userRepo := repositories.NewUserRepository(db)
+	txRepo := repositories.NewTransactionRepository(db)
+	authService := services.NewAuthService(userRepo, repositories.NewTokenRepository(db), uow, services.AuthOptions{JWTSecret: jwtSecret})
+	userService := services.NewUserService(userRepo, repositories.NewInventoryRepository(db), txRepo)
+	ledgerService := services.NewLedgerService(uow, txRepo)
+
+	now := time.Date(2026, time.October, 1, 0, 5, 0, 0, time.UTC)
+	allowanceService := services.NewAllowanceService(repositories.NewAllowanceRepository(db), uow, services.AllowanceOptions{
+		Amount:     200,
+		Period:     services.AllowanceMonthly,
+		MaxBalance: 1300,
+	}, func() time.Time { return now })
+
+	for _, name := range []string{"alice", "bob"} {
+		_, err := authService.Register(ctx, name, "password")
+		require.NoError(t, err)
+	}
+	// Both registered before the first period the test runs in.
+	require.NoError(t, db.Model(&domain.User{}).Where("username IN ?", []string{"alice", "bob"}).
+		Update("created_at", time.Date(2026, time.September, 20, 0, 0, 0, 0, time.UTC)).Error)
+	alice, err := userRepo.GetUserByName(ctx, "alice")
+	require.NoError(t, err)
+	bob, err := userRepo.GetUserByName(ctx, "bob")
+	require.NoError(t, err)
+	require.NoError(t, userRepo.ChangeCoins(ctx, bob.ID, 250))
+	require.NoError(t, txRepo.IssueCoins(ctx, bob.ID, 250))
+
+	coins := func(userID uint) int {
+		user, err := userRepo.GetUserByID(ctx, userID)
+		require.NoError(t, err)
+		return user.Coins
+	}
+
+	t.Run("Issues once per period up to the cap", func(t *testing.T) {
+		issued, err := allowanceService.IssueDue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, issued)
+		assert.Equal(t, 1200, coins(alice.ID))
+		assert.Equal(t, 1300, coins(bob.ID))
+
+		now = now.Add(20 * 24 * time.Hour)
+		issued, err = allowanceService.IssueDue(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, issued)
+		assert.Equal(t, 1200, coins(alice.ID))
+	})
+
+	t.Run("Next period and capped balances", func(t *testing.T) {
+		now = time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)
+		issued, err := allowanceService.IssueDue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, issued)
+		assert.Equal(t, 1300, coins(alice.ID))
+		assert.Equal(t, 1300, coins(bob.ID))
+
+		var grants []domain.AllowanceGrant
+		require.NoError(t, db.Where("period = ?", "2026-11").Order("user_id").Find(&grants).Error)
+		require.Len(t, grants, 2)
+		assert.Equal(t, 100, grants[0].Amount)
+		assert.NotNil(t, grants[0].TransactionID)
+		assert.Zero(t, grants[1].Amount)
+		assert.Nil(t, grants[1].TransactionID)
+	})
+
+	t.Run("Grants appear in history", func(t *testing.T) {
+		page, err := userService.GetHistory(ctx, alice.ID, services.HistoryRequest{Type: string(domain.Grant)})
+		require.NoError(t, err)
+		require.Len(t, page.Entries, 2)
+		assert.Equal(t, repositories.DirectionIn, page.Entries[0].Direction)
+		assert.Equal(t, "system", page.Entries[0].Counterparty)
+		assert.Equal(t, 100, page.Entries[0].Amount)
+		assert.Equal(t, "allowance for 2026-11", page.Entries[0].Message)
+	})
+
+	t.Run("Users registered during the period wait for the next one", func(t *testing.T) {
+		now = time.Date(2026, time.November, 10, 0, 0, 0, 0, time.UTC)
+		_, err := authService.Register(ctx, "carol", "password")
+		require.NoError(t, err)
+		require.NoError(t, db.Model(&domain.User{}).Where("username = ?", "carol").Update("created_at", now).Error)
+		carol, err := userRepo.GetUserByName(ctx, "carol")
+		require.NoError(t, err)
+
+		issued, err := allowanceService.IssueDue(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, issued)
+		assert.Equal(t, 1000, coins(carol.ID))
+
+		// Alice and Bob are at the cap, so only Carol is credited.
+		now = time.Date(2026, time.December, 1, 0, 0, 0, 0, time.UTC)
+		issued, err = allowanceService.IssueDue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, issued)
+		assert.Equal(t, 1200, coins(carol.ID))
+	})
+
+	t.Run("Ledger stays balanced", func(t *testing.T) {
+		report, err := ledgerService.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.True(t, report.Consistent())
+	})
+}
+
+func TestIntegration_Allowance_ConcurrentRuns(t *testing.T) {
+	ctx := context.Background()
+	db := setupConcurrentIntegrationDB(t)
+
+	uow := repositories.NewUnitOfWork(db)
+	userRepo := repositories.NewUserRepository(db)
+	allowanceService := services.NewAllowanceService(repositories.NewAllowanceRepository(db), uow, services.AllowanceOptions{
+		Amount: 200,
+		Period: services.AllowanceDaily,
+	}, nil)
+
+	var ids []uint
+	for _, name := range []string{"alice", "bob", "carol"} {
+		user := &domain.User{Username: name, PasswordHash: "irrelevant", Coins: 1000, CreatedAt: time.Now().AddDate(0, 0, -1)}
+		require.NoError(t, userRepo.CreateUser(ctx, user))
+		ids = append(ids, user.ID)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = allowanceService.IssueDue(ctx)
+		}()
+	}
+	wg.Wait()
+
+	_, err := allowanceService.IssueDue(ctx)
+	require.NoError(t, err)
+	for _, id := range ids {
+		user, err := userRepo.GetUserByID(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, 1200, user.Coins)
+	}
+}
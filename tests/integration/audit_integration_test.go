@@ -0,0 +1,188 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_Audit(t *testing.T) {
+	ctx := context.Background()
+	db := setupIntegrationDB(t)
+
+	uow := repositories.NewUnitOfWork(db)
+	userRepo := repositories.NewUserRepository(db)
+	invRepo := repositories.NewInventoryRepository(db)
+	txRepo := repositories.NewTransactionRepository(db)
+	merchRepo := repositories.NewMerchRepository(db)
+
+	authService := services.NewAuthService(userRepo, repositories.NewTokenRepository(db), uow, services.AuthOptions{JWTSecret: jwtSecret})
+	transferService := services.NewTransactionService(uow, nil)
+	merchService := services.NewMerchService(merchRepo, userRepo, uow)
+	ledgerService := services.NewLedgerService(uow, txRepo)
+	auditService := services.NewAuditService(uow)
+
+	require.NoError(t, merchRepo.CreateMerchItem(ctx, &domain.MerchItem{ItemType: "cup", Price: 20}))
+
+	_, err := authService.Register(ctx, "alice", "password")
+	require.NoError(t, err)
+	_, err = authService.Register(ctx, "bob", "password")
+	require.NoError(t, err)
+	alice, err := userRepo.GetUserByName(ctx, "alice")
+	require.NoError(t, err)
+	bob, err := userRepo.GetUserByName(ctx, "bob")
+	require.NoError(t, err)
+
+	require.NoError(t, transferService.TransferCoins(ctx, alice.ID, bob.ID, 300, services.TransferNote{}))
+	require.NoError(t, merchService.BuyItem(ctx, bob.ID, "cup"))
+	require.NoError(t, merchService.BuyItem(ctx, bob.ID, "cup"))
+
+	t.Run("Consistent history", func(t *testing.T) {
+		report, err := auditService.Audit(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.UsersChecked)
+		assert.False(t, report.HasMismatches())
+	})
+
+	t.Run("Balance and inventory mismatches are reported", func(t *testing.T) {
+		require.NoError(t, userRepo.ChangeCoins(ctx, alice.ID, 50))
+		item, err := invRepo.GetByUserAndType(ctx, bob.ID, "cup")
+		require.NoError(t, err)
+		item.Quantity = 5
+		require.NoError(t, invRepo.UpdateItem(ctx, item))
+
+		report, err := auditService.Audit(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []services.BalanceMismatch{{
+			UserID:        alice.ID,
+			Username:      "alice",
+			StoredCoins:   750,
+			ExpectedCoins: 700,
+		}}, report.BalanceMismatches)
+		assert.Equal(t, []services.InventoryMismatch{{
+			UserID:    bob.ID,
+			Username:  "bob",
+			ItemType:  "cup",
+			Quantity:  5,
+			Purchased: 2,
+		}}, report.InventoryMismatches)
+	})
+
+	t.Run("Fix restores balances and keeps the ledger in sync", func(t *testing.T) {
+		report, err := auditService.Audit(ctx)
+		require.NoError(t, err)
+
+		fixed, err := auditService.FixBalances(ctx, report)
+		require.NoError(t, err)
+		assert.Equal(t, 1, fixed)
+
+		updated, err := userRepo.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 700, updated.Coins)
+
+		report, err = auditService.Audit(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, report.BalanceMismatches)
+		assert.Len(t, report.InventoryMismatches, 1)
+
+		ledgerReport, err := ledgerService.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.True(t, ledgerReport.Consistent())
+	})
+
+	t.Run("Fix recomputes balances changed since the audit", func(t *testing.T) {
+		require.NoError(t, userRepo.ChangeCoins(ctx, alice.ID, 50))
+		report, err := auditService.Audit(ctx)
+		require.NoError(t, err)
+		require.Len(t, report.BalanceMismatches, 1)
+		require.Equal(t, 700, report.BalanceMismatches[0].ExpectedCoins)
+
+		require.NoError(t, transferService.TransferCoins(ctx, alice.ID, bob.ID, 100, services.TransferNote{}))
+
+		fixed, err := auditService.FixBalances(ctx, report)
+		require.NoError(t, err)
+		assert.Equal(t, 1, fixed)
+		updated, err := userRepo.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 600, updated.Coins)
+
+		ledgerReport, err := ledgerService.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.True(t, ledgerReport.Consistent())
+	})
+
+	t.Run("Fix skips balances corrected since the audit", func(t *testing.T) {
+		require.NoError(t, userRepo.ChangeCoins(ctx, alice.ID, 50))
+		report, err := auditService.Audit(ctx)
+		require.NoError(t, err)
+		require.Len(t, report.BalanceMismatches, 1)
+		require.NoError(t, userRepo.ChangeCoins(ctx, alice.ID, -50))
+
+		fixed, err := auditService.FixBalances(ctx, report)
+		require.NoError(t, err)
+		assert.Zero(t, fixed)
+		updated, err := userRepo.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 600, updated.Coins)
+	})
+
+	t.Run("Purchases without item type are compared in total", func(t *testing.T) {
+		carol := &domain.User{Username: "carol", PasswordHash: "irrelevant", Coins: 990}
+		require.NoError(t, userRepo.CreateUser(ctx, carol))
+		require.NoError(t, txRepo.CreateTransaction(ctx, &domain.Transaction{
+			FromUserID: carol.ID,
+			Amount:     10,
+			Type:       domain.Purchase,
+		}))
+		require.NoError(t, invRepo.CreateItem(ctx, &domain.InventoryItem{UserID: carol.ID, ItemType: "pen", Quantity: 1}))
+
+		report, err := auditService.Audit(ctx)
+		require.NoError(t, err)
+		for _, m := range report.InventoryMismatches {
+			assert.NotEqual(t, carol.ID, m.UserID)
+		}
+		for _, m := range report.BalanceMismatches {
+			assert.NotEqual(t, carol.ID, m.UserID)
+		}
+	})
+}
+
+func TestIntegration_ReadSnapshot(t *testing.T) {
+	ctx := context.Background()
+	// Unlike setupConcurrentIntegrationDB, readers do not take the write lock, so a
+	// writer can commit while the snapshot is open.
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+	db := openIntegrationDB(t, fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL", path))
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	userRepo := repositories.NewUserRepository(db)
+	alice := &domain.User{Username: "alice", PasswordHash: "irrelevant", Coins: 1000}
+	require.NoError(t, userRepo.CreateUser(ctx, alice))
+
+	err = repositories.NewUnitOfWork(db).ReadSnapshot(ctx, func(repos *repositories.Repositories) error {
+		before, err := repos.Users.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+
+		// A transfer commits while the audit is reading.
+		require.NoError(t, userRepo.ChangeCoins(ctx, alice.ID, -100))
+
+		after, err := repos.Users.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Equal(t, before.Coins, after.Coins)
+		return nil
+	})
+	require.NoError(t, err)
+
+	user, err := userRepo.GetUserByID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 900, user.Coins)
+}
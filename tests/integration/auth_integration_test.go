@@ -1,29 +1,38 @@
 package integration
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/handlers"
 	"avito-tech-go/internal/repositories"
 	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const jwtSecret = "mysecret"
 
 func TestIntegration_Auth_Register_Login(t *testing.T) {
+	ctx := context.Background()
 	db := setupIntegrationDB(t)
 	userRepo := repositories.NewUserRepository(db)
-	authService := services.NewAuthService(userRepo, jwtSecret)
+	authService := services.NewAuthService(userRepo, repositories.NewTokenRepository(db), repositories.NewUnitOfWork(db), services.AuthOptions{JWTSecret: jwtSecret})
 
 	t.Run("Successful registration", func(t *testing.T) {
-		token, err := authService.Register("newuser", "password123")
+		tokens, err := authService.Register(ctx, "newuser", "password123")
 		assert.NoError(t, err)
-		assert.NotEmpty(t, token)
+		assert.NotEmpty(t, tokens.RefreshToken)
 
-		parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		parsedToken, err := jwt.Parse(tokens.AccessToken, func(token *jwt.Token) (interface{}, error) {
 
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("unexpected signing method")
@@ -33,28 +42,30 @@ func TestIntegration_Auth_Register_Login(t *testing.T) {
 		assert.NoError(t, err)
 		if claims, ok := parsedToken.Claims.(jwt.MapClaims); ok && parsedToken.Valid {
 			assert.Equal(t, "newuser", claims["username"])
+			assert.NotEmpty(t, claims["jti"])
 			exp := int64(claims["exp"].(float64))
-			assert.True(t, exp > time.Now().Add(70*time.Hour).Unix())
+			assert.True(t, exp <= time.Now().Add(services.DefaultAccessTokenTTL).Unix())
+			assert.True(t, exp > time.Now().Unix())
 		} else {
 			t.Error("failed to parse token claims")
 		}
 	})
 
 	t.Run("Duplicate registration", func(t *testing.T) {
-		_, err := authService.Register("duplicate", "password123")
+		_, err := authService.Register(ctx, "duplicate", "password123")
 		assert.NoError(t, err)
-		_, err = authService.Register("duplicate", "password123")
-		assert.Error(t, err)
+		_, err = authService.Register(ctx, "duplicate", "password123")
+		assert.ErrorIs(t, err, services.ErrUserExists)
 	})
 
 	t.Run("Successful login", func(t *testing.T) {
-		_, err := authService.Register("loginuser", "securepwd")
+		_, err := authService.Register(ctx, "loginuser", "securepwd")
 		assert.NoError(t, err)
-		token, err := authService.Login("loginuser", "securepwd")
+		tokens, err := authService.Login(ctx, "loginuser", "securepwd", "")
 		assert.NoError(t, err)
-		assert.NotEmpty(t, token)
+		assert.NotEmpty(t, tokens.RefreshToken)
 
-		parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		parsedToken, err := jwt.Parse(tokens.AccessToken, func(token *jwt.Token) (interface{}, error) {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, fmt.Errorf("unexpected signing method")
 			}
@@ -69,14 +80,145 @@ func TestIntegration_Auth_Register_Login(t *testing.T) {
 	})
 
 	t.Run("Login for non-existing user", func(t *testing.T) {
-		_, err := authService.Login("nonexistent", "anyPassword")
-		assert.Error(t, err)
+		_, err := authService.Login(ctx, "nonexistent", "anyPassword", "")
+		assert.ErrorIs(t, err, services.ErrUserNotFound)
 	})
 
 	t.Run("Login with invalid password", func(t *testing.T) {
-		_, err := authService.Register("wrongpwd", "correctpwd")
+		_, err := authService.Register(ctx, "wrongpwd", "correctpwd")
 		assert.NoError(t, err)
-		_, err = authService.Login("wrongpwd", "incorrectpwd")
-		assert.Error(t, err)
+		_, err = authService.Login(ctx, "wrongpwd", "incorrectpwd", "")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
 	})
 }
+
+func TestIntegration_Auth_Endpoints(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+	db := setupIntegrationDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	authService := services.NewAuthService(userRepo, repositories.NewTokenRepository(db), repositories.NewUnitOfWork(db), services.AuthOptions{JWTSecret: jwtSecret})
+
+	newRouter := func(autoRegister bool) *gin.Engine {
+		r := gin.New()
+		r.POST("/api/auth", handlers.AuthHandler(authService, autoRegister))
+		r.POST("/api/register", handlers.RegisterHandler(authService))
+		r.POST("/api/login", handlers.LoginHandler(authService))
+		return r
+	}
+	post := func(r *gin.Engine, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	r := newRouter(false)
+
+	t.Run("Register and login", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, post(r, "/api/register", `{"username":"alice","password":"secret"}`).Code)
+		assert.Equal(t, http.StatusConflict, post(r, "/api/register", `{"username":"alice","password":"other"}`).Code)
+		assert.Equal(t, http.StatusOK, post(r, "/api/login", `{"username":"alice","password":"secret"}`).Code)
+	})
+
+	t.Run("Wrong password and unknown user look the same", func(t *testing.T) {
+		wrongPassword := post(r, "/api/login", `{"username":"alice","password":"wrong"}`)
+		unknownUser := post(r, "/api/login", `{"username":"alise","password":"secret"}`)
+		assert.Equal(t, http.StatusUnauthorized, wrongPassword.Code)
+		assert.Equal(t, http.StatusUnauthorized, unknownUser.Code)
+		assert.JSONEq(t, wrongPassword.Body.String(), unknownUser.Body.String())
+
+		exists, err := userRepo.ExistsByUsername(ctx, "alise")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("Auth with a wrong password never registers", func(t *testing.T) {
+		w := post(newRouter(true), "/api/auth", `{"username":"alice","password":"wrong"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NotContains(t, w.Body.String(), "already exists")
+	})
+
+	t.Run("Auth registers unknown users only when enabled", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, post(r, "/api/auth", `{"username":"bob","password":"secret"}`).Code)
+		exists, err := userRepo.ExistsByUsername(ctx, "bob")
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		assert.Equal(t, http.StatusOK, post(newRouter(true), "/api/auth", `{"username":"bob","password":"secret"}`).Code)
+		exists, err = userRepo.ExistsByUsername(ctx, "bob")
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+}
+
+func TestIntegration_Auth_Lockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupIntegrationDB(t)
+	userRepo := repositories.NewUserRepository(db)
+	eventRepo := repositories.NewSecurityEventRepository(db)
+	throttler := services.NewLoginThrottler(services.NewMemoryLoginAttemptStore(), eventRepo, services.LoginThrottlePolicy{
+		UserAttempts: 3,
+		BaseLockout:  time.Minute,
+	}, nil)
+	authService := services.NewAuthService(userRepo, repositories.NewTokenRepository(db), repositories.NewUnitOfWork(db), services.AuthOptions{
+		JWTSecret: jwtSecret,
+		Throttler: throttler,
+	})
+
+	r := gin.New()
+	r.POST("/api/register", handlers.RegisterHandler(authService))
+	r.POST("/api/login", handlers.LoginHandler(authService))
+	post := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusCreated, post("/api/register", `{"username":"alice","password":"secret"}`).Code)
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, http.StatusUnauthorized, post("/api/login", `{"username":"alice","password":"wrong"}`).Code)
+	}
+
+	w := post("/api/login", `{"username":"alice","password":"secret"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	events, err := eventRepo.GetEventsByType(context.Background(), domain.SecurityEventLoginLockout)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "alice", events[0].Username)
+}
+
+func TestIntegration_Auth_LockoutIgnoresForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupIntegrationDB(t)
+	throttler := services.NewLoginThrottler(services.NewMemoryLoginAttemptStore(), repositories.NewSecurityEventRepository(db), services.LoginThrottlePolicy{
+		UserAttempts: 100,
+		IPAttempts:   2,
+		BaseLockout:  time.Minute,
+	}, nil)
+	authService := services.NewAuthService(repositories.NewUserRepository(db), repositories.NewTokenRepository(db), repositories.NewUnitOfWork(db), services.AuthOptions{
+		JWTSecret: jwtSecret,
+		Throttler: throttler,
+	})
+
+	// The server trusts no proxy unless TRUSTED_PROXIES is set.
+	r := gin.New()
+	require.NoError(t, r.SetTrustedProxies(nil))
+	r.POST("/api/login", handlers.LoginHandler(authService))
+
+	codes := make([]int, 0, 4)
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"username":"nobody","password":"wrong"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	assert.Equal(t, []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}, codes)
+}
@@ -0,0 +1,123 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/handlers"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_SendCoinBatch(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+	db := setupIntegrationDB(t)
+
+	userRepo := repositories.NewUserRepository(db)
+	txRepo := repositories.NewTransactionRepository(db)
+	transferService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
+
+	lead := &domain.User{Username: "lead", PasswordHash: "irrelevant", Coins: 100}
+	require.NoError(t, userRepo.CreateUser(ctx, lead))
+	for _, name := range []string{"ann", "ben", "cid"} {
+		require.NoError(t, userRepo.CreateUser(ctx, &domain.User{Username: name, PasswordHash: "irrelevant", Coins: 10}))
+	}
+
+	r := gin.New()
+	r.POST("/api/sendCoin/batch", authenticatedAs(lead.ID), handlers.SendCoinBatchHandler(transferService))
+
+	send := func(body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPost, "/api/sendCoin/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return w, resp
+	}
+
+	balanceOf := func(name string) int {
+		u, err := userRepo.GetUserByName(ctx, name)
+		require.NoError(t, err)
+		return u.Coins
+	}
+
+	assertUnchanged := func(t *testing.T) {
+		assert.Equal(t, 100, balanceOf("lead"))
+		assert.Equal(t, 10, balanceOf("ann"))
+		assert.Equal(t, 10, balanceOf("ben"))
+		txs, err := txRepo.GetUserTransactions(ctx, lead.ID)
+		require.NoError(t, err)
+		assert.Empty(t, txs)
+	}
+
+	t.Run("Invalid recipients reject the whole batch", func(t *testing.T) {
+		w, resp := send(`{"transfers":[{"toUser":"ann","amount":10},{"toUser":"nobody","amount":10},{"toUser":"lead","amount":5}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		results := resp["results"].([]interface{})
+		require.Len(t, results, 3)
+		assert.NotContains(t, results[0], "error")
+		assert.Equal(t, "target user not found", results[1].(map[string]interface{})["error"])
+		assert.Contains(t, results[2].(map[string]interface{})["error"], "yourself")
+		assertUnchanged(t)
+	})
+
+	t.Run("Total over the balance rejects the whole batch", func(t *testing.T) {
+		w, resp := send(`{"transfers":[{"toUser":"ann","amount":60},{"toUser":"ben","amount":50}]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, resp["errors"], "does not have enough coins")
+		assertUnchanged(t)
+	})
+
+	t.Run("Amount over the line limit rejects the whole batch", func(t *testing.T) {
+		w, resp := send(fmt.Sprintf(`{"transfers":[{"toUser":"ann","amount":10},{"toUser":"ben","amount":%d}]}`, math.MaxInt))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		results := resp["results"].([]interface{})
+		require.Len(t, results, 2)
+		assert.NotContains(t, results[0], "error")
+		assert.Equal(t, services.ErrBatchAmountTooLarge.Error(), results[1].(map[string]interface{})["error"])
+		assertUnchanged(t)
+	})
+
+	t.Run("Empty batch", func(t *testing.T) {
+		w, _ := send(`{"transfers":[]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assertUnchanged(t)
+	})
+
+	t.Run("Valid batch commits every transfer", func(t *testing.T) {
+		w, resp := send(`{"transfers":[{"toUser":"ann","amount":30},{"toUser":"ben","amount":20},{"toUser":"ann","amount":5}],"category":"thanks"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		results := resp["results"].([]interface{})
+		require.Len(t, results, 3)
+		for _, result := range results {
+			assert.NotZero(t, result.(map[string]interface{})["transactionId"])
+		}
+
+		assert.Equal(t, 45, balanceOf("lead"))
+		assert.Equal(t, 45, balanceOf("ann"))
+		assert.Equal(t, 30, balanceOf("ben"))
+		assert.Equal(t, 10, balanceOf("cid"))
+
+		txs, err := txRepo.GetTransactionsByType(ctx, lead.ID, domain.Transfer)
+		require.NoError(t, err)
+		require.Len(t, txs, 3)
+		for _, tx := range txs {
+			assert.Equal(t, "thanks", tx.Category)
+		}
+	})
+}
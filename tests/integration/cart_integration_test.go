@@ -0,0 +1,107 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_Cart(t *testing.T) {
+	ctx := context.Background()
+	db := setupIntegrationDB(t)
+
+	merchRepo := repositories.NewMerchRepository(db)
+	userRepo := repositories.NewUserRepository(db)
+	invRepo := repositories.NewInventoryRepository(db)
+	txRepo := repositories.NewTransactionRepository(db)
+	cartRepo := repositories.NewCartRepository(db)
+	uow := repositories.NewUnitOfWork(db)
+	cartService := services.NewCartService(cartRepo, merchRepo, uow)
+
+	require.NoError(t, merchRepo.CreateMerchItem(ctx, &domain.MerchItem{ItemType: "cup", Price: 20}))
+	require.NoError(t, merchRepo.CreateMerchItem(ctx, &domain.MerchItem{ItemType: "pen", Price: 10}))
+
+	user := &domain.User{Username: "shopper", PasswordHash: "irrelevant", Coins: 100}
+	require.NoError(t, userRepo.CreateUser(ctx, user))
+
+	t.Run("Add, list and remove", func(t *testing.T) {
+		require.NoError(t, cartService.AddItem(ctx, user.ID, "cup", 2))
+		require.NoError(t, cartService.AddItem(ctx, user.ID, "cup", 1))
+		require.NoError(t, cartService.AddItem(ctx, user.ID, "pen", 1))
+
+		assert.ErrorIs(t, cartService.AddItem(ctx, user.ID, "unknown", 1), services.ErrMerchItemNotFound)
+		assert.ErrorIs(t, cartService.AddItem(ctx, user.ID, "pen", -1), services.ErrInvalidQuantity)
+		assert.ErrorIs(t, cartService.AddItem(ctx, user.ID, "pen", services.MaxPurchaseQuantity+1), services.ErrInvalidQuantity)
+		assert.ErrorIs(t, cartService.AddItem(ctx, user.ID, "cup", services.MaxPurchaseQuantity-2), services.ErrInvalidQuantity)
+
+		cart, err := cartService.GetCart(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 70, cart.Total)
+		assert.Equal(t, []services.CartLine{
+			{Type: "cup", Quantity: 3, Price: 20, Subtotal: 60, Available: true},
+			{Type: "pen", Quantity: 1, Price: 10, Subtotal: 10, Available: true},
+		}, cart.Items)
+
+		require.NoError(t, cartService.RemoveItem(ctx, user.ID, "pen"))
+		assert.ErrorIs(t, cartService.RemoveItem(ctx, user.ID, "pen"), services.ErrCartItemNotFound)
+	})
+
+	t.Run("Checkout fails atomically when the total exceeds the balance", func(t *testing.T) {
+		require.NoError(t, cartService.AddItem(ctx, user.ID, "pen", 5))
+
+		_, err := cartService.Checkout(ctx, user.ID)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "does not have enough coins")
+
+		updatedUser, err := userRepo.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 100, updatedUser.Coins)
+
+		items, err := invRepo.GetAllByUser(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, items)
+
+		cart, err := cartService.GetCart(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Len(t, cart.Items, 2)
+	})
+
+	t.Run("Checkout buys everything and empties the cart", func(t *testing.T) {
+		require.NoError(t, cartService.RemoveItem(ctx, user.ID, "pen"))
+		require.NoError(t, cartService.AddItem(ctx, user.ID, "pen", 2))
+
+		resp, err := cartService.Checkout(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 80, resp.Spent)
+
+		updatedUser, err := userRepo.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 20, updatedUser.Coins)
+
+		cup, err := invRepo.GetByUserAndType(ctx, user.ID, "cup")
+		require.NoError(t, err)
+		require.NotNil(t, cup)
+		assert.Equal(t, 3, cup.Quantity)
+
+		pen, err := invRepo.GetByUserAndType(ctx, user.ID, "pen")
+		require.NoError(t, err)
+		require.NotNil(t, pen)
+		assert.Equal(t, 2, pen.Quantity)
+
+		txs, err := txRepo.GetTransactionsByType(ctx, user.ID, domain.Purchase)
+		require.NoError(t, err)
+		assert.Len(t, txs, 2)
+
+		balance, err := txRepo.GetAccountBalance(ctx, domain.UserAccountCode(user.ID))
+		require.NoError(t, err)
+		assert.Equal(t, -80, balance)
+
+		_, err = cartService.Checkout(ctx, user.ID)
+		assert.ErrorIs(t, err, services.ErrCartEmpty)
+	})
+}
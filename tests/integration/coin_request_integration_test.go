@@ -0,0 +1,163 @@
+package integration
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_CoinRequests(t *testing.T) {
+	ctx := context.Background()
+	db := setupIntegrationDB(t)
+
+	userRepo := repositories.NewUserRepository(db)
+	txRepo := repositories.NewTransactionRepository(db)
+	now := time.Now()
+	clock := func() time.Time { return now }
+	requestService := services.NewCoinRequestService(
+		repositories.NewCoinRequestRepository(db), userRepo, repositories.NewUnitOfWork(db), nil, time.Hour, clock)
+
+	requester := &domain.User{Username: "requester", PasswordHash: "irrelevant", Coins: 100}
+	payer := &domain.User{Username: "payer", PasswordHash: "irrelevant", Coins: 100}
+	require.NoError(t, userRepo.CreateUser(ctx, requester))
+	require.NoError(t, userRepo.CreateUser(ctx, payer))
+
+	t.Run("Accept transfers the coins once", func(t *testing.T) {
+		created, err := requestService.CreateRequest(ctx, requester.ID, payer.ID, 30, " pizza\n")
+		require.NoError(t, err)
+		assert.Equal(t, "requester", created.Requester)
+		assert.Equal(t, "payer", created.Payer)
+		assert.Equal(t, "pizza", created.Message)
+		assert.Equal(t, domain.CoinRequestPending, created.Status)
+
+		incoming, err := requestService.GetIncoming(ctx, payer.ID)
+		require.NoError(t, err)
+		require.Len(t, incoming, 1)
+		assert.Equal(t, created.ID, incoming[0].ID)
+
+		accepted, err := requestService.Accept(ctx, payer.ID, created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, domain.CoinRequestAccepted, accepted.Status)
+
+		_, err = requestService.Accept(ctx, payer.ID, created.ID)
+		assert.ErrorIs(t, err, services.ErrCoinRequestNotPending)
+
+		updatedPayer, err := userRepo.GetUserByID(ctx, payer.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 70, updatedPayer.Coins)
+		updatedRequester, err := userRepo.GetUserByID(ctx, requester.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 130, updatedRequester.Coins)
+
+		txs, err := txRepo.GetTransactionsByType(ctx, payer.ID, domain.Transfer)
+		require.NoError(t, err)
+		require.Len(t, txs, 1)
+		assert.Equal(t, "pizza", txs[0].Message)
+
+		var stored domain.CoinRequest
+		require.NoError(t, db.First(&stored, created.ID).Error)
+		require.NotNil(t, stored.TransactionID)
+		assert.Equal(t, txs[0].ID, *stored.TransactionID)
+
+		incoming, err = requestService.GetIncoming(ctx, payer.ID)
+		require.NoError(t, err)
+		assert.Empty(t, incoming)
+	})
+
+	t.Run("Only the payer can accept or decline", func(t *testing.T) {
+		created, err := requestService.CreateRequest(ctx, requester.ID, payer.ID, 10, "")
+		require.NoError(t, err)
+
+		_, err = requestService.Accept(ctx, requester.ID, created.ID)
+		assert.ErrorIs(t, err, services.ErrCoinRequestNotFound)
+		assert.ErrorIs(t, requestService.Decline(ctx, requester.ID, created.ID), services.ErrCoinRequestNotFound)
+		assert.ErrorIs(t, requestService.Cancel(ctx, payer.ID, created.ID), services.ErrCoinRequestNotFound)
+
+		require.NoError(t, requestService.Decline(ctx, payer.ID, created.ID))
+		_, err = requestService.Accept(ctx, payer.ID, created.ID)
+		assert.ErrorIs(t, err, services.ErrCoinRequestNotPending)
+	})
+
+	t.Run("Failed transfer leaves the request pending", func(t *testing.T) {
+		created, err := requestService.CreateRequest(ctx, requester.ID, payer.ID, 500, "")
+		require.NoError(t, err)
+
+		_, err = requestService.Accept(ctx, payer.ID, created.ID)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "does not have enough coins")
+
+		outgoing, err := requestService.GetOutgoing(ctx, requester.ID)
+		require.NoError(t, err)
+		require.NotEmpty(t, outgoing)
+		assert.Equal(t, created.ID, outgoing[0].ID)
+		assert.Equal(t, domain.CoinRequestPending, outgoing[0].Status)
+
+		require.NoError(t, requestService.Cancel(ctx, requester.ID, created.ID))
+	})
+
+	t.Run("Stale requests expire", func(t *testing.T) {
+		created, err := requestService.CreateRequest(ctx, requester.ID, payer.ID, 5, "")
+		require.NoError(t, err)
+
+		now = now.Add(time.Hour)
+
+		incoming, err := requestService.GetIncoming(ctx, payer.ID)
+		require.NoError(t, err)
+		assert.Empty(t, incoming)
+		_, err = requestService.Accept(ctx, payer.ID, created.ID)
+		assert.ErrorIs(t, err, services.ErrCoinRequestExpired)
+
+		expired, err := requestService.ExpireStale(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), expired)
+
+		outgoing, err := requestService.GetOutgoing(ctx, requester.ID)
+		require.NoError(t, err)
+		assert.Equal(t, domain.CoinRequestExpired, outgoing[0].Status)
+	})
+
+	t.Run("Invalid requests", func(t *testing.T) {
+		_, err := requestService.CreateRequest(ctx, requester.ID, requester.ID, 5, "")
+		assert.Error(t, err)
+		_, err = requestService.CreateRequest(ctx, requester.ID, payer.ID, 0, "")
+		assert.Error(t, err)
+	})
+}
+
+func TestIntegration_CoinRequests_ConcurrentAccept(t *testing.T) {
+	ctx := context.Background()
+	db := setupConcurrentIntegrationDB(t)
+
+	userRepo := repositories.NewUserRepository(db)
+	requestService := services.NewCoinRequestService(
+		repositories.NewCoinRequestRepository(db), userRepo, repositories.NewUnitOfWork(db), nil, 0, nil)
+
+	requester := &domain.User{Username: "requester", PasswordHash: "irrelevant", Coins: 0}
+	payer := &domain.User{Username: "payer", PasswordHash: "irrelevant", Coins: 1000}
+	require.NoError(t, userRepo.CreateUser(ctx, requester))
+	require.NoError(t, userRepo.CreateUser(ctx, payer))
+
+	created, err := requestService.CreateRequest(ctx, requester.ID, payer.ID, 100, "")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = requestService.Accept(ctx, payer.ID, created.ID)
+		}()
+	}
+	wg.Wait()
+
+	updatedPayer, err := userRepo.GetUserByID(ctx, payer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 900, updatedPayer.Coins)
+}
@@ -0,0 +1,103 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIntegration_ConcurrentTransfers_SerializationSmoke is a smoke test of many transfers
+// racing through the service. SQLite runs the transactions one at a time and ignores
+// FOR UPDATE, so it does not prove the row locking; the conditional debit is covered
+// by TestUserRepository_ChangeCoins.
+func TestIntegration_ConcurrentTransfers_SerializationSmoke(t *testing.T) {
+	ctx := context.Background()
+	db := setupConcurrentIntegrationDB(t)
+
+	userRepo := repositories.NewUserRepository(db)
+	txRepo := repositories.NewTransactionRepository(db)
+	transferService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
+
+	const (
+		usersCount     = 8
+		transfersCount = 400
+		initialCoins   = 100
+	)
+
+	users := make([]*domain.User, usersCount)
+	for i := range users {
+		users[i] = &domain.User{
+			Username:     fmt.Sprintf("user%d", i),
+			PasswordHash: "irrelevant",
+			Coins:        initialCoins,
+		}
+		require.NoError(t, userRepo.CreateUser(ctx, users[i]))
+	}
+
+	rnd := rand.New(rand.NewSource(42))
+	type transferReq struct {
+		from, to uint
+		amount   int
+	}
+	reqs := make([]transferReq, transfersCount)
+	for i := range reqs {
+		from := rnd.Intn(usersCount)
+		to := (from + 1 + rnd.Intn(usersCount-1)) % usersCount
+		reqs[i] = transferReq{from: users[from].ID, to: users[to].ID, amount: 1 + rnd.Intn(60)}
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for _, r := range reqs {
+		wg.Add(1)
+		go func(r transferReq) {
+			defer wg.Done()
+			err := transferService.TransferCoins(ctx, r.from, r.to, r.amount, services.TransferNote{})
+			if err != nil {
+				assert.Contains(t, err.Error(), "does not have enough coins")
+				return
+			}
+			mu.Lock()
+			succeeded++
+			mu.Unlock()
+		}(r)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, u := range users {
+		updated, err := userRepo.GetUserByID(ctx, u.ID)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, updated.Coins, 0, "balance of %s went negative", u.Username)
+		total += updated.Coins
+
+		txs, err := txRepo.GetUserTransactions(ctx, u.ID)
+		require.NoError(t, err)
+		expected := initialCoins
+		for _, tx := range txs {
+			if tx.FromUserID == u.ID {
+				expected -= tx.Amount
+			} else {
+				expected += tx.Amount
+			}
+		}
+		assert.Equal(t, expected, updated.Coins, "balance of %s does not match its transfers", u.Username)
+	}
+	assert.Equal(t, usersCount*initialCoins, total)
+
+	var txCount int64
+	require.NoError(t, db.Model(&domain.Transaction{}).Count(&txCount).Error)
+	assert.Equal(t, int64(succeeded), txCount)
+	assert.Positive(t, succeeded)
+}
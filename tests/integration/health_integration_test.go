@@ -0,0 +1,59 @@
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/handlers"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"avito-tech-go/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_HealthProbes(t *testing.T) {
+	db := setupIntegrationDB(t)
+	healthService := services.NewHealthService(repositories.NewHealthRepository(db, database.Models...))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/healthz", handlers.HealthzHandler())
+	r.GET("/readyz", handlers.ReadyzHandler(healthService))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	t.Run("Ready after migrations", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, get("/healthz").Code)
+		w := get("/readyz")
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	})
+
+	t.Run("Not ready while a table is missing", func(t *testing.T) {
+		require.NoError(t, db.Migrator().DropTable(&domain.AllowanceGrant{}))
+		t.Cleanup(func() { require.NoError(t, db.AutoMigrate(&domain.AllowanceGrant{})) })
+
+		w := get("/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Contains(t, w.Body.String(), "allowance_grants")
+		assert.Equal(t, http.StatusOK, get("/healthz").Code)
+	})
+
+	t.Run("Not ready when the database is closed", func(t *testing.T) {
+		sqlDB, err := db.DB()
+		require.NoError(t, err)
+		require.NoError(t, sqlDB.Close())
+
+		w := get("/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Contains(t, w.Body.String(), "database is unreachable")
+		assert.Equal(t, http.StatusOK, get("/healthz").Code)
+	})
+}
@@ -0,0 +1,160 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_History(t *testing.T) {
+	ctx := context.Background()
+	db := setupIntegrationDB(t)
+
+	userRepo := repositories.NewUserRepository(db)
+	invRepo := repositories.NewInventoryRepository(db)
+	txRepo := repositories.NewTransactionRepository(db)
+	userService := services.NewUserService(userRepo, invRepo, txRepo)
+
+	users := make(map[string]*domain.User)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		users[name] = &domain.User{Username: name, PasswordHash: "irrelevant", Coins: 1000}
+		require.NoError(t, userRepo.CreateUser(ctx, users[name]))
+	}
+	alice, bob, carol := users["alice"], users["bob"], users["carol"]
+
+	start := time.Date(2025, 3, 1, 10, 0, 0, 0, time.Local)
+	minute := 0
+	create := func(tx *domain.Transaction) {
+		tx.CreatedAt = start.Add(time.Duration(minute) * time.Minute)
+		minute++
+		require.NoError(t, txRepo.CreateTransaction(ctx, tx))
+	}
+	transfer := func(from, to *domain.User, amount int) {
+		create(&domain.Transaction{FromUserID: from.ID, ToUserID: &to.ID, Amount: amount, Type: domain.Transfer})
+	}
+
+	for i := 1; i <= 5; i++ {
+		transfer(alice, bob, i)
+	}
+	create(&domain.Transaction{FromUserID: bob.ID, ToUserID: &alice.ID, Amount: 10, Type: domain.Transfer, Message: "for the pizza", Category: "lunch"})
+	transfer(carol, alice, 20)
+	create(&domain.Transaction{FromUserID: alice.ID, Amount: 80, Type: domain.Purchase, ItemType: "t-shirt", Quantity: 1})
+	transfer(bob, alice, 30)
+	create(&domain.Transaction{FromUserID: alice.ID, Amount: 20, Type: domain.Purchase, ItemType: "cup", Quantity: 2})
+	transfer(bob, carol, 40)
+
+	t.Run("Pages cover the whole history newest first", func(t *testing.T) {
+		var (
+			entries []services.HistoryEntry
+			cursor  string
+			pages   int
+		)
+		for {
+			page, err := userService.GetHistory(ctx, alice.ID, services.HistoryRequest{Limit: 3, Cursor: cursor})
+			require.NoError(t, err)
+			entries = append(entries, page.Entries...)
+			pages++
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+
+		assert.Equal(t, 4, pages)
+		require.Len(t, entries, 10)
+		for i := 1; i < len(entries); i++ {
+			assert.True(t, entries[i-1].CreatedAt.After(entries[i].CreatedAt))
+		}
+
+		newest := entries[0]
+		assert.Equal(t, "purchase", newest.Type)
+		assert.Equal(t, "out", newest.Direction)
+		assert.Equal(t, "shop", newest.Counterparty)
+		assert.Equal(t, "cup", newest.Item)
+		assert.Equal(t, 2, newest.Quantity)
+		assert.NotZero(t, newest.ID)
+
+		received := entries[1]
+		assert.Equal(t, "in", received.Direction)
+		assert.Equal(t, "bob", received.Counterparty)
+		assert.Equal(t, 30, received.Amount)
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		count := func(req services.HistoryRequest) int {
+			req.Limit = services.MaxHistoryLimit
+			page, err := userService.GetHistory(ctx, alice.ID, req)
+			require.NoError(t, err)
+			return len(page.Entries)
+		}
+
+		from := start.Add(2 * time.Minute)
+		to := start.Add(6 * time.Minute)
+
+		assert.Equal(t, 2, count(services.HistoryRequest{Type: "purchase"}))
+		assert.Equal(t, 8, count(services.HistoryRequest{Type: "transfer"}))
+		assert.Equal(t, 3, count(services.HistoryRequest{Direction: "in"}))
+		assert.Equal(t, 7, count(services.HistoryRequest{Direction: "out"}))
+		assert.Equal(t, 7, count(services.HistoryRequest{Counterparty: "bob"}))
+		assert.Equal(t, 2, count(services.HistoryRequest{Counterparty: "bob", Direction: "in"}))
+		assert.Equal(t, 0, count(services.HistoryRequest{Counterparty: "nobody"}))
+		assert.Equal(t, 1, count(services.HistoryRequest{Category: "lunch"}))
+		assert.Equal(t, 4, count(services.HistoryRequest{From: &from, To: &to}))
+	})
+
+	t.Run("Composite indexes exist", func(t *testing.T) {
+		assert.True(t, db.Migrator().HasIndex(&domain.Transaction{}, "idx_transactions_from_created"))
+		assert.True(t, db.Migrator().HasIndex(&domain.Transaction{}, "idx_transactions_to_created"))
+	})
+
+	t.Run("Invalid queries", func(t *testing.T) {
+		for _, req := range []services.HistoryRequest{
+			{Type: "gift"},
+			{Direction: "sideways"},
+			{Limit: services.MaxHistoryLimit + 1},
+			{Cursor: "not a cursor"},
+		} {
+			_, err := userService.GetHistory(ctx, alice.ID, req)
+			assert.ErrorIs(t, err, services.ErrInvalidHistoryQuery)
+		}
+	})
+}
+
+func TestIntegration_Info_TransferNotes(t *testing.T) {
+	ctx := context.Background()
+	db := setupIntegrationDB(t)
+
+	userRepo := repositories.NewUserRepository(db)
+	txRepo := repositories.NewTransactionRepository(db)
+	userService := services.NewUserService(userRepo, repositories.NewInventoryRepository(db), txRepo)
+	transferService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
+
+	alice := &domain.User{Username: "alice", PasswordHash: "irrelevant", Coins: 1000}
+	bob := &domain.User{Username: "bob", PasswordHash: "irrelevant", Coins: 1000}
+	require.NoError(t, userRepo.CreateUser(ctx, alice))
+	require.NoError(t, userRepo.CreateUser(ctx, bob))
+
+	note := services.TransferNote{Message: "Thanks for the review!", Category: "thanks"}
+	require.NoError(t, transferService.TransferCoins(ctx, alice.ID, bob.ID, 50, note))
+
+	aliceInfo, err := userService.GetInfo(ctx, alice.ID)
+	require.NoError(t, err)
+	require.Len(t, aliceInfo.CoinHistory.Sent, 1)
+	assert.Equal(t, services.SentTransaction{ToUser: "bob", Amount: 50, Message: note.Message, Category: note.Category}, aliceInfo.CoinHistory.Sent[0])
+
+	bobInfo, err := userService.GetInfo(ctx, bob.ID)
+	require.NoError(t, err)
+	require.Len(t, bobInfo.CoinHistory.Received, 1)
+	assert.Equal(t, services.ReceivedTransaction{FromUser: "alice", Amount: 50, Message: note.Message, Category: note.Category}, bobInfo.CoinHistory.Received[0])
+
+	page, err := userService.GetHistory(ctx, bob.ID, services.HistoryRequest{Category: "THANKS"})
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, note.Message, page.Entries[0].Message)
+}
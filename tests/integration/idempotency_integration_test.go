@@ -0,0 +1,303 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/handlers"
+	"avito-tech-go/internal/middleware"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_Idempotency_SendCoin(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+	db := setupIntegrationDB(t)
+
+	userRepo := repositories.NewUserRepository(db)
+	txRepo := repositories.NewTransactionRepository(db)
+	idempotencyRepo := repositories.NewIdempotencyRepository(db)
+	transferService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
+	idempotencyService := services.NewIdempotencyService(idempotencyRepo, time.Hour)
+
+	alice := &domain.User{Username: "alice", PasswordHash: "irrelevant", Coins: 1000}
+	require.NoError(t, userRepo.CreateUser(ctx, alice))
+	bob := &domain.User{Username: "bob", PasswordHash: "irrelevant", Coins: 1000}
+	require.NoError(t, userRepo.CreateUser(ctx, bob))
+
+	r := gin.New()
+	r.POST("/api/sendCoin",
+		authenticatedAs(alice.ID),
+		middleware.IdempotencyMiddleware(idempotencyService),
+		handlers.SendCoinHandler(transferService, userRepo))
+
+	send := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/sendCoin", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	balanceOf := func(userID uint) int {
+		u, err := userRepo.GetUserByID(ctx, userID)
+		require.NoError(t, err)
+		return u.Coins
+	}
+
+	t.Run("Retry replays the original response", func(t *testing.T) {
+		first := send("key-1", `{"toUser":"bob","amount":100}`)
+		assert.Equal(t, http.StatusOK, first.Code)
+
+		second := send("key-1", `{"toUser":"bob","amount":100}`)
+		assert.Equal(t, http.StatusOK, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+
+		assert.Equal(t, 900, balanceOf(alice.ID))
+		assert.Equal(t, 1100, balanceOf(bob.ID))
+		txs, err := txRepo.GetUserTransactions(ctx, alice.ID)
+		require.NoError(t, err)
+		assert.Len(t, txs, 1)
+	})
+
+	t.Run("Key reused with a different body", func(t *testing.T) {
+		w := send("key-1", `{"toUser":"bob","amount":200}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Equal(t, 900, balanceOf(alice.ID))
+	})
+
+	t.Run("Failed request is replayed as well", func(t *testing.T) {
+		first := send("key-2", `{"toUser":"bob","amount":5000}`)
+		assert.Equal(t, http.StatusBadRequest, first.Code)
+
+		second := send("key-2", `{"toUser":"bob","amount":5000}`)
+		assert.Equal(t, http.StatusBadRequest, second.Code)
+		assert.Equal(t, first.Body.String(), second.Body.String())
+	})
+
+	t.Run("Requests without a key are not deduplicated", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("", `{"toUser":"bob","amount":10}`).Code)
+		assert.Equal(t, http.StatusOK, send("", `{"toUser":"bob","amount":10}`).Code)
+		assert.Equal(t, 880, balanceOf(alice.ID))
+	})
+
+	t.Run("Expired key runs the request again", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("key-3", `{"toUser":"bob","amount":1}`).Code)
+		require.NoError(t, db.Model(&domain.IdempotencyKey{}).
+			Where("idempotency_key = ?", "key-3").
+			Update("created_at", time.Now().Add(-2*time.Hour)).Error)
+
+		w := send("key-3", `{"toUser":"bob","amount":1}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, 878, balanceOf(alice.ID))
+	})
+
+	t.Run("Cleanup removes expired keys", func(t *testing.T) {
+		require.NoError(t, db.Model(&domain.IdempotencyKey{}).
+			Where("idempotency_key = ?", "key-1").
+			Update("created_at", time.Now().Add(-2*time.Hour)).Error)
+
+		removed, err := idempotencyService.Cleanup(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), removed)
+
+		record, err := idempotencyRepo.Get(ctx, alice.ID, "key-1")
+		require.NoError(t, err)
+		assert.Nil(t, record)
+	})
+}
+
+// unstoredIdempotencyService fails to store any response.
+type unstoredIdempotencyService struct {
+	services.IdempotencyService
+	completeCalls int
+}
+
+func (s *unstoredIdempotencyService) Complete(context.Context, uint, string, int, []byte) error {
+	s.completeCalls++
+	return errors.New("database is gone")
+}
+
+func TestIntegration_Idempotency_ResponseNotStored(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+	db := setupIntegrationDB(t)
+
+	userRepo := repositories.NewUserRepository(db)
+	transferService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
+	idempotencyService := &unstoredIdempotencyService{
+		IdempotencyService: services.NewIdempotencyService(repositories.NewIdempotencyRepository(db), time.Hour),
+	}
+
+	alice := &domain.User{Username: "alice", PasswordHash: "irrelevant", Coins: 1000}
+	require.NoError(t, userRepo.CreateUser(ctx, alice))
+	require.NoError(t, userRepo.CreateUser(ctx, &domain.User{Username: "bob", PasswordHash: "irrelevant", Coins: 1000}))
+
+	r := gin.New()
+	r.POST("/api/sendCoin",
+		authenticatedAs(alice.ID),
+		middleware.IdempotencyMiddleware(idempotencyService),
+		handlers.SendCoinHandler(transferService, userRepo))
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/sendCoin", strings.NewReader(`{"toUser":"bob","amount":100}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(middleware.IdempotencyKeyHeader, "key-1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send().Code)
+	assert.Equal(t, 3, idempotencyService.completeCalls)
+
+	// The transfer has been made, so the retry must not run it again.
+	assert.Equal(t, http.StatusConflict, send().Code)
+	user, err := userRepo.GetUserByID(ctx, alice.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 900, user.Coins)
+}
+
+func TestIntegration_Idempotency_HandlerOutcomes(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+	db := setupIntegrationDB(t)
+
+	userRepo := repositories.NewUserRepository(db)
+	idempotencyService := services.NewIdempotencyService(repositories.NewIdempotencyRepository(db), time.Hour)
+	alice := &domain.User{Username: "alice", PasswordHash: "irrelevant", Coins: 1000}
+	require.NoError(t, userRepo.CreateUser(ctx, alice))
+
+	calls := 0
+	r := gin.New()
+	r.Use(middleware.RecoveryMiddleware(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	r.POST("/panics-once", authenticatedAs(alice.ID), middleware.IdempotencyMiddleware(idempotencyService), func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+	var hangUp context.CancelFunc
+	r.POST("/cancelled", authenticatedAs(alice.ID), func(c *gin.Context) {
+		var reqCtx context.Context
+		reqCtx, hangUp = context.WithCancel(c.Request.Context())
+		c.Request = c.Request.WithContext(reqCtx)
+	}, middleware.IdempotencyMiddleware(idempotencyService), func(c *gin.Context) {
+		// The client hangs up once the operation is done.
+		hangUp()
+		c.JSON(http.StatusOK, gin.H{"done": true})
+	})
+
+	send := func(path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Panicking handler releases the key", func(t *testing.T) {
+		assert.Equal(t, http.StatusInternalServerError, send("/panics-once", "key-panic").Code)
+
+		w := send("/panics-once", "key-panic")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+		assert.Equal(t, 2, calls)
+	})
+
+	t.Run("Response is stored after the request context is done", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, send("/cancelled", "key-cancelled").Code)
+
+		w := send("/cancelled", "key-cancelled")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	})
+}
+
+// flakyUnitOfWork fails the first failures transactions as a lost connection would.
+type flakyUnitOfWork struct {
+	repositories.UnitOfWork
+	failures int
+}
+
+func (u *flakyUnitOfWork) Do(ctx context.Context, fn func(repos *repositories.Repositories) error) error {
+	if u.failures > 0 {
+		u.failures--
+		return errors.New("connection reset by peer")
+	}
+	return u.UnitOfWork.Do(ctx, fn)
+}
+
+func TestIntegration_Idempotency_RetryAfterServerError(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+	db := setupIntegrationDB(t)
+
+	userRepo := repositories.NewUserRepository(db)
+	merchRepo := repositories.NewMerchRepository(db)
+	uow := &flakyUnitOfWork{UnitOfWork: repositories.NewUnitOfWork(db)}
+	transferService := services.NewTransactionService(uow, nil)
+	merchService := services.NewMerchService(merchRepo, userRepo, uow)
+	idempotencyService := services.NewIdempotencyService(repositories.NewIdempotencyRepository(db), time.Hour)
+
+	require.NoError(t, merchRepo.CreateMerchItem(ctx, &domain.MerchItem{ItemType: "cup", Price: 20}))
+	alice := &domain.User{Username: "alice", PasswordHash: "irrelevant", Coins: 1000}
+	require.NoError(t, userRepo.CreateUser(ctx, alice))
+	require.NoError(t, userRepo.CreateUser(ctx, &domain.User{Username: "bob", PasswordHash: "irrelevant", Coins: 1000}))
+
+	r := gin.New()
+	idempotencyMw := middleware.IdempotencyMiddleware(idempotencyService)
+	r.POST("/api/sendCoin", authenticatedAs(alice.ID), idempotencyMw, handlers.SendCoinHandler(transferService, userRepo))
+	r.POST("/api/buy", authenticatedAs(alice.ID), idempotencyMw, handlers.BuyMerchItemsHandler(merchService))
+
+	send := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(middleware.IdempotencyKeyHeader, "key"+path)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	coins := func() int {
+		user, err := userRepo.GetUserByID(ctx, alice.ID)
+		require.NoError(t, err)
+		return user.Coins
+	}
+
+	for _, tc := range []struct {
+		path, body string
+		coinsAfter int
+	}{
+		{"/api/sendCoin", `{"toUser":"bob","amount":100}`, 900},
+		{"/api/buy", `{"items":[{"item":"cup","quantity":2}]}`, 860},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			uow.failures = 1
+			assert.Equal(t, http.StatusInternalServerError, send(tc.path, tc.body).Code)
+
+			// The failure is not stored, so the retry runs the operation.
+			w := send(tc.path, tc.body)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+			assert.Equal(t, tc.coinsAfter, coins())
+		})
+	}
+}
@@ -1,22 +1,56 @@
 package integration
 
 import (
-	"avito-tech-go/internal/domain"
+	"avito-tech-go/pkg/database"
 	"fmt"
+	"github.com/gin-gonic/gin"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"path/filepath"
 	"testing"
 )
 
 func setupIntegrationDB(t *testing.T) *gorm.DB {
 	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	return openIntegrationDB(t, dsn)
+}
+
+// setupConcurrentIntegrationDB opens a file-backed database that tolerates many
+// parallel writers: every transaction takes the write lock up front and waiters
+// block on the busy timeout instead of failing with "database is locked". The
+// transactions are therefore serialized, so tests on it are smoke tests of
+// concurrent use, not proof of the locking done for PostgreSQL.
+func setupConcurrentIntegrationDB(t *testing.T) *gorm.DB {
+	path := filepath.Join(t.TempDir(), "concurrency.db")
+	dsn := fmt.Sprintf("file:%s?_busy_timeout=30000&_txlock=immediate&_journal_mode=WAL", path)
+	db := openIntegrationDB(t, dsn)
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(16)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	return db
+}
+
+func openIntegrationDB(t *testing.T, dsn string) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 	if err != nil {
-		t.Fatalf("failed to open in-memory sqlite database: %v", err)
+		t.Fatalf("failed to open sqlite database: %v", err)
 	}
-	err = db.AutoMigrate(&domain.User{}, &domain.MerchItem{}, &domain.InventoryItem{}, &domain.Transaction{})
+	err = database.Migrate(db)
 	if err != nil {
 		t.Fatalf("failed to migrate models: %v", err)
 	}
 	return db
 }
+
+// authenticatedAs stands in for JWTAuthMiddleware in HTTP-level tests.
+func authenticatedAs(userID uint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("userID", userID)
+		c.Next()
+	}
+}
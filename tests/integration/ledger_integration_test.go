@@ -0,0 +1,136 @@
+package integration
+
+import (
+	"context"
+	"testing"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_Ledger(t *testing.T) {
+	ctx := context.Background()
+	db := setupIntegrationDB(t)
+
+	uow := repositories.NewUnitOfWork(db)
+	userRepo := repositories.NewUserRepository(db)
+	txRepo := repositories.NewTransactionRepository(db)
+	merchRepo := repositories.NewMerchRepository(db)
+
+	authService := services.NewAuthService(userRepo, repositories.NewTokenRepository(db), uow, services.AuthOptions{JWTSecret: jwtSecret})
+	transferService := services.NewTransactionService(uow, nil)
+	merchService := services.NewMerchService(merchRepo, userRepo, uow)
+	ledgerService := services.NewLedgerService(uow, txRepo)
+
+	require.NoError(t, merchRepo.CreateMerchItem(ctx, &domain.MerchItem{ItemType: "cup", Price: 20}))
+
+	_, err := authService.Register(ctx, "alice", "password")
+	require.NoError(t, err)
+	_, err = authService.Register(ctx, "bob", "password")
+	require.NoError(t, err)
+
+	alice, err := userRepo.GetUserByName(ctx, "alice")
+	require.NoError(t, err)
+	bob, err := userRepo.GetUserByName(ctx, "bob")
+	require.NoError(t, err)
+
+	t.Run("Registration issues the opening balance", func(t *testing.T) {
+		balance, err := txRepo.GetAccountBalance(ctx, domain.UserAccountCode(alice.ID))
+		require.NoError(t, err)
+		assert.Equal(t, domain.InitialCoins, balance)
+
+		issued, err := txRepo.GetAccountBalance(ctx, domain.IssuanceAccountCode)
+		require.NoError(t, err)
+		assert.Equal(t, -2*domain.InitialCoins, issued)
+	})
+
+	t.Run("Transfers and purchases are posted", func(t *testing.T) {
+		require.NoError(t, transferService.TransferCoins(ctx, alice.ID, bob.ID, 150, services.TransferNote{}))
+		require.NoError(t, merchService.BuyItem(ctx, bob.ID, "cup"))
+
+		aliceBalance, err := txRepo.GetAccountBalance(ctx, domain.UserAccountCode(alice.ID))
+		require.NoError(t, err)
+		assert.Equal(t, 850, aliceBalance)
+
+		bobBalance, err := txRepo.GetAccountBalance(ctx, domain.UserAccountCode(bob.ID))
+		require.NoError(t, err)
+		assert.Equal(t, 1130, bobBalance)
+
+		shopBalance, err := txRepo.GetAccountBalance(ctx, domain.ShopAccountCode)
+		require.NoError(t, err)
+		assert.Equal(t, 20, shopBalance)
+
+		report, err := ledgerService.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.True(t, report.Consistent())
+	})
+
+	t.Run("Reconciliation detects drift of the cached balance", func(t *testing.T) {
+		require.NoError(t, userRepo.ChangeCoins(ctx, bob.ID, 5))
+
+		report, err := ledgerService.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.False(t, report.Consistent())
+		require.Len(t, report.Drifts, 1)
+		assert.Equal(t, domain.BalanceDrift{
+			UserID:      bob.ID,
+			Username:    "bob",
+			CachedCoins: 1135,
+			LedgerCoins: 1130,
+		}, report.Drifts[0])
+		assert.Zero(t, report.LedgerTotal)
+		assert.Empty(t, report.UnbalancedTransactions)
+
+		require.NoError(t, userRepo.ChangeCoins(ctx, bob.ID, -5))
+	})
+
+	t.Run("Users created before the ledger get an opening balance", func(t *testing.T) {
+		legacy := &domain.User{Username: "legacy", PasswordHash: "irrelevant", Coins: 420}
+		require.NoError(t, userRepo.CreateUser(ctx, legacy))
+
+		report, err := ledgerService.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.Len(t, report.Drifts, 1)
+
+		opened, err := ledgerService.OpenMissingAccounts(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, opened)
+
+		report, err = ledgerService.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.True(t, report.Consistent())
+
+		opened, err = ledgerService.OpenMissingAccounts(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, opened)
+	})
+
+	t.Run("Account opened after the lookup is not credited again", func(t *testing.T) {
+		legacy, err := userRepo.GetUserByName(ctx, "legacy")
+		require.NoError(t, err)
+		// The lookup still lists the user, as it would if another instance opened the
+		// account between the lookup and the lock.
+		stale := services.NewLedgerService(uow, &staleAccountsRepository{TransactionRepository: txRepo, ids: []uint{legacy.ID}})
+
+		opened, err := stale.OpenMissingAccounts(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, opened)
+
+		balance, err := txRepo.GetAccountBalance(ctx, domain.UserAccountCode(legacy.ID))
+		require.NoError(t, err)
+		assert.Equal(t, 420, balance)
+	})
+}
+
+// staleAccountsRepository reports users without a ledger account from an outdated lookup.
+type staleAccountsRepository struct {
+	repositories.TransactionRepository
+	ids []uint
+}
+
+func (r *staleAccountsRepository) GetUserIDsWithoutAccount(context.Context) ([]uint, error) {
+	return r.ids, nil
+}
@@ -0,0 +1,165 @@
+package integration
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/handlers"
+	"avito-tech-go/internal/middleware"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"avito-tech-go/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_MerchAdmin(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+	db := setupIntegrationDB(t)
+
+	uow := repositories.NewUnitOfWork(db)
+	userRepo := repositories.NewUserRepository(db)
+	merchRepo := repositories.NewMerchRepository(db)
+	invRepo := repositories.NewInventoryRepository(db)
+	authService := services.NewAuthService(userRepo, repositories.NewTokenRepository(db), uow, services.AuthOptions{
+		JWTSecret:      jwtSecret,
+		AdminUsernames: []string{"boss"},
+	})
+	merchService := services.NewMerchService(merchRepo, userRepo, uow)
+
+	adminTokens, err := authService.Register(ctx, "boss", "password")
+	require.NoError(t, err)
+	userTokens, err := authService.Register(ctx, "employee", "password")
+	require.NoError(t, err)
+	employee, err := userRepo.GetUserByName(ctx, "employee")
+	require.NoError(t, err)
+
+	r := gin.New()
+	admin := r.Group("/api/admin", middleware.JWTAuthMiddleware(jwtSecret, authService), middleware.AdminOnlyMiddleware(userRepo))
+	admin.POST("/merch", handlers.CreateMerchItemHandler(merchService))
+	admin.PUT("/merch/:item", handlers.UpdateMerchItemHandler(merchService))
+	admin.DELETE("/merch/:item", handlers.RetireMerchItemHandler(merchService))
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Regular users are rejected", func(t *testing.T) {
+		w := do(http.MethodPost, "/api/admin/merch", userTokens.AccessToken, `{"item":"sticker","price":5}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		item, err := merchRepo.GetMerchItemByType(ctx, "sticker")
+		require.NoError(t, err)
+		assert.Nil(t, item)
+	})
+
+	t.Run("Admin adds and reprices an item", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, do(http.MethodPost, "/api/admin/merch", adminTokens.AccessToken, `{"item":"sticker","price":5}`).Code)
+		assert.Equal(t, http.StatusConflict, do(http.MethodPost, "/api/admin/merch", adminTokens.AccessToken, `{"item":"sticker","price":5}`).Code)
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/admin/merch", adminTokens.AccessToken, `{"item":"badge","price":-1}`).Code)
+
+		assert.Equal(t, http.StatusOK, do(http.MethodPut, "/api/admin/merch/sticker", adminTokens.AccessToken, `{"price":7}`).Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/api/admin/merch/unknown", adminTokens.AccessToken, `{"price":7}`).Code)
+
+		item, err := merchRepo.GetMerchItemByType(ctx, "sticker")
+		require.NoError(t, err)
+		require.NotNil(t, item)
+		assert.Equal(t, 7, item.Price)
+	})
+
+	t.Run("Retired item keeps inventory but leaves the shop", func(t *testing.T) {
+		require.NoError(t, merchService.BuyItem(ctx, employee.ID, "sticker"))
+
+		assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/api/admin/merch/sticker", adminTokens.AccessToken, "").Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/admin/merch/sticker", adminTokens.AccessToken, "").Code)
+
+		inv, err := invRepo.GetByUserAndType(ctx, employee.ID, "sticker")
+		require.NoError(t, err)
+		require.NotNil(t, inv)
+		assert.Equal(t, 1, inv.Quantity)
+
+		catalog, err := merchService.GetCatalog(ctx, employee.ID)
+		require.NoError(t, err)
+		for _, item := range catalog.Items {
+			assert.NotEqual(t, "sticker", item.Type)
+		}
+
+		err = merchService.BuyItem(ctx, employee.ID, "sticker")
+		assert.Error(t, err)
+	})
+
+	t.Run("Seeding does not resurrect retired items", func(t *testing.T) {
+		require.NoError(t, merchRepo.CreateMerchItem(ctx, &domain.MerchItem{ItemType: "pen", Price: 10}))
+		require.NoError(t, merchService.RetireItem(ctx, "pen"))
+
+		require.NoError(t, database.SeedMerch(db))
+
+		item, err := merchRepo.GetMerchItemByType(ctx, "pen")
+		require.NoError(t, err)
+		assert.Nil(t, item)
+	})
+
+	t.Run("Re-adding a retired item restores it", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, do(http.MethodPost, "/api/admin/merch", adminTokens.AccessToken, `{"item":"sticker","price":9}`).Code)
+
+		item, err := merchRepo.GetMerchItemByType(ctx, "sticker")
+		require.NoError(t, err)
+		require.NotNil(t, item)
+		assert.Equal(t, 9, item.Price)
+	})
+
+	t.Run("Demoted admin is rejected before the token expires", func(t *testing.T) {
+		require.NoError(t, userRepo.SyncAdmins(ctx, nil))
+
+		w := do(http.MethodPut, "/api/admin/merch/sticker", adminTokens.AccessToken, `{"price":11}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		item, err := merchRepo.GetMerchItemByType(ctx, "sticker")
+		require.NoError(t, err)
+		require.NotNil(t, item)
+		assert.Equal(t, 9, item.Price)
+	})
+}
+
+func TestIntegration_SyncAdmins(t *testing.T) {
+	ctx := context.Background()
+	db := setupIntegrationDB(t)
+	userRepo := repositories.NewUserRepository(db)
+
+	for _, user := range []*domain.User{
+		{Username: "boss", PasswordHash: "irrelevant", Role: domain.RoleAdmin},
+		{Username: "former-boss", PasswordHash: "irrelevant", Role: domain.RoleAdmin},
+		{Username: "employee", PasswordHash: "irrelevant", Role: domain.RoleUser},
+	} {
+		require.NoError(t, userRepo.CreateUser(ctx, user))
+	}
+	roleOf := func(username string) string {
+		user, err := userRepo.GetUserByName(ctx, username)
+		require.NoError(t, err)
+		return user.Role
+	}
+
+	t.Run("Listed users are promoted and unlisted admins demoted", func(t *testing.T) {
+		require.NoError(t, userRepo.SyncAdmins(ctx, []string{"boss", "employee"}))
+		assert.Equal(t, domain.RoleAdmin, roleOf("boss"))
+		assert.Equal(t, domain.RoleUser, roleOf("former-boss"))
+		assert.Equal(t, domain.RoleAdmin, roleOf("employee"))
+	})
+
+	t.Run("Empty list demotes every admin", func(t *testing.T) {
+		require.NoError(t, userRepo.SyncAdmins(ctx, nil))
+		assert.Equal(t, domain.RoleUser, roleOf("boss"))
+		assert.Equal(t, domain.RoleUser, roleOf("employee"))
+	})
+}
@@ -0,0 +1,97 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/handlers"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_MerchCatalog(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+	db := setupIntegrationDB(t)
+
+	merchRepo := repositories.NewMerchRepository(db)
+	userRepo := repositories.NewUserRepository(db)
+	merchService := services.NewMerchService(merchRepo, userRepo, repositories.NewUnitOfWork(db))
+
+	require.NoError(t, merchRepo.CreateMerchItem(ctx, &domain.MerchItem{ItemType: "pen", Price: 10}))
+	require.NoError(t, merchRepo.CreateMerchItem(ctx, &domain.MerchItem{ItemType: "hoody", Price: 300}))
+
+	user := &domain.User{Username: "shopper", PasswordHash: "irrelevant", Coins: 100}
+	require.NoError(t, userRepo.CreateUser(ctx, user))
+
+	r := gin.New()
+	r.GET("/api/merch", authenticatedAs(user.ID), handlers.MerchCatalogHandler(merchService))
+	r.GET("/api/merch/:item", authenticatedAs(user.ID), handlers.MerchItemHandler(merchService))
+
+	get := func(path, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Catalog lists items sorted by type", func(t *testing.T) {
+		w := get("/api/merch", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotEmpty(t, w.Header().Get("ETag"))
+
+		var catalog services.CatalogResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &catalog))
+		assert.Equal(t, 100, catalog.Coins)
+		assert.Equal(t, []services.CatalogItem{
+			{Type: "hoody", Price: 300, Affordable: false, InStock: true},
+			{Type: "pen", Price: 10, Affordable: true, InStock: true},
+		}, catalog.Items)
+	})
+
+	t.Run("Matching If-None-Match returns 304", func(t *testing.T) {
+		etag := get("/api/merch", "").Header().Get("ETag")
+
+		w := get("/api/merch", etag)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+
+		assert.Equal(t, http.StatusNotModified, get("/api/merch", `"other", W/`+etag).Code)
+	})
+
+	t.Run("ETag changes with price and balance", func(t *testing.T) {
+		etag := get("/api/merch", "").Header().Get("ETag")
+
+		require.NoError(t, merchRepo.UpdateMerchItem(ctx, &domain.MerchItem{ItemType: "pen", Price: 15}))
+		priceETag := get("/api/merch", etag).Header().Get("ETag")
+		assert.NotEqual(t, etag, priceETag)
+
+		require.NoError(t, userRepo.ChangeCoins(ctx, user.ID, 500))
+		w := get("/api/merch", priceETag)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, priceETag, w.Header().Get("ETag"))
+	})
+
+	t.Run("Single item", func(t *testing.T) {
+		w := get("/api/merch/pen", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var item services.CatalogItem
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &item))
+		assert.Equal(t, services.CatalogItem{Type: "pen", Price: 15, Affordable: true, InStock: true}, item)
+
+		assert.Equal(t, http.StatusNotModified, get("/api/merch/pen", w.Header().Get("ETag")).Code)
+		assert.Equal(t, http.StatusNotFound, get("/api/merch/unknown", "").Code)
+	})
+}
@@ -1,6 +1,7 @@
 package integration
 
 import (
+	"context"
 	"testing"
 
 	"avito-tech-go/internal/domain"
@@ -10,6 +11,7 @@ import (
 )
 
 func TestIntegration_MerchPurchase_NewItem(t *testing.T) {
+	ctx := context.Background()
 	db := setupIntegrationDB(t)
 
 	merchRepo := repositories.NewMerchRepository(db)
@@ -21,7 +23,7 @@ func TestIntegration_MerchPurchase_NewItem(t *testing.T) {
 		ItemType: "t-shirt",
 		Price:    80,
 	}
-	err := merchRepo.CreateMerchItem(merchItem)
+	err := merchRepo.CreateMerchItem(ctx, merchItem)
 	assert.NoError(t, err)
 
 	user := &domain.User{
@@ -29,25 +31,25 @@ func TestIntegration_MerchPurchase_NewItem(t *testing.T) {
 		PasswordHash: "irrelevant",
 		Coins:        100,
 	}
-	err = userRepo.CreateUser(user)
+	err = userRepo.CreateUser(ctx, user)
 	assert.NoError(t, err)
 
-	merchService := services.NewMerchService(merchRepo, userRepo, txRepo, invRepo, db)
+	merchService := services.NewMerchService(merchRepo, userRepo, repositories.NewUnitOfWork(db))
 
-	err = merchService.BuyItem(user.ID, "t-shirt")
+	err = merchService.BuyItem(ctx, user.ID, "t-shirt")
 	assert.NoError(t, err)
 
-	updatedUser, err := userRepo.GetUserByID(user.ID)
+	updatedUser, err := userRepo.GetUserByID(ctx, user.ID)
 	assert.NoError(t, err)
 	expectedCoins := user.Coins - merchItem.Price
 	assert.Equal(t, expectedCoins, updatedUser.Coins)
 
-	invItem, err := invRepo.GetByUserAndType(user.ID, "t-shirt")
+	invItem, err := invRepo.GetByUserAndType(ctx, user.ID, "t-shirt")
 	assert.NoError(t, err)
 	assert.NotNil(t, invItem)
 	assert.Equal(t, 1, invItem.Quantity)
 
-	txs, err := txRepo.GetUserTransactions(user.ID)
+	txs, err := txRepo.GetUserTransactions(ctx, user.ID)
 	assert.NoError(t, err)
 	assert.Len(t, txs, 1)
 	txRecord := txs[0]
@@ -58,6 +60,7 @@ func TestIntegration_MerchPurchase_NewItem(t *testing.T) {
 }
 
 func TestIntegration_MerchPurchase_ExistingItem(t *testing.T) {
+	ctx := context.Background()
 	db := setupIntegrationDB(t)
 
 	merchRepo := repositories.NewMerchRepository(db)
@@ -69,7 +72,7 @@ func TestIntegration_MerchPurchase_ExistingItem(t *testing.T) {
 		ItemType: "t-shirt",
 		Price:    80,
 	}
-	err := merchRepo.CreateMerchItem(merchItem)
+	err := merchRepo.CreateMerchItem(ctx, merchItem)
 	assert.NoError(t, err)
 
 	user := &domain.User{
@@ -77,7 +80,7 @@ func TestIntegration_MerchPurchase_ExistingItem(t *testing.T) {
 		PasswordHash: "irrelevant",
 		Coins:        300,
 	}
-	err = userRepo.CreateUser(user)
+	err = userRepo.CreateUser(ctx, user)
 	assert.NoError(t, err)
 
 	invItem := &domain.InventoryItem{
@@ -85,25 +88,25 @@ func TestIntegration_MerchPurchase_ExistingItem(t *testing.T) {
 		ItemType: "t-shirt",
 		Quantity: 1,
 	}
-	err = invRepo.CreateItem(invItem)
+	err = invRepo.CreateItem(ctx, invItem)
 	assert.NoError(t, err)
 
-	merchService := services.NewMerchService(merchRepo, userRepo, txRepo, invRepo, db)
+	merchService := services.NewMerchService(merchRepo, userRepo, repositories.NewUnitOfWork(db))
 
-	err = merchService.BuyItem(user.ID, "t-shirt")
+	err = merchService.BuyItem(ctx, user.ID, "t-shirt")
 	assert.NoError(t, err)
 
-	updatedUser, err := userRepo.GetUserByID(user.ID)
+	updatedUser, err := userRepo.GetUserByID(ctx, user.ID)
 	assert.NoError(t, err)
 	expectedCoins := user.Coins - merchItem.Price
 	assert.Equal(t, expectedCoins, updatedUser.Coins)
 
-	updatedInvItem, err := invRepo.GetByUserAndType(user.ID, "t-shirt")
+	updatedInvItem, err := invRepo.GetByUserAndType(ctx, user.ID, "t-shirt")
 	assert.NoError(t, err)
 	assert.NotNil(t, updatedInvItem)
 	assert.Equal(t, 2, updatedInvItem.Quantity)
 
-	txs, err := txRepo.GetUserTransactions(user.ID)
+	txs, err := txRepo.GetUserTransactions(ctx, user.ID)
 	assert.NoError(t, err)
 	assert.Len(t, txs, 1)
 	txRecord := txs[0]
@@ -114,6 +117,7 @@ func TestIntegration_MerchPurchase_ExistingItem(t *testing.T) {
 }
 
 func TestIntegration_MerchPurchase_InsufficientFunds(t *testing.T) {
+	ctx := context.Background()
 	db := setupIntegrationDB(t)
 
 	merchRepo := repositories.NewMerchRepository(db)
@@ -125,34 +129,35 @@ func TestIntegration_MerchPurchase_InsufficientFunds(t *testing.T) {
 		ItemType: "t-shirt",
 		Price:    1500,
 	}
-	err := merchRepo.CreateMerchItem(merchItem)
+	err := merchRepo.CreateMerchItem(ctx, merchItem)
 	assert.NoError(t, err)
 
 	user := &domain.User{
 		Username:     "insufficient",
 		PasswordHash: "irrelevant",
 	}
-	err = userRepo.CreateUser(user)
+	err = userRepo.CreateUser(ctx, user)
 	assert.NoError(t, err)
 
-	merchService := services.NewMerchService(merchRepo, userRepo, txRepo, invRepo, db)
-	err = merchService.BuyItem(user.ID, "t-shirt")
+	merchService := services.NewMerchService(merchRepo, userRepo, repositories.NewUnitOfWork(db))
+	err = merchService.BuyItem(ctx, user.ID, "t-shirt")
 	assert.Error(t, err)
 
-	updatedUser, err := userRepo.GetUserByID(user.ID)
+	updatedUser, err := userRepo.GetUserByID(ctx, user.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, 1000, updatedUser.Coins)
 
-	invItem, err := invRepo.GetByUserAndType(user.ID, "t-shirt")
+	invItem, err := invRepo.GetByUserAndType(ctx, user.ID, "t-shirt")
 	assert.NoError(t, err)
 	assert.Nil(t, invItem)
 
-	txs, err := txRepo.GetUserTransactions(user.ID)
+	txs, err := txRepo.GetUserTransactions(ctx, user.ID)
 	assert.NoError(t, err)
 	assert.Len(t, txs, 0)
 }
 
 func TestIntegration_MerchPurchase_InvalidItem(t *testing.T) {
+	ctx := context.Background()
 	db := setupIntegrationDB(t)
 
 	merchRepo := repositories.NewMerchRepository(db)
@@ -165,27 +170,28 @@ func TestIntegration_MerchPurchase_InvalidItem(t *testing.T) {
 		PasswordHash: "irrelevant",
 		Coins:        200,
 	}
-	err := userRepo.CreateUser(user)
+	err := userRepo.CreateUser(ctx, user)
 	assert.NoError(t, err)
 
-	merchService := services.NewMerchService(merchRepo, userRepo, txRepo, invRepo, db)
-	err = merchService.BuyItem(user.ID, "non-existent-item")
+	merchService := services.NewMerchService(merchRepo, userRepo, repositories.NewUnitOfWork(db))
+	err = merchService.BuyItem(ctx, user.ID, "non-existent-item")
 	assert.Error(t, err)
 
-	updatedUser, err := userRepo.GetUserByID(user.ID)
+	updatedUser, err := userRepo.GetUserByID(ctx, user.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, user.Coins, updatedUser.Coins)
 
-	invItem, err := invRepo.GetByUserAndType(user.ID, "non-existent-item")
+	invItem, err := invRepo.GetByUserAndType(ctx, user.ID, "non-existent-item")
 	assert.NoError(t, err)
 	assert.Nil(t, invItem)
 
-	txs, err := txRepo.GetUserTransactions(user.ID)
+	txs, err := txRepo.GetUserTransactions(ctx, user.ID)
 	assert.NoError(t, err)
 	assert.Len(t, txs, 0)
 }
 
 func TestIntegration_MerchPurchase_ExactFunds(t *testing.T) {
+	ctx := context.Background()
 	db := setupIntegrationDB(t)
 
 	merchRepo := repositories.NewMerchRepository(db)
@@ -197,7 +203,7 @@ func TestIntegration_MerchPurchase_ExactFunds(t *testing.T) {
 		ItemType: "t-shirt",
 		Price:    80,
 	}
-	err := merchRepo.CreateMerchItem(merchItem)
+	err := merchRepo.CreateMerchItem(ctx, merchItem)
 	assert.NoError(t, err)
 
 	user := &domain.User{
@@ -205,24 +211,24 @@ func TestIntegration_MerchPurchase_ExactFunds(t *testing.T) {
 		PasswordHash: "irrelevant",
 		Coins:        80,
 	}
-	err = userRepo.CreateUser(user)
+	err = userRepo.CreateUser(ctx, user)
 	assert.NoError(t, err)
 
-	merchService := services.NewMerchService(merchRepo, userRepo, txRepo, invRepo, db)
-	err = merchService.BuyItem(user.ID, "t-shirt")
+	merchService := services.NewMerchService(merchRepo, userRepo, repositories.NewUnitOfWork(db))
+	err = merchService.BuyItem(ctx, user.ID, "t-shirt")
 	assert.NoError(t, err)
 
-	updatedUser, err := userRepo.GetUserByID(user.ID)
+	updatedUser, err := userRepo.GetUserByID(ctx, user.ID)
 	assert.NoError(t, err)
 	expectedCoins := user.Coins - merchItem.Price
 	assert.Equal(t, expectedCoins, updatedUser.Coins)
 
-	invItem, err := invRepo.GetByUserAndType(user.ID, "t-shirt")
+	invItem, err := invRepo.GetByUserAndType(ctx, user.ID, "t-shirt")
 	assert.NoError(t, err)
 	assert.NotNil(t, invItem)
 	assert.Equal(t, 1, invItem.Quantity)
 
-	txs, err := txRepo.GetUserTransactions(user.ID)
+	txs, err := txRepo.GetUserTransactions(ctx, user.ID)
 	assert.NoError(t, err)
 	assert.Len(t, txs, 1)
 	txRecord := txs[0]
@@ -0,0 +1,119 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_MerchStock_ParallelPurchases(t *testing.T) {
+	ctx := context.Background()
+	db := setupConcurrentIntegrationDB(t)
+
+	merchRepo := repositories.NewMerchRepository(db)
+	userRepo := repositories.NewUserRepository(db)
+	invRepo := repositories.NewInventoryRepository(db)
+	merchService := services.NewMerchService(merchRepo, userRepo, repositories.NewUnitOfWork(db))
+
+	const (
+		stock   = 7
+		buyers  = 60
+		perUser = 3
+	)
+
+	initial := stock
+	require.NoError(t, merchRepo.CreateMerchItem(ctx, &domain.MerchItem{ItemType: "pink-hoody", Price: 10, Stock: &initial}))
+
+	users := make([]*domain.User, buyers)
+	for i := range users {
+		users[i] = &domain.User{Username: fmt.Sprintf("buyer%d", i), PasswordHash: "irrelevant", Coins: 1000}
+		require.NoError(t, userRepo.CreateUser(ctx, users[i]))
+	}
+
+	var (
+		wg         sync.WaitGroup
+		sold       atomic.Int64
+		outOfStock atomic.Int64
+	)
+	for _, u := range users {
+		for i := 0; i < perUser; i++ {
+			wg.Add(1)
+			go func(userID uint) {
+				defer wg.Done()
+				err := merchService.BuyItem(ctx, userID, "pink-hoody")
+				switch {
+				case err == nil:
+					sold.Add(1)
+				case errors.Is(err, services.ErrOutOfStock):
+					outOfStock.Add(1)
+				default:
+					t.Errorf("unexpected error: %v", err)
+				}
+			}(u.ID)
+		}
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(stock), sold.Load())
+	assert.Equal(t, int64(buyers*perUser-stock), outOfStock.Load())
+
+	item, err := merchRepo.GetMerchItemByType(ctx, "pink-hoody")
+	require.NoError(t, err)
+	require.NotNil(t, item.Stock)
+	assert.Equal(t, 0, *item.Stock)
+
+	owned, spent := 0, 0
+	for _, u := range users {
+		inv, err := invRepo.GetByUserAndType(ctx, u.ID, "pink-hoody")
+		require.NoError(t, err)
+		if inv != nil {
+			owned += inv.Quantity
+		}
+		updated, err := userRepo.GetUserByID(ctx, u.ID)
+		require.NoError(t, err)
+		spent += 1000 - updated.Coins
+	}
+	assert.Equal(t, stock, owned)
+	assert.Equal(t, stock*10, spent)
+}
+
+func TestIntegration_MerchStock_Unlimited(t *testing.T) {
+	ctx := context.Background()
+	db := setupIntegrationDB(t)
+
+	merchRepo := repositories.NewMerchRepository(db)
+	userRepo := repositories.NewUserRepository(db)
+	merchService := services.NewMerchService(merchRepo, userRepo, repositories.NewUnitOfWork(db))
+
+	require.NoError(t, merchRepo.CreateMerchItem(ctx, &domain.MerchItem{ItemType: "pen", Price: 10}))
+	user := &domain.User{Username: "writer", PasswordHash: "irrelevant", Coins: 100}
+	require.NoError(t, userRepo.CreateUser(ctx, user))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, merchService.BuyItem(ctx, user.ID, "pen"))
+	}
+
+	one := 1
+	require.NoError(t, merchService.SetItemStock(ctx, "pen", &one))
+	require.NoError(t, merchService.BuyItem(ctx, user.ID, "pen"))
+	assert.ErrorIs(t, merchService.BuyItem(ctx, user.ID, "pen"), services.ErrOutOfStock)
+
+	updated, err := userRepo.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 60, updated.Coins)
+
+	require.NoError(t, merchService.SetItemStock(ctx, "pen", nil))
+	require.NoError(t, merchService.BuyItem(ctx, user.ID, "pen"))
+
+	negative := -1
+	assert.ErrorIs(t, merchService.SetItemStock(ctx, "pen", &negative), services.ErrInvalidMerchItem)
+}
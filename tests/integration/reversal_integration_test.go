@@ -0,0 +1,176 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_Reversals(t *testing.T) {
+	ctx := context.Background()
+	db := setupIntegrationDB(t)
+
+	uow := repositories.NewUnitOfWork(db)
+	userRepo := repositories.NewUserRepository(db)
+	txRepo := repositories.NewTransactionRepository(db)
+	merchRepo := repositories.NewMerchRepository(db)
+	invRepo := repositories.NewInventoryRepository(db)
+
+	authService := services.NewAuthService(userRepo, repositories.NewTokenRepository(db), uow, services.AuthOptions{JWTSecret: jwtSecret})
+	transferService := services.NewTransactionService(uow, nil)
+	merchService := services.NewMerchService(merchRepo, userRepo, uow)
+	userService := services.NewUserService(userRepo, invRepo, txRepo)
+	ledgerService := services.NewLedgerService(uow, txRepo)
+	now := time.Now()
+	reversalService := services.NewReversalService(uow, time.Hour, nil, func() time.Time { return now })
+
+	stock := 5
+	require.NoError(t, merchRepo.CreateMerchItem(ctx, &domain.MerchItem{ItemType: "cup", Price: 20, Stock: &stock}))
+	require.NoError(t, merchRepo.CreateMerchItem(ctx, &domain.MerchItem{ItemType: "pen", Price: 10}))
+
+	for _, name := range []string{"alice", "bob"} {
+		_, err := authService.Register(ctx, name, "password")
+		require.NoError(t, err)
+	}
+	alice, err := userRepo.GetUserByName(ctx, "alice")
+	require.NoError(t, err)
+	bob, err := userRepo.GetUserByName(ctx, "bob")
+	require.NoError(t, err)
+
+	coins := func(userID uint) int {
+		user, err := userRepo.GetUserByID(ctx, userID)
+		require.NoError(t, err)
+		return user.Coins
+	}
+	lastOfType := func(userID uint, txType domain.TransactionType) domain.Transaction {
+		txs, err := txRepo.GetTransactionsByType(ctx, userID, txType)
+		require.NoError(t, err)
+		require.NotEmpty(t, txs)
+		latest := txs[0]
+		for _, tx := range txs {
+			if tx.ID > latest.ID {
+				latest = tx
+			}
+		}
+		return latest
+	}
+
+	t.Run("Reversal returns the coins once", func(t *testing.T) {
+		require.NoError(t, transferService.TransferCoins(ctx, alice.ID, bob.ID, 100, services.TransferNote{Category: "lunch"}))
+		transfer := lastOfType(alice.ID, domain.Transfer)
+
+		info, err := reversalService.ReverseTransfer(ctx, transfer.ID, false, "sent by mistake")
+		require.NoError(t, err)
+		assert.Equal(t, transfer.ID, info.ReversalOf)
+		assert.Equal(t, string(domain.Reversal), info.Type)
+		assert.Equal(t, 1000, coins(alice.ID))
+		assert.Equal(t, 1000, coins(bob.ID))
+
+		_, err = reversalService.ReverseTransfer(ctx, transfer.ID, false, "")
+		assert.ErrorIs(t, err, services.ErrAlreadyReversed)
+		_, err = reversalService.ReverseTransfer(ctx, info.TransactionID, false, "")
+		assert.ErrorIs(t, err, services.ErrNotReversible)
+
+		page, err := userService.GetHistory(ctx, bob.ID, services.HistoryRequest{Type: string(domain.Reversal)})
+		require.NoError(t, err)
+		require.Len(t, page.Entries, 1)
+		assert.Equal(t, repositories.DirectionOut, page.Entries[0].Direction)
+		assert.Equal(t, "alice", page.Entries[0].Counterparty)
+		assert.Equal(t, "sent by mistake", page.Entries[0].Message)
+		require.NotNil(t, page.Entries[0].ReversalOf)
+		assert.Equal(t, transfer.ID, *page.Entries[0].ReversalOf)
+	})
+
+	t.Run("Spent coins need a forced reversal", func(t *testing.T) {
+		require.NoError(t, transferService.TransferCoins(ctx, alice.ID, bob.ID, 500, services.TransferNote{}))
+		transfer := lastOfType(alice.ID, domain.Transfer)
+		_, err := merchService.BuyItems(ctx, bob.ID, []services.PurchaseLine{{ItemType: "pen", Quantity: 140}})
+		require.NoError(t, err)
+		require.Equal(t, 100, coins(bob.ID))
+
+		_, err = reversalService.ReverseTransfer(ctx, transfer.ID, false, "")
+		assert.ErrorIs(t, err, services.ErrReversalInsufficientFunds)
+		assert.Equal(t, 100, coins(bob.ID))
+
+		_, err = reversalService.ReverseTransfer(ctx, transfer.ID, true, "fraud")
+		require.NoError(t, err)
+		assert.Equal(t, -400, coins(bob.ID))
+		assert.Equal(t, 1000, coins(alice.ID))
+	})
+
+	t.Run("Refund returns coins, items and stock", func(t *testing.T) {
+		_, err := merchService.BuyItems(ctx, alice.ID, []services.PurchaseLine{{ItemType: "cup", Quantity: 2}})
+		require.NoError(t, err)
+		purchase := lastOfType(alice.ID, domain.Purchase)
+
+		_, err = reversalService.RefundPurchase(ctx, bob.ID, purchase.ID)
+		assert.ErrorIs(t, err, services.ErrTransactionNotFound)
+
+		info, err := reversalService.RefundPurchase(ctx, alice.ID, purchase.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 40, info.Amount)
+		assert.Equal(t, 1000, coins(alice.ID))
+
+		item, err := invRepo.GetByUserAndType(ctx, alice.ID, "cup")
+		require.NoError(t, err)
+		assert.Nil(t, item)
+		cup, err := merchRepo.GetMerchItemByType(ctx, "cup")
+		require.NoError(t, err)
+		assert.Equal(t, 5, *cup.Stock)
+
+		_, err = reversalService.RefundPurchase(ctx, alice.ID, purchase.ID)
+		assert.ErrorIs(t, err, services.ErrAlreadyReversed)
+
+		page, err := userService.GetHistory(ctx, alice.ID, services.HistoryRequest{Direction: repositories.DirectionIn, Type: string(domain.Refund)})
+		require.NoError(t, err)
+		require.Len(t, page.Entries, 1)
+		assert.Equal(t, "shop", page.Entries[0].Counterparty)
+		assert.Equal(t, 2, page.Entries[0].Quantity)
+	})
+
+	t.Run("Partial inventory is kept", func(t *testing.T) {
+		_, err := merchService.BuyItems(ctx, alice.ID, []services.PurchaseLine{{ItemType: "cup", Quantity: 1}})
+		require.NoError(t, err)
+		_, err = merchService.BuyItems(ctx, alice.ID, []services.PurchaseLine{{ItemType: "cup", Quantity: 1}})
+		require.NoError(t, err)
+
+		_, err = reversalService.RefundPurchase(ctx, alice.ID, lastOfType(alice.ID, domain.Purchase).ID)
+		require.NoError(t, err)
+
+		item, err := invRepo.GetByUserAndType(ctx, alice.ID, "cup")
+		require.NoError(t, err)
+		require.NotNil(t, item)
+		assert.Equal(t, 1, item.Quantity)
+	})
+
+	t.Run("Refund window and transaction type", func(t *testing.T) {
+		require.NoError(t, merchService.BuyItem(ctx, alice.ID, "pen"))
+		purchase := lastOfType(alice.ID, domain.Purchase)
+
+		_, err := reversalService.RefundPurchase(ctx, alice.ID, lastOfType(alice.ID, domain.Transfer).ID)
+		assert.ErrorIs(t, err, services.ErrNotRefundable)
+		_, err = reversalService.ReverseTransfer(ctx, purchase.ID, false, "")
+		assert.ErrorIs(t, err, services.ErrNotReversible)
+
+		now = now.Add(2 * time.Hour)
+		_, err = reversalService.RefundPurchase(ctx, alice.ID, purchase.ID)
+		assert.ErrorIs(t, err, services.ErrRefundWindowExpired)
+
+		_, err = reversalService.ReverseTransfer(ctx, 1<<20, false, "")
+		assert.ErrorIs(t, err, services.ErrTransactionNotFound)
+	})
+
+	t.Run("Ledger stays balanced", func(t *testing.T) {
+		report, err := ledgerService.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, report.Drifts)
+		assert.Empty(t, report.UnbalancedTransactions)
+		assert.Zero(t, report.LedgerTotal)
+	})
+}
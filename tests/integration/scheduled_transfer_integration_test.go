@@ -0,0 +1,203 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_ScheduledTransfers(t *testing.T) {
+	ctx := context.Background()
+	db := setupIntegrationDB(t)
+
+	userRepo := repositories.NewUserRepository(db)
+	txService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	scheduledService := services.NewScheduledTransferService(
+		repositories.NewScheduledTransferRepository(db), userRepo, txService, time.UTC, nil, clock)
+
+	lead := &domain.User{Username: "lead", PasswordHash: "irrelevant", Coins: 100}
+	member := &domain.User{Username: "member", PasswordHash: "irrelevant", Coins: 10}
+	require.NoError(t, userRepo.CreateUser(ctx, lead))
+	require.NoError(t, userRepo.CreateUser(ctx, member))
+
+	coins := func(user *domain.User) int {
+		updated, err := userRepo.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		return updated.Coins
+	}
+
+	t.Run("Recurring transfer runs on schedule and records failures", func(t *testing.T) {
+		created, err := scheduledService.Create(ctx, lead.ID, services.ScheduledTransferRequest{
+			ToUserID: member.ID,
+			Amount:   40,
+			Note:     services.TransferNote{Message: "weekly reward", Category: "thanks"},
+			Schedule: "0 10 * * fri",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "member", created.ToUser)
+		require.NotNil(t, created.NextRunAt)
+		assert.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), created.NextRunAt.UTC())
+
+		ran, err := scheduledService.RunDue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, ran)
+
+		for week := 0; week < 3; week++ {
+			now = time.Date(2024, 3, 1+7*week, 10, 0, 30, 0, time.UTC)
+			ran, err = scheduledService.RunDue(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 1, ran)
+
+			ran, err = scheduledService.RunDue(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 0, ran, "a run must not repeat")
+		}
+
+		assert.Equal(t, 20, coins(lead))
+		assert.Equal(t, 90, coins(member))
+
+		info, err := scheduledService.Get(ctx, lead.ID, created.ID)
+		require.NoError(t, err)
+		assert.True(t, info.Active)
+		assert.Equal(t, time.Date(2024, 3, 22, 10, 0, 0, 0, time.UTC), info.NextRunAt.UTC())
+		assert.Contains(t, info.LastError, "does not have enough coins")
+		require.Len(t, info.Runs, 3)
+		assert.False(t, info.Runs[0].Success)
+		assert.True(t, info.Runs[1].Success)
+		assert.True(t, info.Runs[2].Success)
+
+		require.NoError(t, scheduledService.Delete(ctx, lead.ID, created.ID))
+		_, err = scheduledService.Get(ctx, lead.ID, created.ID)
+		assert.ErrorIs(t, err, services.ErrScheduledTransferNotFound)
+	})
+
+	t.Run("One-shot transfer runs once", func(t *testing.T) {
+		runAt := now.Add(time.Hour)
+		created, err := scheduledService.Create(ctx, member.ID, services.ScheduledTransferRequest{
+			ToUserID: lead.ID,
+			Amount:   30,
+			RunAt:    &runAt,
+		})
+		require.NoError(t, err)
+
+		now = runAt.Add(time.Minute)
+		ran, err := scheduledService.RunDue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, ran)
+
+		info, err := scheduledService.Get(ctx, member.ID, created.ID)
+		require.NoError(t, err)
+		assert.False(t, info.Active)
+		assert.Nil(t, info.NextRunAt)
+		assert.Empty(t, info.LastError)
+		assert.Equal(t, 50, coins(lead))
+
+		now = now.Add(24 * time.Hour)
+		ran, err = scheduledService.RunDue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, ran)
+	})
+
+	t.Run("Only the owner sees and changes a transfer", func(t *testing.T) {
+		created, err := scheduledService.Create(ctx, lead.ID, services.ScheduledTransferRequest{
+			ToUserID: member.ID,
+			Amount:   1,
+			Schedule: "@daily",
+		})
+		require.NoError(t, err)
+
+		_, err = scheduledService.Get(ctx, member.ID, created.ID)
+		assert.ErrorIs(t, err, services.ErrScheduledTransferNotFound)
+		assert.ErrorIs(t, scheduledService.Delete(ctx, member.ID, created.ID), services.ErrScheduledTransferNotFound)
+
+		updated, err := scheduledService.Update(ctx, lead.ID, created.ID, services.ScheduledTransferRequest{
+			ToUserID: member.ID,
+			Amount:   5,
+			Schedule: "0 12 * * *",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 5, updated.Amount)
+		assert.Equal(t, "0 12 * * *", updated.Schedule)
+
+		list, err := scheduledService.List(ctx, lead.ID)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, created.ID, list[0].ID)
+	})
+
+	t.Run("Invalid schedules", func(t *testing.T) {
+		past := now.Add(-time.Minute)
+		for _, req := range []services.ScheduledTransferRequest{
+			{ToUserID: member.ID, Amount: 1},
+			{ToUserID: member.ID, Amount: 1, RunAt: &past},
+			{ToUserID: member.ID, Amount: 1, Schedule: "every monday"},
+			{ToUserID: member.ID, Amount: 1, Schedule: "0 0 30 2 *"},
+		} {
+			_, err := scheduledService.Create(ctx, lead.ID, req)
+			assert.ErrorIs(t, err, services.ErrInvalidSchedule)
+		}
+
+		_, err := scheduledService.Create(ctx, lead.ID, services.ScheduledTransferRequest{ToUserID: lead.ID, Amount: 1, Schedule: "@daily"})
+		assert.Error(t, err)
+	})
+}
+
+// runningScheduledTransferRepository claims the transfer's due run right after it is
+// read, as a scheduler running concurrently with an update would.
+type runningScheduledTransferRepository struct {
+	repositories.ScheduledTransferRepository
+	next time.Time
+}
+
+func (r *runningScheduledTransferRepository) GetScheduledTransferByID(ctx context.Context, id uint) (*domain.ScheduledTransfer, error) {
+	transfer, err := r.ScheduledTransferRepository.GetScheduledTransferByID(ctx, id)
+	if err != nil || transfer == nil {
+		return transfer, err
+	}
+	if _, err := r.ClaimScheduledRun(ctx, id, *transfer.NextRunAt, &r.next); err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+func TestIntegration_ScheduledTransfers_UpdateDuringRun(t *testing.T) {
+	ctx := context.Background()
+	db := setupIntegrationDB(t)
+
+	userRepo := repositories.NewUserRepository(db)
+	txService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	repo := repositories.NewScheduledTransferRepository(db)
+
+	lead := &domain.User{Username: "lead", PasswordHash: "irrelevant", Coins: 100}
+	member := &domain.User{Username: "member", PasswordHash: "irrelevant", Coins: 10}
+	require.NoError(t, userRepo.CreateUser(ctx, lead))
+	require.NoError(t, userRepo.CreateUser(ctx, member))
+
+	created, err := services.NewScheduledTransferService(repo, userRepo, txService, time.UTC, nil, clock).
+		Create(ctx, lead.ID, services.ScheduledTransferRequest{ToUserID: member.ID, Amount: 1, Schedule: "0 10 * * *"})
+	require.NoError(t, err)
+
+	next := time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)
+	racing := services.NewScheduledTransferService(&runningScheduledTransferRepository{ScheduledTransferRepository: repo, next: next},
+		userRepo, txService, time.UTC, nil, clock)
+	_, err = racing.Update(ctx, lead.ID, created.ID, services.ScheduledTransferRequest{ToUserID: member.ID, Amount: 5, Schedule: "0 10 * * *"})
+	assert.ErrorIs(t, err, services.ErrScheduledTransferRunning)
+
+	// The claimed run's bookkeeping survives, so the run is not repeated.
+	transfer, err := repo.GetScheduledTransferByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, transfer.Amount)
+	require.NotNil(t, transfer.LastRunAt)
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), transfer.LastRunAt.UTC())
+	assert.Equal(t, next, transfer.NextRunAt.UTC())
+}
@@ -0,0 +1,105 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/handlers"
+	"avito-tech-go/internal/middleware"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegration_TokenRevocation(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+	db := setupIntegrationDB(t)
+
+	userRepo := repositories.NewUserRepository(db)
+	tokenRepo := repositories.NewTokenRepository(db)
+	authService := services.NewAuthService(userRepo, tokenRepo, repositories.NewUnitOfWork(db), services.AuthOptions{JWTSecret: jwtSecret})
+
+	r := gin.New()
+	authMw := middleware.JWTAuthMiddleware(jwtSecret, authService)
+	r.POST("/api/auth", handlers.AuthHandler(authService, true))
+	r.POST("/api/auth/refresh", handlers.RefreshHandler(authService))
+	r.POST("/api/auth/logout", authMw, handlers.LogoutHandler(authService))
+	r.GET("/api/me", authMw, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	authenticate := func(path, body string) handlers.AuthResponse {
+		w := do(http.MethodPost, path, "", body)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp handlers.AuthResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	first := authenticate("/api/auth", `{"username":"alice","password":"password"}`)
+	assert.Equal(t, int64(services.DefaultAccessTokenTTL/time.Second), first.ExpiresIn)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/me", first.Token, "").Code)
+
+	t.Run("Refresh rotates the refresh token", func(t *testing.T) {
+		second := authenticate("/api/auth/refresh", `{"refreshToken":"`+first.RefreshToken+`"}`)
+		assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+		assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/me", second.Token, "").Code)
+
+		t.Run("Reusing a rotated token revokes the whole family", func(t *testing.T) {
+			w := do(http.MethodPost, "/api/auth/refresh", "", `{"refreshToken":"`+first.RefreshToken+`"}`)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+			w = do(http.MethodPost, "/api/auth/refresh", "", `{"refreshToken":"`+second.RefreshToken+`"}`)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		})
+	})
+
+	t.Run("Logout revokes the access and refresh tokens", func(t *testing.T) {
+		tokens := authenticate("/api/auth", `{"username":"alice","password":"password"}`)
+
+		w := do(http.MethodPost, "/api/auth/logout", tokens.Token, `{"refreshToken":"`+tokens.RefreshToken+`"}`)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/me", tokens.Token, "").Code)
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/auth/logout", tokens.Token, "").Code)
+
+		w = do(http.MethodPost, "/api/auth/refresh", "", `{"refreshToken":"`+tokens.RefreshToken+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("Cleanup removes expired entries", func(t *testing.T) {
+		user, err := userRepo.GetUserByName(ctx, "alice")
+		require.NoError(t, err)
+
+		past := time.Now().Add(-time.Hour)
+		require.NoError(t, tokenRepo.CreateRefreshToken(ctx, &domain.RefreshToken{UserID: user.ID, TokenHash: strings.Repeat("a", 64), ExpiresAt: past}))
+		require.NoError(t, tokenRepo.RevokeAccessToken(ctx, "expired-jti", past))
+
+		deleted, err := authService.CleanupTokens(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), deleted)
+
+		revoked, err := authService.IsTokenRevoked(ctx, "expired-jti")
+		require.NoError(t, err)
+		assert.False(t, revoked)
+	})
+}
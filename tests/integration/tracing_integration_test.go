@@ -0,0 +1,87 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/handlers"
+	"avito-tech-go/internal/logging"
+	"avito-tech-go/internal/middleware"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"avito-tech-go/internal/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestIntegration_Tracing(t *testing.T) {
+	ctx := context.Background()
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	db := setupIntegrationDB(t)
+	require.NoError(t, db.Use(tracing.NewGormPlugin()))
+
+	userRepo := repositories.NewUserRepository(db)
+	alice := &domain.User{Username: "alice", PasswordHash: "irrelevant", Coins: 1000}
+	bob := &domain.User{Username: "bob", PasswordHash: "irrelevant", Coins: 1000}
+	require.NoError(t, userRepo.CreateUser(ctx, alice))
+	require.NoError(t, userRepo.CreateUser(ctx, bob))
+	transferService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
+
+	var logs bytes.Buffer
+	logger := logging.New(&logs, slog.LevelInfo)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.RequestIDMiddleware(), middleware.TracingMiddleware(), middleware.RequestLoggerMiddleware(logger))
+	r.POST("/api/sendCoin", func(c *gin.Context) {
+		c.Set("userID", alice.ID)
+	}, handlers.SendCoinHandler(transferService, userRepo))
+
+	exporter.Reset()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/sendCoin", strings.NewReader(`{"toUser":"bob","amount":10}`)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	traceID := w.Header().Get(middleware.TraceIDHeader)
+	require.Len(t, traceID, 32)
+
+	spans := exporter.GetSpans()
+	byName := make(map[string]tracetest.SpanStub)
+	for _, span := range spans {
+		assert.Equal(t, traceID, span.SpanContext.TraceID().String(), span.Name)
+		byName[span.Name] = span
+	}
+	server, ok := byName["POST /api/sendCoin"]
+	require.True(t, ok, "no server span in %v", byName)
+	service, ok := byName["TransactionService.TransferCoins"]
+	require.True(t, ok, "no service span in %v", byName)
+	assert.Equal(t, server.SpanContext.SpanID(), service.Parent.SpanID())
+	update, ok := byName["db.update"]
+	require.True(t, ok, "no query span in %v", byName)
+	assert.Equal(t, service.SpanContext.SpanID(), update.Parent.SpanID())
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(logs.Bytes()), &line))
+	assert.Equal(t, traceID, line["trace_id"])
+
+	t.Run("Incoming trace is continued", func(t *testing.T) {
+		const parent = "4bf92f3577b34da6a3ce929d0e0e4736"
+		req := httptest.NewRequest(http.MethodPost, "/api/sendCoin", strings.NewReader(`{"toUser":"bob","amount":10}`))
+		req.Header.Set("traceparent", "00-"+parent+"-00f067aa0ba902b7-01")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, parent, w.Header().Get(middleware.TraceIDHeader))
+	})
+}
@@ -1,6 +1,7 @@
 package integration
 
 import (
+	"context"
 	"testing"
 
 	"avito-tech-go/internal/domain"
@@ -10,18 +11,19 @@ import (
 )
 
 func TestIntegration_CoinTransfer(t *testing.T) {
+	ctx := context.Background()
 	db := setupIntegrationDB(t)
 
 	userRepo := repositories.NewUserRepository(db)
 	txRepo := repositories.NewTransactionRepository(db)
-	transferService := services.NewTransactionService(userRepo, txRepo, db)
+	transferService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
 
 	alice := &domain.User{
 		Username:     "alice",
 		PasswordHash: "irrelevant",
 		Coins:        1000,
 	}
-	err := userRepo.CreateUser(alice)
+	err := userRepo.CreateUser(ctx, alice)
 	assert.NoError(t, err)
 
 	bob := &domain.User{
@@ -29,22 +31,22 @@ func TestIntegration_CoinTransfer(t *testing.T) {
 		PasswordHash: "irrelevant",
 		Coins:        1000,
 	}
-	err = userRepo.CreateUser(bob)
+	err = userRepo.CreateUser(ctx, bob)
 	assert.NoError(t, err)
 
 	t.Run("Successful transfer", func(t *testing.T) {
-		err := transferService.TransferCoins(alice.ID, bob.ID, 200)
+		err := transferService.TransferCoins(ctx, alice.ID, bob.ID, 200, services.TransferNote{})
 		assert.NoError(t, err)
 
-		updatedAlice, err := userRepo.GetUserByID(alice.ID)
+		updatedAlice, err := userRepo.GetUserByID(ctx, alice.ID)
 		assert.NoError(t, err)
-		updatedBob, err := userRepo.GetUserByID(bob.ID)
+		updatedBob, err := userRepo.GetUserByID(ctx, bob.ID)
 		assert.NoError(t, err)
 
 		assert.Equal(t, 800, updatedAlice.Coins)
 		assert.Equal(t, 1200, updatedBob.Coins)
 
-		txs, err := txRepo.GetUserTransactions(alice.ID)
+		txs, err := txRepo.GetUserTransactions(ctx, alice.ID)
 		assert.NoError(t, err)
 		assert.Len(t, txs, 1)
 		txRecord := txs[0]
@@ -56,36 +58,36 @@ func TestIntegration_CoinTransfer(t *testing.T) {
 	})
 
 	t.Run("Insufficient funds", func(t *testing.T) {
-		err := transferService.TransferCoins(alice.ID, bob.ID, 900)
+		err := transferService.TransferCoins(ctx, alice.ID, bob.ID, 900, services.TransferNote{})
 		assert.Error(t, err)
 
-		updatedAlice, err := userRepo.GetUserByID(alice.ID)
+		updatedAlice, err := userRepo.GetUserByID(ctx, alice.ID)
 		assert.NoError(t, err)
-		updatedBob, err := userRepo.GetUserByID(bob.ID)
+		updatedBob, err := userRepo.GetUserByID(ctx, bob.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, 800, updatedAlice.Coins)
 		assert.Equal(t, 1200, updatedBob.Coins)
 	})
 
 	t.Run("Transfer zero coins", func(t *testing.T) {
-		err := transferService.TransferCoins(alice.ID, bob.ID, 0)
+		err := transferService.TransferCoins(ctx, alice.ID, bob.ID, 0, services.TransferNote{})
 		assert.Error(t, err)
 
-		updatedAlice, err := userRepo.GetUserByID(alice.ID)
+		updatedAlice, err := userRepo.GetUserByID(ctx, alice.ID)
 		assert.NoError(t, err)
-		updatedBob, err := userRepo.GetUserByID(bob.ID)
+		updatedBob, err := userRepo.GetUserByID(ctx, bob.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, 800, updatedAlice.Coins)
 		assert.Equal(t, 1200, updatedBob.Coins)
 	})
 
 	t.Run("Transfer negative amount", func(t *testing.T) {
-		err := transferService.TransferCoins(alice.ID, bob.ID, -50)
+		err := transferService.TransferCoins(ctx, alice.ID, bob.ID, -50, services.TransferNote{})
 		assert.Error(t, err)
 
-		updatedAlice, err := userRepo.GetUserByID(alice.ID)
+		updatedAlice, err := userRepo.GetUserByID(ctx, alice.ID)
 		assert.NoError(t, err)
-		updatedBob, err := userRepo.GetUserByID(bob.ID)
+		updatedBob, err := userRepo.GetUserByID(ctx, bob.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, 800, updatedAlice.Coins)
 		assert.Equal(t, 1200, updatedBob.Coins)
@@ -93,29 +95,29 @@ func TestIntegration_CoinTransfer(t *testing.T) {
 
 	t.Run("Transfer to non-existing receiver", func(t *testing.T) {
 		nonExistingReceiverID := uint(9999)
-		err := transferService.TransferCoins(alice.ID, nonExistingReceiverID, 100)
+		err := transferService.TransferCoins(ctx, alice.ID, nonExistingReceiverID, 100, services.TransferNote{})
 		assert.Error(t, err)
 
-		updatedAlice, err := userRepo.GetUserByID(alice.ID)
+		updatedAlice, err := userRepo.GetUserByID(ctx, alice.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, 800, updatedAlice.Coins)
 	})
 
 	t.Run("Transfer from non-existing sender", func(t *testing.T) {
 		nonExistingSenderID := uint(9999)
-		err := transferService.TransferCoins(nonExistingSenderID, bob.ID, 100)
+		err := transferService.TransferCoins(ctx, nonExistingSenderID, bob.ID, 100, services.TransferNote{})
 		assert.Error(t, err)
 
-		updatedBob, err := userRepo.GetUserByID(bob.ID)
+		updatedBob, err := userRepo.GetUserByID(ctx, bob.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, 1200, updatedBob.Coins)
 	})
 
 	t.Run("Transfer to self", func(t *testing.T) {
-		err := transferService.TransferCoins(alice.ID, alice.ID, 100)
+		err := transferService.TransferCoins(ctx, alice.ID, alice.ID, 100, services.TransferNote{})
 		assert.Error(t, err)
 
-		updatedAlice, err := userRepo.GetUserByID(alice.ID)
+		updatedAlice, err := userRepo.GetUserByID(ctx, alice.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, 800, updatedAlice.Coins)
 	})
@@ -1,6 +1,7 @@
 package integration
 
 import (
+	"context"
 	"testing"
 
 	"avito-tech-go/internal/domain"
@@ -10,6 +11,7 @@ import (
 )
 
 func TestIntegration_UserInfo(t *testing.T) {
+	ctx := context.Background()
 	t.Run("User not found", func(t *testing.T) {
 		db := setupIntegrationDB(t)
 		userRepo := repositories.NewUserRepository(db)
@@ -17,7 +19,7 @@ func TestIntegration_UserInfo(t *testing.T) {
 		txRepo := repositories.NewTransactionRepository(db)
 		userService := services.NewUserService(userRepo, invRepo, txRepo)
 
-		info, err := userService.GetInfo(9999) // несуществующий ID
+		info, err := userService.GetInfo(ctx, 9999) // несуществующий ID
 		assert.Error(t, err)
 		assert.Nil(t, info)
 	})
@@ -32,10 +34,10 @@ func TestIntegration_UserInfo(t *testing.T) {
 		user := &domain.User{
 			Username: "emptyuser",
 		}
-		err := userRepo.CreateUser(user)
+		err := userRepo.CreateUser(ctx, user)
 		assert.NoError(t, err)
 
-		info, err := userService.GetInfo(user.ID)
+		info, err := userService.GetInfo(ctx, user.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, 1000, info.Coins)
 		assert.Empty(t, info.Inventory)
@@ -51,7 +53,7 @@ func TestIntegration_UserInfo(t *testing.T) {
 		userService := services.NewUserService(userRepo, invRepo, txRepo)
 
 		user := &domain.User{Username: "invuser"}
-		err := userRepo.CreateUser(user)
+		err := userRepo.CreateUser(ctx, user)
 		assert.NoError(t, err)
 
 		item1 := &domain.InventoryItem{
@@ -59,16 +61,16 @@ func TestIntegration_UserInfo(t *testing.T) {
 			ItemType: "t-shirt",
 			Quantity: 2,
 		}
-		assert.NoError(t, invRepo.CreateItem(item1))
+		assert.NoError(t, invRepo.CreateItem(ctx, item1))
 
 		item2 := &domain.InventoryItem{
 			UserID:   user.ID,
 			ItemType: "cup",
 			Quantity: 3,
 		}
-		assert.NoError(t, invRepo.CreateItem(item2))
+		assert.NoError(t, invRepo.CreateItem(ctx, item2))
 
-		info, err := userService.GetInfo(user.ID)
+		info, err := userService.GetInfo(ctx, user.ID)
 		assert.NoError(t, err)
 		assert.Len(t, info.Inventory, 2)
 
@@ -88,7 +90,7 @@ func TestIntegration_UserInfo(t *testing.T) {
 		userService := services.NewUserService(userRepo, invRepo, txRepo)
 
 		user := &domain.User{Username: "purchaser"}
-		assert.NoError(t, userRepo.CreateUser(user))
+		assert.NoError(t, userRepo.CreateUser(ctx, user))
 
 		purchaseTx := &domain.Transaction{
 			FromUserID: user.ID,
@@ -96,9 +98,9 @@ func TestIntegration_UserInfo(t *testing.T) {
 			Amount:     80,
 			Type:       domain.Purchase,
 		}
-		assert.NoError(t, txRepo.CreateTransaction(purchaseTx))
+		assert.NoError(t, txRepo.CreateTransaction(ctx, purchaseTx))
 
-		info, err := userService.GetInfo(user.ID)
+		info, err := userService.GetInfo(ctx, user.ID)
 		assert.NoError(t, err)
 		assert.Len(t, info.CoinHistory.Sent, 1)
 		sentTx := info.CoinHistory.Sent[0]
@@ -115,8 +117,8 @@ func TestIntegration_UserInfo(t *testing.T) {
 
 		sender := &domain.User{Username: "sender"}
 		receiver := &domain.User{Username: "receiver"}
-		assert.NoError(t, userRepo.CreateUser(sender))
-		assert.NoError(t, userRepo.CreateUser(receiver))
+		assert.NoError(t, userRepo.CreateUser(ctx, sender))
+		assert.NoError(t, userRepo.CreateUser(ctx, receiver))
 
 		transferTx := &domain.Transaction{
 			FromUserID: sender.ID,
@@ -124,9 +126,9 @@ func TestIntegration_UserInfo(t *testing.T) {
 			Amount:     150,
 			Type:       domain.Transfer,
 		}
-		assert.NoError(t, txRepo.CreateTransaction(transferTx))
+		assert.NoError(t, txRepo.CreateTransaction(ctx, transferTx))
 
-		info, err := userService.GetInfo(sender.ID)
+		info, err := userService.GetInfo(ctx, sender.ID)
 		assert.NoError(t, err)
 		assert.Len(t, info.CoinHistory.Sent, 1)
 		sentTx := info.CoinHistory.Sent[0]
@@ -143,8 +145,8 @@ func TestIntegration_UserInfo(t *testing.T) {
 
 		sender := &domain.User{Username: "sender2"}
 		receiver := &domain.User{Username: "receiver2"}
-		assert.NoError(t, userRepo.CreateUser(sender))
-		assert.NoError(t, userRepo.CreateUser(receiver))
+		assert.NoError(t, userRepo.CreateUser(ctx, sender))
+		assert.NoError(t, userRepo.CreateUser(ctx, receiver))
 
 		transferTx := &domain.Transaction{
 			FromUserID: sender.ID,
@@ -152,9 +154,9 @@ func TestIntegration_UserInfo(t *testing.T) {
 			Amount:     200,
 			Type:       domain.Transfer,
 		}
-		assert.NoError(t, txRepo.CreateTransaction(transferTx))
+		assert.NoError(t, txRepo.CreateTransaction(ctx, transferTx))
 
-		info, err := userService.GetInfo(receiver.ID)
+		info, err := userService.GetInfo(ctx, receiver.ID)
 		assert.NoError(t, err)
 		assert.Len(t, info.CoinHistory.Received, 1)
 		receivedTx := info.CoinHistory.Received[0]
@@ -170,14 +172,14 @@ func TestIntegration_UserInfo(t *testing.T) {
 		userService := services.NewUserService(userRepo, invRepo, txRepo)
 
 		user := &domain.User{Username: "mixeduser"}
-		assert.NoError(t, userRepo.CreateUser(user))
+		assert.NoError(t, userRepo.CreateUser(ctx, user))
 
 		item := &domain.InventoryItem{
 			UserID:   user.ID,
 			ItemType: "hat",
 			Quantity: 1,
 		}
-		assert.NoError(t, invRepo.CreateItem(item))
+		assert.NoError(t, invRepo.CreateItem(ctx, item))
 
 		purchaseTx := &domain.Transaction{
 			FromUserID: user.ID,
@@ -185,19 +187,19 @@ func TestIntegration_UserInfo(t *testing.T) {
 			Amount:     50,
 			Type:       domain.Purchase,
 		}
-		assert.NoError(t, txRepo.CreateTransaction(purchaseTx))
+		assert.NoError(t, txRepo.CreateTransaction(ctx, purchaseTx))
 
 		receiver := &domain.User{Username: "mixedReceiver"}
-		assert.NoError(t, userRepo.CreateUser(receiver))
+		assert.NoError(t, userRepo.CreateUser(ctx, receiver))
 		transferTx := &domain.Transaction{
 			FromUserID: user.ID,
 			ToUserID:   func(u uint) *uint { return &u }(receiver.ID),
 			Amount:     100,
 			Type:       domain.Transfer,
 		}
-		assert.NoError(t, txRepo.CreateTransaction(transferTx))
+		assert.NoError(t, txRepo.CreateTransaction(ctx, transferTx))
 
-		info, err := userService.GetInfo(user.ID)
+		info, err := userService.GetInfo(ctx, user.ID)
 		assert.NoError(t, err)
 		assert.Equal(t, 1000, info.Coins)
 		assert.Len(t, info.Inventory, 1)
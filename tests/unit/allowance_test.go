@@ -0,0 +1,33 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllowancePeriod(t *testing.T) {
+	at := time.Date(2027, time.January, 2, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, "2027-01-02", services.AllowancePeriod(services.AllowanceDaily, at))
+	assert.Equal(t, "2026-W53", services.AllowancePeriod(services.AllowanceWeekly, at))
+	assert.Equal(t, "2027-01", services.AllowancePeriod(services.AllowanceMonthly, at))
+
+	// The period follows the calendar of the configured time zone.
+	moscow := time.FixedZone("MSK", 3*60*60)
+	lateUTC := time.Date(2026, time.October, 31, 22, 0, 0, 0, time.UTC)
+	assert.Equal(t, "2026-10", services.AllowancePeriod(services.AllowanceMonthly, lateUTC))
+	assert.Equal(t, "2026-11", services.AllowancePeriod(services.AllowanceMonthly, lateUTC.In(moscow)))
+}
+
+func TestAllowancePeriodStart(t *testing.T) {
+	at := time.Date(2027, time.January, 2, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2027, time.January, 2, 0, 0, 0, 0, time.UTC), services.AllowancePeriodStart(services.AllowanceDaily, at))
+	assert.Equal(t, time.Date(2026, time.December, 28, 0, 0, 0, 0, time.UTC), services.AllowancePeriodStart(services.AllowanceWeekly, at))
+	assert.Equal(t, time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC), services.AllowancePeriodStart(services.AllowanceMonthly, at))
+
+	// A Monday starts its own week.
+	monday := time.Date(2026, time.December, 28, 9, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, time.December, 28, 0, 0, 0, 0, time.UTC), services.AllowancePeriodStart(services.AllowanceWeekly, monday))
+}
@@ -2,83 +2,137 @@ package unit
 
 import (
 	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
 	"avito-tech-go/internal/services"
 	"avito-tech-go/tests/unit/mocks"
+	"context"
 	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"testing"
+	"time"
 )
 
 func TestAuthService_Register(t *testing.T) {
+	ctx := context.Background()
 	mockUserRepo := new(mocks.MockUserRepository)
-	authSvc := services.NewAuthService(mockUserRepo, "test_secret")
+	mockTxRepo := new(mocks.MockTransactionRepository)
+	mockTokenRepo := new(mocks.MockTokenRepository)
+	mockUow := mocks.NewMockUnitOfWork(&repositories.Repositories{
+		Users:        mockUserRepo,
+		Transactions: mockTxRepo,
+		Tokens:       mockTokenRepo,
+	})
+	authSvc := services.NewAuthService(mockUserRepo, mockTokenRepo, mockUow, services.AuthOptions{JWTSecret: "test_secret"})
 
 	t.Run("user already exists", func(t *testing.T) {
-		mockUserRepo.On("ExistsByUsername", "alex").
+		mockUserRepo.On("ExistsByUsername", mock.Anything, "alex").
 			Return(true, nil).Once()
 
-		token, err := authSvc.Register("alex", "12345")
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "already exists")
-		assert.Empty(t, token)
+		token, err := authSvc.Register(ctx, "alex", "12345")
+		assert.ErrorIs(t, err, services.ErrUserExists)
+		assert.Nil(t, token)
 
 		mockUserRepo.AssertExpectations(t)
 	})
 
 	t.Run("db error on exists check", func(t *testing.T) {
 		mockUserRepo.ExpectedCalls = nil
-		mockUserRepo.On("ExistsByUsername", "alex").
+		mockUserRepo.On("ExistsByUsername", mock.Anything, "alex").
 			Return(false, errors.New("db error")).Once()
 
-		token, err := authSvc.Register("alex", "12345")
+		token, err := authSvc.Register(ctx, "alex", "12345")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "db error")
-		assert.Empty(t, token)
+		assert.Nil(t, token)
 
 		mockUserRepo.AssertExpectations(t)
 	})
 
 	t.Run("success user creation", func(t *testing.T) {
 		mockUserRepo.ExpectedCalls = nil
-		mockUserRepo.On("ExistsByUsername", "alex").
+		mockUserRepo.On("ExistsByUsername", mock.Anything, "alex").
 			Return(false, nil).Once()
-		mockUserRepo.On("CreateUser", mock.Anything).
+		mockUserRepo.On("CreateUser", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				args.Get(1).(*domain.User).ID = 7
+			}).
+			Return(nil).Once()
+		mockTxRepo.On("IssueCoins", mock.Anything, uint(7), domain.InitialCoins).
 			Return(nil).Once()
+		mockTokenRepo.On("CreateRefreshToken", mock.Anything, mock.MatchedBy(func(token *domain.RefreshToken) bool {
+			return token.UserID == 7 && len(token.TokenHash) == 64
+		})).Return(nil).Once()
 
-		token, err := authSvc.Register("alex", "12345")
+		token, err := authSvc.Register(ctx, "alex", "12345")
 		assert.NoError(t, err)
 		assert.NotEmpty(t, token)
 
 		mockUserRepo.AssertExpectations(t)
+		mockTxRepo.AssertExpectations(t)
 	})
 }
 
+func TestAuthService_Register_AdminRole(t *testing.T) {
+	mockUserRepo := new(mocks.MockUserRepository)
+	mockTxRepo := new(mocks.MockTransactionRepository)
+	mockTokenRepo := new(mocks.MockTokenRepository)
+	mockUow := mocks.NewMockUnitOfWork(&repositories.Repositories{
+		Users:        mockUserRepo,
+		Transactions: mockTxRepo,
+		Tokens:       mockTokenRepo,
+	})
+	authSvc := services.NewAuthService(mockUserRepo, mockTokenRepo, mockUow, services.AuthOptions{
+		JWTSecret:      "test_secret",
+		AdminUsernames: []string{"boss"},
+	})
+
+	for username, role := range map[string]string{"boss": domain.RoleAdmin, "alex": domain.RoleUser} {
+		mockUserRepo.On("ExistsByUsername", mock.Anything, username).
+			Return(false, nil).Once()
+		mockUserRepo.On("CreateUser", mock.Anything, mock.MatchedBy(func(user *domain.User) bool {
+			return user.Username == username && user.Role == role
+		})).Return(nil).Once()
+		mockTxRepo.On("IssueCoins", mock.Anything, mock.Anything, domain.InitialCoins).
+			Return(nil).Once()
+		mockTokenRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).
+			Return(nil).Once()
+
+		token, err := authSvc.Register(context.Background(), username, "12345")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, token)
+	}
+
+	mockUserRepo.AssertExpectations(t)
+	mockTxRepo.AssertExpectations(t)
+}
+
 func TestAuthService_Login(t *testing.T) {
+	ctx := context.Background()
 	mockUserRepo := new(mocks.MockUserRepository)
-	authSvc := services.NewAuthService(mockUserRepo, "test_secret")
+	mockTokenRepo := new(mocks.MockTokenRepository)
+	authSvc := services.NewAuthService(mockUserRepo, mockTokenRepo, mocks.NewMockUnitOfWork(nil), services.AuthOptions{JWTSecret: "test_secret"})
 
 	t.Run("user not found", func(t *testing.T) {
-		mockUserRepo.On("GetUserByName", "alex").
+		mockUserRepo.On("GetUserByName", mock.Anything, "alex").
 			Return((*domain.User)(nil), nil).Once()
 
-		token, err := authSvc.Login("alex", "12345")
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "not found")
-		assert.Empty(t, token)
+		token, err := authSvc.Login(ctx, "alex", "12345", "")
+		assert.ErrorIs(t, err, services.ErrUserNotFound)
+		assert.Nil(t, token)
 
 		mockUserRepo.AssertExpectations(t)
 	})
 
 	t.Run("db error on get user", func(t *testing.T) {
 		mockUserRepo.ExpectedCalls = nil
-		mockUserRepo.On("GetUserByName", "alex").
+		mockUserRepo.On("GetUserByName", mock.Anything, "alex").
 			Return((*domain.User)(nil), errors.New("db error")).Once()
 
-		token, err := authSvc.Login("alex", "12345")
+		token, err := authSvc.Login(ctx, "alex", "12345", "")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "db error")
-		assert.Empty(t, token)
+		assert.Nil(t, token)
 
 		mockUserRepo.AssertExpectations(t)
 	})
@@ -86,12 +140,12 @@ func TestAuthService_Login(t *testing.T) {
 	t.Run("invalid password", func(t *testing.T) {
 		mockUserRepo.ExpectedCalls = nil
 		user := &domain.User{ID: 1, Username: "alex", PasswordHash: "wrong-hash"}
-		mockUserRepo.On("GetUserByName", "alex").
+		mockUserRepo.On("GetUserByName", mock.Anything, "alex").
 			Return(user, nil).Once()
 
-		token, err := authSvc.Login("alex", "bad-pass")
-		assert.Error(t, err)
-		assert.Empty(t, token)
+		token, err := authSvc.Login(ctx, "alex", "bad-pass", "")
+		assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+		assert.Nil(t, token)
 
 		mockUserRepo.AssertExpectations(t)
 	})
@@ -101,13 +155,86 @@ func TestAuthService_Login(t *testing.T) {
 		hashed, _ := services.HashPassword("12345")
 		user := &domain.User{ID: 1, Username: "alex", PasswordHash: hashed}
 
-		mockUserRepo.On("GetUserByName", "alex").
+		mockUserRepo.On("GetUserByName", mock.Anything, "alex").
 			Return(user, nil).Once()
+		mockTokenRepo.On("CreateRefreshToken", mock.Anything, mock.Anything).
+			Return(nil).Once()
 
-		token, err := authSvc.Login("alex", "12345")
+		tokens, err := authSvc.Login(ctx, "alex", "12345", "")
 		assert.NoError(t, err)
-		assert.NotEmpty(t, token)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.NotEmpty(t, tokens.RefreshToken)
+
+		mockUserRepo.AssertExpectations(t)
+		mockTokenRepo.AssertExpectations(t)
+	})
+}
+
+func TestAuthService_Refresh(t *testing.T) {
+	ctx := context.Background()
+	mockUserRepo := new(mocks.MockUserRepository)
+	mockTokenRepo := new(mocks.MockTokenRepository)
+	mockUow := mocks.NewMockUnitOfWork(&repositories.Repositories{
+		Users:  mockUserRepo,
+		Tokens: mockTokenRepo,
+	})
+	authSvc := services.NewAuthService(mockUserRepo, mockTokenRepo, mockUow, services.AuthOptions{JWTSecret: "test_secret"})
+
+	t.Run("unknown token", func(t *testing.T) {
+		mockTokenRepo.On("GetRefreshTokenByHash", mock.Anything, mock.Anything).
+			Return((*domain.RefreshToken)(nil), nil).Once()
+
+		tokens, err := authSvc.Refresh(ctx, "unknown")
+		assert.ErrorIs(t, err, services.ErrInvalidRefreshToken)
+		assert.Nil(t, tokens)
+
+		mockTokenRepo.AssertExpectations(t)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		mockTokenRepo.ExpectedCalls = nil
+		mockTokenRepo.On("GetRefreshTokenByHash", mock.Anything, mock.Anything).
+			Return(&domain.RefreshToken{ID: 1, UserID: 1, ExpiresAt: time.Now().Add(-time.Minute)}, nil).Once()
+
+		_, err := authSvc.Refresh(ctx, "expired")
+		assert.ErrorIs(t, err, services.ErrInvalidRefreshToken)
+
+		mockTokenRepo.AssertExpectations(t)
+	})
+
+	t.Run("reused token revokes every refresh token of the user", func(t *testing.T) {
+		mockTokenRepo.ExpectedCalls = nil
+		revokedAt := time.Now().Add(-time.Minute)
+		mockTokenRepo.On("GetRefreshTokenByHash", mock.Anything, mock.Anything).
+			Return(&domain.RefreshToken{ID: 1, UserID: 3, ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &revokedAt}, nil).Once()
+		mockTokenRepo.On("RevokeUserRefreshTokens", mock.Anything, uint(3), mock.Anything).
+			Return(nil).Once()
+
+		_, err := authSvc.Refresh(ctx, "stolen")
+		assert.ErrorIs(t, err, services.ErrInvalidRefreshToken)
+
+		mockTokenRepo.AssertExpectations(t)
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		mockTokenRepo.ExpectedCalls = nil
+		mockTokenRepo.On("GetRefreshTokenByHash", mock.Anything, mock.Anything).
+			Return(&domain.RefreshToken{ID: 1, UserID: 3, ExpiresAt: time.Now().Add(time.Hour)}, nil).Once()
+		mockTokenRepo.On("RevokeRefreshToken", mock.Anything, uint(1), mock.Anything).
+			Return(true, nil).Once()
+		mockUserRepo.On("GetUserByID", mock.Anything, uint(3)).
+			Return(&domain.User{ID: 3, Username: "alex"}, nil).Once()
+		mockTokenRepo.On("CreateRefreshToken", mock.Anything, mock.MatchedBy(func(token *domain.RefreshToken) bool {
+			return token.UserID == 3
+		})).Return(nil).Once()
+
+		tokens, err := authSvc.Refresh(ctx, "valid")
+		assert.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.NotEmpty(t, tokens.RefreshToken)
+		assert.NotEqual(t, "valid", tokens.RefreshToken)
 
+		mockTokenRepo.AssertExpectations(t)
 		mockUserRepo.AssertExpectations(t)
 	})
 }
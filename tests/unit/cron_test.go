@@ -0,0 +1,55 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/schedule"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCron_Next(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04", value)
+		require.NoError(t, err)
+		return parsed
+	}
+
+	cases := []struct {
+		expr  string
+		after string
+		want  string
+	}{
+		{"*/15 * * * *", "2024-03-01 10:07", "2024-03-01 10:15"},
+		{"0 10 * * mon", "2024-03-01 10:07", "2024-03-04 10:00"},
+		{"0 10 * * 1", "2024-03-04 10:00", "2024-03-11 10:00"},
+		{"30 9 1 * *", "2024-03-01 10:07", "2024-04-01 09:30"},
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"0 12 * * 7", "2024-03-01 10:07", "2024-03-03 12:00"},
+		{"0 8-18/5 * * *", "2024-03-01 10:07", "2024-03-01 13:00"},
+		{"0 0 13 * fri", "2024-03-01 10:07", "2024-03-08 00:00"},
+		{"0 0 */1 * mon", "2024-03-01 10:07", "2024-03-04 00:00"},
+		{"0 0 1 * */1", "2024-03-01 10:07", "2024-04-01 00:00"},
+		{"@monthly", "2024-12-31 23:59", "2025-01-01 00:00"},
+		{"@weekly", "2024-03-01 10:07", "2024-03-03 00:00"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			cron, err := schedule.ParseCron(tc.expr)
+			require.NoError(t, err)
+			assert.Equal(t, at(tc.want), cron.Next(at(tc.after)))
+		})
+	}
+}
+
+func TestCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		_, err := schedule.ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+
+	cron, err := schedule.ParseCron("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, cron.Next(time.Now()).IsZero())
+}
@@ -0,0 +1,124 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/server"
+	"avito-tech-go/internal/services"
+	"avito-tech-go/tests/unit/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthService_Ready(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Ready", func(t *testing.T) {
+		repo := new(mocks.MockHealthRepository)
+		repo.On("Ping", mock.Anything).Return(nil)
+		repo.On("MissingTables", mock.Anything).Return(nil, nil)
+
+		assert.NoError(t, services.NewHealthService(repo).Ready(ctx))
+	})
+
+	t.Run("Database is down", func(t *testing.T) {
+		repo := new(mocks.MockHealthRepository)
+		repo.On("Ping", mock.Anything).Return(errors.New("connection refused"))
+
+		err := services.NewHealthService(repo).Ready(ctx)
+		require.ErrorIs(t, err, services.ErrNotReady)
+		assert.Contains(t, err.Error(), "connection refused")
+		repo.AssertNotCalled(t, "MissingTables", mock.Anything)
+	})
+
+	t.Run("Migrations are not applied", func(t *testing.T) {
+		repo := new(mocks.MockHealthRepository)
+		repo.On("Ping", mock.Anything).Return(nil)
+		repo.On("MissingTables", mock.Anything).Return([]string{"allowance_grants", "transfer_limits"}, nil)
+
+		err := services.NewHealthService(repo).Ready(ctx)
+		require.ErrorIs(t, err, services.ErrNotReady)
+		assert.Contains(t, err.Error(), "allowance_grants, transfer_limits")
+	})
+}
+
+func TestServe_GracefulShutdown(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// start serves a handler that blocks until release is closed. It returns the address,
+	// a channel closed once the handler is entered, the stop function and the result of
+	// Serve.
+	start := func(t *testing.T, release <-chan struct{}, drainTimeout time.Duration) (string, <-chan struct{}, context.CancelFunc, <-chan error) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		started := make(chan struct{})
+		srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusNoContent)
+		})}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- server.Serve(ctx, srv, ln, drainTimeout, logger)
+		}()
+		return ln.Addr().String(), started, cancel, done
+	}
+
+	t.Run("Request in flight is finished", func(t *testing.T) {
+		release := make(chan struct{})
+		addr, started, stop, done := start(t, release, 5*time.Second)
+
+		responses := make(chan *http.Response, 1)
+		go func() {
+			resp, err := http.Get("http://" + addr)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+			responses <- resp
+		}()
+		<-started
+		stop()
+
+		select {
+		case err := <-done:
+			t.Fatalf("server stopped with a request in flight: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		close(release)
+		require.NoError(t, <-done)
+		resp := <-responses
+		require.NotNil(t, resp)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		_, err := net.Dial("tcp", addr)
+		assert.Error(t, err, "listener is still open")
+	})
+
+	t.Run("Drain timeout closes stuck requests", func(t *testing.T) {
+		release := make(chan struct{})
+		defer close(release)
+		addr, started, stop, done := start(t, release, 50*time.Millisecond)
+
+		go func() {
+			if resp, err := http.Get("http://" + addr); err == nil {
+				_ = resp.Body.Close()
+			}
+		}()
+		<-started
+		stop()
+
+		err := <-done
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
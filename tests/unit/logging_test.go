@@ -0,0 +1,139 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/config"
+	"avito-tech-go/internal/logging"
+	"avito-tech-go/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLoggedRouter(buf *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := logging.New(buf, slog.LevelInfo)
+
+	r := gin.New()
+	r.Use(middleware.RequestIDMiddleware(), middleware.RequestLoggerMiddleware(logger), middleware.RecoveryMiddleware(logger))
+	r.GET("/public", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	r.GET("/private", middleware.JWTAuthMiddleware("secret", nil), func(c *gin.Context) {
+		logger.InfoContext(c.Request.Context(), "inside handler")
+		c.Status(http.StatusOK)
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+	return r
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+	for _, raw := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(raw, &line))
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	r := newLoggedRouter(&buf)
+
+	t.Run("Generates an ID", func(t *testing.T) {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/public", nil))
+
+		id := w.Header().Get(middleware.RequestIDHeader)
+		assert.Len(t, id, 32)
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 1)
+		assert.Equal(t, id, lines[0]["request_id"])
+		assert.Equal(t, "/public", lines[0]["route"])
+		assert.Equal(t, float64(http.StatusNoContent), lines[0]["status"])
+	})
+
+	t.Run("Keeps the client's ID", func(t *testing.T) {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/public", nil)
+		req.Header.Set(middleware.RequestIDHeader, "client-id-1")
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, "client-id-1", w.Header().Get(middleware.RequestIDHeader))
+		assert.Equal(t, "client-id-1", logLines(t, &buf)[0]["request_id"])
+	})
+
+	t.Run("Replaces IDs that could forge log lines", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/public", nil)
+		req.Header.Set(middleware.RequestIDHeader, "id with spaces")
+		r.ServeHTTP(w, req)
+
+		assert.NotEqual(t, "id with spaces", w.Header().Get(middleware.RequestIDHeader))
+	})
+
+	t.Run("User ID is logged after authentication", func(t *testing.T) {
+		buf.Reset()
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"user_id": 42,
+			"jti":     "token-1",
+			"exp":     time.Now().Add(time.Minute).Unix(),
+		}).SignedString([]byte("secret"))
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/private", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set(middleware.RequestIDHeader, "req-42")
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 2)
+		for _, line := range lines {
+			assert.Equal(t, "req-42", line["request_id"])
+			assert.Equal(t, float64(42), line["user_id"])
+		}
+	})
+
+	t.Run("Panics are logged as errors", func(t *testing.T) {
+		buf.Reset()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 2)
+		assert.Equal(t, "panic while serving request", lines[0]["msg"])
+		assert.Equal(t, "ERROR", lines[1]["level"])
+	})
+}
+
+func TestConfig_RedactsSecrets(t *testing.T) {
+	cfg := &config.Config{AppPort: "8080", DBPass: "db-password", JWTSecret: "jwt-secret"}
+
+	printed := fmt.Sprintf("%+v", cfg)
+	assert.NotContains(t, printed, "db-password")
+	assert.NotContains(t, printed, "jwt-secret")
+	assert.Contains(t, printed, "AppPort=8080")
+
+	var buf bytes.Buffer
+	logging.New(&buf, slog.LevelInfo).Info("config loaded", "config", cfg)
+	assert.NotContains(t, buf.String(), "db-password")
+	assert.NotContains(t, buf.String(), "jwt-secret")
+	assert.Contains(t, buf.String(), `"JWTSecret":"[REDACTED]"`)
+}
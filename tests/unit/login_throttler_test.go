@@ -0,0 +1,171 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"avito-tech-go/tests/unit/mocks"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginThrottler(t *testing.T) {
+	ctx := context.Background()
+	policy := services.LoginThrottlePolicy{
+		UserAttempts: 3,
+		IPAttempts:   5,
+		BaseLockout:  time.Minute,
+		MaxLockout:   5 * time.Minute,
+		ResetAfter:   time.Hour,
+	}
+	newThrottler := func(now *time.Time, eventRepo *mocks.MockSecurityEventRepository) services.LoginThrottler {
+		return services.NewLoginThrottler(services.NewMemoryLoginAttemptStore(), eventRepo, policy, func() time.Time {
+			return *now
+		})
+	}
+	retryAfter := func(err error) time.Duration {
+		var locked *services.LoginLockedError
+		require.True(t, errors.As(err, &locked))
+		return locked.RetryAfter
+	}
+
+	// fail makes a failed attempt, which must not be refused.
+	fail := func(t *testing.T, throttler services.LoginThrottler, username, ip string) {
+		reservation, err := throttler.Reserve(username, ip)
+		require.NoError(t, err)
+		require.NoError(t, throttler.Failed(ctx, reservation))
+	}
+	// check reports whether an attempt would be refused, without counting it.
+	check := func(throttler services.LoginThrottler, username, ip string) error {
+		reservation, err := throttler.Reserve(username, ip)
+		if err == nil {
+			throttler.Release(reservation)
+		}
+		return err
+	}
+
+	t.Run("lockout doubles and is capped", func(t *testing.T) {
+		now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		eventRepo := new(mocks.MockSecurityEventRepository)
+		eventRepo.On("CreateEvent", mock.Anything, mock.MatchedBy(func(e *domain.SecurityEvent) bool {
+			return e.Type == domain.SecurityEventLoginLockout && e.Username == "alex" && e.IP == ""
+		})).Return(nil)
+		throttler := newThrottler(&now, eventRepo)
+
+		for i := 0; i < 3; i++ {
+			fail(t, throttler, "alex", "")
+		}
+		require.NoError(t, check(throttler, "alex", ""))
+
+		for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+			fail(t, throttler, "alex", "")
+			err := check(throttler, "alex", "")
+			assert.ErrorIs(t, err, services.ErrTooManyLoginAttempts)
+			assert.Equal(t, want, retryAfter(err))
+
+			now = now.Add(want - time.Second)
+			assert.Error(t, check(throttler, "alex", ""))
+			now = now.Add(time.Second)
+			assert.NoError(t, check(throttler, "alex", ""))
+		}
+
+		eventRepo.AssertNumberOfCalls(t, "CreateEvent", 5)
+	})
+
+	t.Run("success resets the username but not the IP", func(t *testing.T) {
+		now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		eventRepo := new(mocks.MockSecurityEventRepository)
+		eventRepo.On("CreateEvent", mock.Anything, mock.MatchedBy(func(e *domain.SecurityEvent) bool {
+			return e.Username == "" && e.IP == "10.0.0.1"
+		})).Return(nil).Once()
+		throttler := newThrottler(&now, eventRepo)
+
+		for _, username := range []string{"a", "b", "a", "b"} {
+			fail(t, throttler, username, "10.0.0.1")
+		}
+		// A successful login is not counted against the IP.
+		reservation, err := throttler.Reserve("a", "10.0.0.1")
+		require.NoError(t, err)
+		throttler.Succeeded(reservation)
+		assert.NoError(t, check(throttler, "a", "10.0.0.2"))
+
+		fail(t, throttler, "c", "10.0.0.1")
+		fail(t, throttler, "c", "10.0.0.1")
+		assert.ErrorIs(t, check(throttler, "d", "10.0.0.1"), services.ErrTooManyLoginAttempts)
+		assert.NoError(t, check(throttler, "d", "10.0.0.2"))
+
+		eventRepo.AssertExpectations(t)
+	})
+
+	t.Run("parallel attempts are counted before the password is checked", func(t *testing.T) {
+		now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		eventRepo := new(mocks.MockSecurityEventRepository)
+		eventRepo.On("CreateEvent", mock.Anything, mock.Anything).Return(nil)
+		throttler := newThrottler(&now, eventRepo)
+
+		var admitted atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := throttler.Reserve("alex", ""); err == nil {
+					admitted.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		// The free attempts and the one that starts the lockout.
+		assert.Equal(t, int32(policy.UserAttempts+1), admitted.Load())
+	})
+
+	t.Run("failures are forgotten after the reset window", func(t *testing.T) {
+		now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		throttler := newThrottler(&now, nil)
+
+		for i := 0; i < 3; i++ {
+			fail(t, throttler, "alex", "")
+		}
+		now = now.Add(policy.ResetAfter + time.Second)
+		assert.Equal(t, 1, throttler.Prune())
+
+		fail(t, throttler, "alex", "")
+		assert.NoError(t, check(throttler, "alex", ""))
+	})
+}
+
+func TestAuthService_Login_Throttled(t *testing.T) {
+	ctx := context.Background()
+	mockUserRepo := new(mocks.MockUserRepository)
+	mockTokenRepo := new(mocks.MockTokenRepository)
+	throttler := services.NewLoginThrottler(services.NewMemoryLoginAttemptStore(), nil, services.LoginThrottlePolicy{
+		UserAttempts: 2,
+	}, nil)
+	authSvc := services.NewAuthService(mockUserRepo, mockTokenRepo, mocks.NewMockUnitOfWork(&repositories.Repositories{}), services.AuthOptions{
+		JWTSecret: "test_secret",
+		Throttler: throttler,
+	})
+
+	mockUserRepo.On("GetUserByName", mock.Anything, "ghost").
+		Return((*domain.User)(nil), nil).Times(3)
+
+	for i := 0; i < 3; i++ {
+		_, err := authSvc.Login(ctx, "ghost", "guess", "")
+		assert.ErrorIs(t, err, services.ErrUserNotFound)
+	}
+
+	_, err := authSvc.Login(ctx, "ghost", "guess", "")
+	assert.ErrorIs(t, err, services.ErrTooManyLoginAttempts)
+
+	mockUserRepo.AssertNumberOfCalls(t, "GetUserByName", 3)
+}
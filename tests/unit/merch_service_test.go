@@ -1,45 +1,45 @@
 package unit
 
 import (
+	"context"
+	"errors"
+	"math"
 	"testing"
 
 	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
 	"avito-tech-go/internal/services"
 	"avito-tech-go/tests/unit/mocks"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
 )
 
 func TestMerchService_BuyItem(t *testing.T) {
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		t.Fatalf("failed to open in-memory sqlite database: %v", err)
-	}
-
-	err = db.AutoMigrate(&domain.User{}, &domain.MerchItem{}, &domain.InventoryItem{}, &domain.Transaction{})
-	if err != nil {
-		t.Fatalf("failed to migrate models: %v", err)
-	}
-
+	ctx := context.Background()
 	mockMerchRepo := new(mocks.MockMerchRepository)
 	mockUserRepo := new(mocks.MockUserRepository)
 	mockTxRepo := new(mocks.MockTransactionRepository)
 	mockInvRepo := new(mocks.MockInventoryRepository)
 
-	merchSvc := services.NewMerchService(mockMerchRepo, mockUserRepo, mockTxRepo, mockInvRepo, db)
+	mockUow := mocks.NewMockUnitOfWork(&repositories.Repositories{
+		Users:        mockUserRepo,
+		Inventory:    mockInvRepo,
+		Merch:        mockMerchRepo,
+		Transactions: mockTxRepo,
+	})
+
+	merchSvc := services.NewMerchService(mockMerchRepo, mockUserRepo, mockUow)
 
 	t.Run("merch item not found", func(t *testing.T) {
 		mockMerchRepo.ExpectedCalls = nil
 
-		mockMerchRepo.On("GetMerchItemByType", "unknown").
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "unknown").
 			Return((*domain.MerchItem)(nil), nil).Once()
 
-		err := merchSvc.BuyItem(1, "unknown")
-		assert.Error(t, err)
-		assert.Contains(t, err.Error(), "merch item 'unknown' not found")
+		err := merchSvc.BuyItem(ctx, 1, "unknown")
+		assert.ErrorIs(t, err, services.ErrMerchItemNotFound)
+		assert.Contains(t, err.Error(), "'unknown'")
 
 		mockMerchRepo.AssertExpectations(t)
 	})
@@ -48,13 +48,13 @@ func TestMerchService_BuyItem(t *testing.T) {
 		mockMerchRepo.ExpectedCalls = nil
 		mockUserRepo.ExpectedCalls = nil
 
-		mockMerchRepo.On("GetMerchItemByType", "t-shirt").
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "t-shirt").
 			Return(&domain.MerchItem{ItemType: "t-shirt", Price: 80}, nil).Once()
 
-		mockUserRepo.On("GetUserByID", uint(10)).
-			Return((*domain.User)(nil), nil).Once()
+		mockUserRepo.On("LockUsersByIDs", mock.Anything, []uint{10}).
+			Return(map[uint]*domain.User{}, nil).Once()
 
-		err := merchSvc.BuyItem(10, "t-shirt")
+		err := merchSvc.BuyItem(ctx, 10, "t-shirt")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "user 10 not found")
 
@@ -66,13 +66,13 @@ func TestMerchService_BuyItem(t *testing.T) {
 		mockMerchRepo.ExpectedCalls = nil
 		mockUserRepo.ExpectedCalls = nil
 
-		mockMerchRepo.On("GetMerchItemByType", "t-shirt").
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "t-shirt").
 			Return(&domain.MerchItem{ItemType: "t-shirt", Price: 80}, nil).Once()
 
-		mockUserRepo.On("GetUserByID", uint(1)).
-			Return(&domain.User{ID: 1, Coins: 50}, nil).Once()
+		mockUserRepo.On("LockUsersByIDs", mock.Anything, []uint{1}).
+			Return(map[uint]*domain.User{1: {ID: 1, Coins: 50}}, nil).Once()
 
-		err := merchSvc.BuyItem(1, "t-shirt")
+		err := merchSvc.BuyItem(ctx, 1, "t-shirt")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "does not have enough coins")
 
@@ -86,28 +86,26 @@ func TestMerchService_BuyItem(t *testing.T) {
 		mockInvRepo.ExpectedCalls = nil
 		mockTxRepo.ExpectedCalls = nil
 
-		mockMerchRepo.On("GetMerchItemByType", "t-shirt").
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "t-shirt").
 			Return(&domain.MerchItem{ItemType: "t-shirt", Price: 80}, nil).Once()
 
-		mockUserRepo.On("GetUserByID", uint(1)).
-			Return(&domain.User{ID: 1, Coins: 100}, nil).Once()
+		mockUserRepo.On("LockUsersByIDs", mock.Anything, []uint{1}).
+			Return(map[uint]*domain.User{1: {ID: 1, Coins: 100}}, nil).Once()
 
-		mockUserRepo.On("UpdateUser", mock.MatchedBy(func(user *domain.User) bool {
-			return user.ID == 1 && user.Coins == 20
-		})).Return(nil).Once()
+		mockUserRepo.On("ChangeCoins", mock.Anything, uint(1), -80).Return(nil).Once()
 
-		mockInvRepo.On("GetByUserAndType", uint(1), "t-shirt").
+		mockInvRepo.On("GetByUserAndType", mock.Anything, uint(1), "t-shirt").
 			Return((*domain.InventoryItem)(nil), nil).Once()
 
-		mockInvRepo.On("CreateItem", mock.MatchedBy(func(item *domain.InventoryItem) bool {
+		mockInvRepo.On("CreateItem", mock.Anything, mock.MatchedBy(func(item *domain.InventoryItem) bool {
 			return item.UserID == 1 && item.ItemType == "t-shirt" && item.Quantity == 1
 		})).Return(nil).Once()
 
-		mockTxRepo.On("CreateTransaction", mock.MatchedBy(func(tx *domain.Transaction) bool {
+		mockTxRepo.On("CreateTransaction", mock.Anything, mock.MatchedBy(func(tx *domain.Transaction) bool {
 			return tx.FromUserID == 1 && tx.Amount == 80 && tx.Type == domain.Purchase
 		})).Return(nil).Once()
 
-		err := merchSvc.BuyItem(1, "t-shirt")
+		err := merchSvc.BuyItem(ctx, 1, "t-shirt")
 		assert.NoError(t, err)
 
 		mockMerchRepo.AssertExpectations(t)
@@ -122,29 +120,215 @@ func TestMerchService_BuyItem(t *testing.T) {
 		mockInvRepo.ExpectedCalls = nil
 		mockTxRepo.ExpectedCalls = nil
 
-		mockMerchRepo.On("GetMerchItemByType", "t-shirt").
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "t-shirt").
 			Return(&domain.MerchItem{ItemType: "t-shirt", Price: 80}, nil).Once()
 
-		mockUserRepo.On("GetUserByID", uint(2)).
-			Return(&domain.User{ID: 2, Coins: 300}, nil).Once()
+		mockUserRepo.On("LockUsersByIDs", mock.Anything, []uint{2}).
+			Return(map[uint]*domain.User{2: {ID: 2, Coins: 300}}, nil).Once()
 
-		mockUserRepo.On("UpdateUser", mock.MatchedBy(func(user *domain.User) bool {
-			return user.ID == 2 && user.Coins == 220
-		})).Return(nil).Once()
+		mockUserRepo.On("ChangeCoins", mock.Anything, uint(2), -80).Return(nil).Once()
 
-		mockInvRepo.On("GetByUserAndType", uint(2), "t-shirt").
+		mockInvRepo.On("GetByUserAndType", mock.Anything, uint(2), "t-shirt").
 			Return(&domain.InventoryItem{ID: 100, Quantity: 1, UserID: 2, ItemType: "t-shirt"}, nil).Once()
 
-		mockInvRepo.On("UpdateItem", mock.MatchedBy(func(item *domain.InventoryItem) bool {
+		mockInvRepo.On("UpdateItem", mock.Anything, mock.MatchedBy(func(item *domain.InventoryItem) bool {
 			return item.ID == 100 && item.Quantity == 2
 		})).Return(nil).Once()
 
-		mockTxRepo.On("CreateTransaction", mock.MatchedBy(func(tx *domain.Transaction) bool {
+		mockTxRepo.On("CreateTransaction", mock.Anything, mock.MatchedBy(func(tx *domain.Transaction) bool {
 			return tx.FromUserID == 2 && tx.Amount == 80 && tx.Type == domain.Purchase
 		})).Return(nil).Once()
 
-		err := merchSvc.BuyItem(2, "t-shirt")
+		err := merchSvc.BuyItem(ctx, 2, "t-shirt")
+		assert.NoError(t, err)
+
+		mockMerchRepo.AssertExpectations(t)
+		mockUserRepo.AssertExpectations(t)
+		mockInvRepo.AssertExpectations(t)
+		mockTxRepo.AssertExpectations(t)
+	})
+	t.Run("transaction error is propagated", func(t *testing.T) {
+		mockMerchRepo.ExpectedCalls = nil
+		mockUserRepo.ExpectedCalls = nil
+		mockInvRepo.ExpectedCalls = nil
+		mockTxRepo.ExpectedCalls = nil
+
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "cup").
+			Return(&domain.MerchItem{ItemType: "cup", Price: 20}, nil).Once()
+
+		mockUserRepo.On("LockUsersByIDs", mock.Anything, []uint{3}).
+			Return(map[uint]*domain.User{3: {ID: 3, Coins: 100}}, nil).Once()
+
+		mockUserRepo.On("ChangeCoins", mock.Anything, uint(3), -20).Return(nil).Once()
+
+		mockInvRepo.On("GetByUserAndType", mock.Anything, uint(3), "cup").
+			Return((*domain.InventoryItem)(nil), nil).Once()
+
+		mockInvRepo.On("CreateItem", mock.Anything, mock.Anything).Return(nil).Once()
+
+		mockTxRepo.On("CreateTransaction", mock.Anything, mock.Anything).
+			Return(errors.New("db error")).Once()
+
+		err := merchSvc.BuyItem(ctx, 3, "cup")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "db error")
+
+		mockTxRepo.AssertExpectations(t)
+	})
+	t.Run("balance spent concurrently", func(t *testing.T) {
+		mockMerchRepo.ExpectedCalls = nil
+		mockUserRepo.ExpectedCalls = nil
+
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "cup").
+			Return(&domain.MerchItem{ItemType: "cup", Price: 20}, nil).Once()
+
+		mockUserRepo.On("LockUsersByIDs", mock.Anything, []uint{4}).
+			Return(map[uint]*domain.User{4: {ID: 4, Coins: 20}}, nil).Once()
+
+		mockUserRepo.On("ChangeCoins", mock.Anything, uint(4), -20).
+			Return(repositories.ErrInsufficientCoins).Once()
+
+		err := merchSvc.BuyItem(ctx, 4, "cup")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "does not have enough coins")
+
+		mockUserRepo.AssertExpectations(t)
+	})
+	t.Run("out of stock", func(t *testing.T) {
+		mockMerchRepo.ExpectedCalls = nil
+		mockUserRepo.ExpectedCalls = nil
+
+		stock := 0
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "pink-hoody").
+			Return(&domain.MerchItem{ItemType: "pink-hoody", Price: 500, Stock: &stock}, nil).Once()
+
+		mockUserRepo.On("LockUsersByIDs", mock.Anything, []uint{5}).
+			Return(map[uint]*domain.User{5: {ID: 5, Coins: 1000}}, nil).Once()
+
+		mockMerchRepo.On("DecrementStock", mock.Anything, "pink-hoody", 1).
+			Return(repositories.ErrOutOfStock).Once()
+
+		err := merchSvc.BuyItem(ctx, 5, "pink-hoody")
+		assert.ErrorIs(t, err, services.ErrOutOfStock)
+
+		mockMerchRepo.AssertExpectations(t)
+		mockUserRepo.AssertExpectations(t)
+	})
+}
+
+func TestMerchService_BuyItems(t *testing.T) {
+	ctx := context.Background()
+	mockMerchRepo := new(mocks.MockMerchRepository)
+	mockUserRepo := new(mocks.MockUserRepository)
+	mockTxRepo := new(mocks.MockTransactionRepository)
+	mockInvRepo := new(mocks.MockInventoryRepository)
+
+	mockUow := mocks.NewMockUnitOfWork(&repositories.Repositories{
+		Users:        mockUserRepo,
+		Inventory:    mockInvRepo,
+		Merch:        mockMerchRepo,
+		Transactions: mockTxRepo,
+	})
+
+	merchSvc := services.NewMerchService(mockMerchRepo, mockUserRepo, mockUow)
+
+	t.Run("invalid quantity", func(t *testing.T) {
+		_, err := merchSvc.BuyItems(ctx, 1, []services.PurchaseLine{{ItemType: "cup", Quantity: 0}})
+		assert.ErrorIs(t, err, services.ErrInvalidQuantity)
+	})
+
+	t.Run("quantity above the limit", func(t *testing.T) {
+		_, err := merchSvc.BuyItems(ctx, 1, []services.PurchaseLine{{ItemType: "pen", Quantity: 1844674407370955061}})
+		assert.ErrorIs(t, err, services.ErrInvalidQuantity)
+
+		_, err = merchSvc.BuyItems(ctx, 1, []services.PurchaseLine{
+			{ItemType: "pen", Quantity: services.MaxPurchaseQuantity},
+			{ItemType: "pen", Quantity: 1},
+		})
+		assert.ErrorIs(t, err, services.ErrInvalidQuantity)
+	})
+
+	t.Run("total overflow", func(t *testing.T) {
+		mockMerchRepo.ExpectedCalls = nil
+		mockUserRepo.ExpectedCalls = nil
+
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "yacht").
+			Return(&domain.MerchItem{ItemType: "yacht", Price: math.MaxInt / 2}, nil).Once()
+
+		_, err := merchSvc.BuyItems(ctx, 1, []services.PurchaseLine{{ItemType: "yacht", Quantity: 3}})
+		assert.ErrorIs(t, err, services.ErrAmountTooLarge)
+		mockUserRepo.AssertNotCalled(t, "LockUsersByIDs", mock.Anything, mock.Anything)
+		mockUserRepo.AssertNotCalled(t, "ChangeCoins", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("empty order", func(t *testing.T) {
+		_, err := merchSvc.BuyItems(ctx, 1, nil)
+		assert.ErrorIs(t, err, services.ErrEmptyPurchase)
+	})
+
+	t.Run("total exceeds balance", func(t *testing.T) {
+		mockMerchRepo.ExpectedCalls = nil
+		mockUserRepo.ExpectedCalls = nil
+
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "cup").
+			Return(&domain.MerchItem{ItemType: "cup", Price: 20}, nil).Once()
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "pen").
+			Return(&domain.MerchItem{ItemType: "pen", Price: 10}, nil).Once()
+
+		mockUserRepo.On("LockUsersByIDs", mock.Anything, []uint{1}).
+			Return(map[uint]*domain.User{1: {ID: 1, Coins: 69}}, nil).Once()
+
+		_, err := merchSvc.BuyItems(ctx, 1, []services.PurchaseLine{
+			{ItemType: "pen", Quantity: 3},
+			{ItemType: "cup", Quantity: 2},
+		})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "does not have enough coins")
+
+		mockMerchRepo.AssertExpectations(t)
+		mockUserRepo.AssertExpectations(t)
+	})
+
+	t.Run("repeated lines are merged and debited once", func(t *testing.T) {
+		mockMerchRepo.ExpectedCalls = nil
+		mockUserRepo.ExpectedCalls = nil
+		mockInvRepo.ExpectedCalls = nil
+		mockTxRepo.ExpectedCalls = nil
+
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "cup").
+			Return(&domain.MerchItem{ItemType: "cup", Price: 20}, nil).Once()
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "pen").
+			Return(&domain.MerchItem{ItemType: "pen", Price: 10}, nil).Once()
+
+		mockUserRepo.On("LockUsersByIDs", mock.Anything, []uint{1}).
+			Return(map[uint]*domain.User{1: {ID: 1, Coins: 100}}, nil).Once()
+		mockUserRepo.On("ChangeCoins", mock.Anything, uint(1), -70).Return(nil).Once()
+
+		mockInvRepo.On("GetByUserAndType", mock.Anything, uint(1), "cup").
+			Return((*domain.InventoryItem)(nil), nil).Once()
+		mockInvRepo.On("CreateItem", mock.Anything, mock.MatchedBy(func(item *domain.InventoryItem) bool {
+			return item.ItemType == "cup" && item.Quantity == 2
+		})).Return(nil).Once()
+		mockInvRepo.On("GetByUserAndType", mock.Anything, uint(1), "pen").
+			Return(&domain.InventoryItem{ID: 7, UserID: 1, ItemType: "pen", Quantity: 1}, nil).Once()
+		mockInvRepo.On("UpdateItem", mock.Anything, mock.MatchedBy(func(item *domain.InventoryItem) bool {
+			return item.ID == 7 && item.Quantity == 4
+		})).Return(nil).Once()
+
+		mockTxRepo.On("CreateTransaction", mock.Anything, mock.MatchedBy(func(tx *domain.Transaction) bool {
+			return tx.ItemType == "cup" && tx.Quantity == 2 && tx.Amount == 40 && tx.Type == domain.Purchase
+		})).Return(nil).Once()
+		mockTxRepo.On("CreateTransaction", mock.Anything, mock.MatchedBy(func(tx *domain.Transaction) bool {
+			return tx.ItemType == "pen" && tx.Quantity == 3 && tx.Amount == 30 && tx.Type == domain.Purchase
+		})).Return(nil).Once()
+
+		spent, err := merchSvc.BuyItems(ctx, 1, []services.PurchaseLine{
+			{ItemType: "pen", Quantity: 1},
+			{ItemType: "cup", Quantity: 2},
+			{ItemType: "pen", Quantity: 2},
+		})
 		assert.NoError(t, err)
+		assert.Equal(t, 70, spent)
 
 		mockMerchRepo.AssertExpectations(t)
 		mockUserRepo.AssertExpectations(t)
@@ -152,3 +336,83 @@ func TestMerchService_BuyItem(t *testing.T) {
 		mockTxRepo.AssertExpectations(t)
 	})
 }
+
+func TestMerchService_GetCatalog(t *testing.T) {
+	ctx := context.Background()
+	mockMerchRepo := new(mocks.MockMerchRepository)
+	mockUserRepo := new(mocks.MockUserRepository)
+	merchSvc := services.NewMerchService(mockMerchRepo, mockUserRepo, mocks.NewMockUnitOfWork(nil))
+
+	t.Run("user not found", func(t *testing.T) {
+		mockUserRepo.On("GetUserByID", mock.Anything, uint(5)).
+			Return((*domain.User)(nil), nil).Once()
+
+		catalog, err := merchSvc.GetCatalog(ctx, 5)
+		assert.Error(t, err)
+		assert.Nil(t, catalog)
+		assert.Contains(t, err.Error(), "user 5 not found")
+
+		mockUserRepo.AssertExpectations(t)
+	})
+
+	t.Run("affordability and stock", func(t *testing.T) {
+		soldOut := 0
+		mockMerchRepo.ExpectedCalls = nil
+		mockUserRepo.ExpectedCalls = nil
+
+		mockUserRepo.On("GetUserByID", mock.Anything, uint(1)).
+			Return(&domain.User{ID: 1, Coins: 50}, nil).Once()
+		mockMerchRepo.On("GetAllMerchItems", mock.Anything, mock.Anything).
+			Return([]domain.MerchItem{
+				{ItemType: "book", Price: 50},
+				{ItemType: "hoody", Price: 300},
+				{ItemType: "pink-hoody", Price: 500, Stock: &soldOut},
+			}, nil).Once()
+
+		catalog, err := merchSvc.GetCatalog(ctx, 1)
+		assert.NoError(t, err)
+		assert.Equal(t, &services.CatalogResponse{
+			Coins: 50,
+			Items: []services.CatalogItem{
+				{Type: "book", Price: 50, Affordable: true, InStock: true},
+				{Type: "hoody", Price: 300, Affordable: false, InStock: true},
+				{Type: "pink-hoody", Price: 500, Affordable: false, InStock: false, Stock: &soldOut},
+			},
+		}, catalog)
+
+		mockMerchRepo.AssertExpectations(t)
+		mockUserRepo.AssertExpectations(t)
+	})
+
+	t.Run("single item not found", func(t *testing.T) {
+		mockMerchRepo.ExpectedCalls = nil
+		mockUserRepo.ExpectedCalls = nil
+
+		mockUserRepo.On("GetUserByID", mock.Anything, uint(1)).
+			Return(&domain.User{ID: 1, Coins: 50}, nil).Once()
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "unknown").
+			Return((*domain.MerchItem)(nil), nil).Once()
+
+		item, err := merchSvc.GetCatalogItem(ctx, 1, "unknown")
+		assert.ErrorIs(t, err, services.ErrMerchItemNotFound)
+		assert.Nil(t, item)
+
+		mockMerchRepo.AssertExpectations(t)
+	})
+
+	t.Run("single item", func(t *testing.T) {
+		mockMerchRepo.ExpectedCalls = nil
+		mockUserRepo.ExpectedCalls = nil
+
+		mockUserRepo.On("GetUserByID", mock.Anything, uint(1)).
+			Return(&domain.User{ID: 1, Coins: 50}, nil).Once()
+		mockMerchRepo.On("GetMerchItemByType", mock.Anything, "pen").
+			Return(&domain.MerchItem{ItemType: "pen", Price: 10}, nil).Once()
+
+		item, err := merchSvc.GetCatalogItem(ctx, 1, "pen")
+		assert.NoError(t, err)
+		assert.Equal(t, &services.CatalogItem{Type: "pen", Price: 10, Affordable: true, InStock: true}, item)
+
+		mockMerchRepo.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,160 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"avito-tech-go/internal/handlers"
+	"avito-tech-go/internal/metrics"
+	"avito-tech-go/internal/middleware"
+	"avito-tech-go/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrapeMetrics(t *testing.T, r http.Handler) string {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body, err := io.ReadAll(w.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.MetricsMiddleware())
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	r.GET("/metrics-test/:item", func(c *gin.Context) {
+		c.Status(http.StatusTeapot)
+	})
+
+	for _, item := range []string{"cup", "pen"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics-test/"+item, nil))
+		require.Equal(t, http.StatusTeapot, w.Code)
+	}
+
+	body := scrapeMetrics(t, r)
+	assert.Contains(t, body, `shop_http_requests_total{method="GET",route="/metrics-test/:item",status="418"} 2`)
+	assert.Contains(t, body, `shop_http_request_duration_seconds_count{method="GET",route="/metrics-test/:item"} 2`)
+	assert.NotContains(t, body, "/metrics-test/cup")
+}
+
+func TestBusinessMetrics(t *testing.T) {
+	metrics.ItemsPurchased("metrics-test-hoody", 3)
+	metrics.TransferFailed(services.TransferFailureReason(fmt.Errorf("user 1 %w", services.ErrNotEnoughCoins)))
+
+	r := gin.New()
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	body := scrapeMetrics(t, r)
+	assert.Contains(t, body, `shop_items_purchased_total{item_type="metrics-test-hoody"} 3`)
+	assert.Contains(t, body, `shop_transfer_failures_total{reason="not_enough_coins"}`)
+}
+
+func TestTransferFailureReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("user 1 %w", services.ErrNotEnoughCoins), services.FailureNotEnoughCoins},
+		{services.ErrSelfTransfer, services.FailureInvalid},
+		{&services.BatchTransferError{}, services.FailureInvalid},
+		{&services.TransferLimitError{Code: services.LimitCodeDailyAmount}, services.LimitCodeDailyAmount},
+		{fmt.Errorf("user 7 not found"), services.FailureOther},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, services.TransferFailureReason(tt.err), tt.err.Error())
+	}
+}
+
+// stubAuthService answers logins for "alice" with password "secret" and registers
+// every other username.
+type stubAuthService struct {
+	services.AuthService
+}
+
+func (stubAuthService) Register(_ context.Context, _, _ string) (*services.TokenPair, error) {
+	return &services.TokenPair{AccessToken: "access", Registered: true}, nil
+}
+
+func (s stubAuthService) Login(_ context.Context, username, password, _ string) (*services.TokenPair, error) {
+	if username != "alice" {
+		return nil, fmt.Errorf("%w: %s", services.ErrUserNotFound, username)
+	}
+	if password != "secret" {
+		return nil, services.ErrInvalidCredentials
+	}
+	return &services.TokenPair{AccessToken: "access"}, nil
+}
+
+func (s stubAuthService) LoginOrRegister(ctx context.Context, username, password, ip string) (*services.TokenPair, error) {
+	if username != "alice" {
+		return s.Register(ctx, username, password)
+	}
+	return s.Login(ctx, username, password, ip)
+}
+
+func authEventCount(t *testing.T, r http.Handler, event string) int {
+	prefix := `shop_auth_events_total{event="` + event + `"} `
+	for _, line := range strings.Split(scrapeMetrics(t, r), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			n, err := strconv.Atoi(strings.TrimPrefix(line, prefix))
+			require.NoError(t, err)
+			return n
+		}
+	}
+	return 0
+}
+
+func TestAuthHandlersRecordAuthEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auth := stubAuthService{}
+	r := gin.New()
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+	r.POST("/api/auth", handlers.AuthHandler(auth, true))
+	r.POST("/api/register", handlers.RegisterHandler(auth))
+	r.POST("/api/login", handlers.LoginHandler(auth))
+
+	counts := func() map[string]int {
+		return map[string]int{
+			metrics.AuthRegistration: authEventCount(t, r, metrics.AuthRegistration),
+			metrics.AuthLogin:        authEventCount(t, r, metrics.AuthLogin),
+			metrics.AuthLoginFailed:  authEventCount(t, r, metrics.AuthLoginFailed),
+		}
+	}
+	before := counts()
+
+	requests := []struct {
+		path, username, password string
+		want                     int
+	}{
+		{"/api/register", "bob", "pw", http.StatusCreated},
+		{"/api/auth", "carol", "pw", http.StatusOK},
+		{"/api/auth", "alice", "secret", http.StatusOK},
+		{"/api/login", "alice", "secret", http.StatusOK},
+		{"/api/login", "alice", "wrong", http.StatusUnauthorized},
+		{"/api/login", "dave", "pw", http.StatusUnauthorized},
+		{"/api/auth", "alice", "wrong", http.StatusUnauthorized},
+	}
+	for _, req := range requests {
+		body := fmt.Sprintf(`{"username":%q,"password":%q}`, req.username, req.password)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, req.path, bytes.NewBufferString(body)))
+		require.Equal(t, req.want, w.Code, req.path+" "+req.username)
+	}
+
+	after := counts()
+	assert.Equal(t, 2, after[metrics.AuthRegistration]-before[metrics.AuthRegistration])
+	assert.Equal(t, 2, after[metrics.AuthLogin]-before[metrics.AuthLogin])
+	assert.Equal(t, 3, after[metrics.AuthLoginFailed]-before[metrics.AuthLoginFailed])
+}
@@ -0,0 +1,21 @@
+package mocks
+
+import (
+	"context"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockHealthRepository struct {
+	mock.Mock
+}
+
+func (m *MockHealthRepository) Ping(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+func (m *MockHealthRepository) MissingTables(ctx context.Context) ([]string, error) {
+	args := m.Called(ctx)
+	tables, _ := args.Get(0).([]string)
+	return tables, args.Error(1)
+}
@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"avito-tech-go/internal/domain"
+	"context"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -9,29 +10,29 @@ type MockInventoryRepository struct {
 	mock.Mock
 }
 
-func (m *MockInventoryRepository) CreateItem(item *domain.InventoryItem) error {
-	args := m.Called(item)
+func (m *MockInventoryRepository) CreateItem(ctx context.Context, item *domain.InventoryItem) error {
+	args := m.Called(ctx, item)
 	return args.Error(0)
 }
 
-func (m *MockInventoryRepository) UpdateItem(item *domain.InventoryItem) error {
-	args := m.Called(item)
+func (m *MockInventoryRepository) UpdateItem(ctx context.Context, item *domain.InventoryItem) error {
+	args := m.Called(ctx, item)
 	return args.Error(0)
 }
 
-func (m *MockInventoryRepository) GetByUserAndType(userID uint, itemType string) (*domain.InventoryItem, error) {
-	args := m.Called(userID, itemType)
+func (m *MockInventoryRepository) GetByUserAndType(ctx context.Context, userID uint, itemType string) (*domain.InventoryItem, error) {
+	args := m.Called(ctx, userID, itemType)
 	inv, _ := args.Get(0).(*domain.InventoryItem)
 	return inv, args.Error(1)
 }
 
-func (m *MockInventoryRepository) GetAllByUser(userID uint) ([]domain.InventoryItem, error) {
-	args := m.Called(userID)
+func (m *MockInventoryRepository) GetAllByUser(ctx context.Context, userID uint) ([]domain.InventoryItem, error) {
+	args := m.Called(ctx, userID)
 	invList, _ := args.Get(0).([]domain.InventoryItem)
 	return invList, args.Error(1)
 }
 
-func (m *MockInventoryRepository) DeleteItem(item *domain.InventoryItem) error {
-	args := m.Called(item)
+func (m *MockInventoryRepository) DeleteItem(ctx context.Context, item *domain.InventoryItem) error {
+	args := m.Called(ctx, item)
 	return args.Error(0)
 }
@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"avito-tech-go/internal/domain"
+	"context"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -9,29 +10,49 @@ type MockMerchRepository struct {
 	mock.Mock
 }
 
-func (m *MockMerchRepository) CreateMerchItem(item *domain.MerchItem) error {
-	args := m.Called(item)
+func (m *MockMerchRepository) CreateMerchItem(ctx context.Context, item *domain.MerchItem) error {
+	args := m.Called(ctx, item)
 	return args.Error(0)
 }
 
-func (m *MockMerchRepository) UpdateMerchItem(item *domain.MerchItem) error {
-	args := m.Called(item)
+func (m *MockMerchRepository) UpdateMerchItem(ctx context.Context, item *domain.MerchItem) error {
+	args := m.Called(ctx, item)
 	return args.Error(0)
 }
 
-func (m *MockMerchRepository) GetMerchItemByType(itemType string) (*domain.MerchItem, error) {
-	args := m.Called(itemType)
+func (m *MockMerchRepository) GetMerchItemByType(ctx context.Context, itemType string) (*domain.MerchItem, error) {
+	args := m.Called(ctx, itemType)
 	merch, _ := args.Get(0).(*domain.MerchItem)
 	return merch, args.Error(1)
 }
 
-func (m *MockMerchRepository) GetAllMerchItems() ([]domain.MerchItem, error) {
-	args := m.Called()
+func (m *MockMerchRepository) GetAllMerchItems(ctx context.Context) ([]domain.MerchItem, error) {
+	args := m.Called(ctx)
 	merchList, _ := args.Get(0).([]domain.MerchItem)
 	return merchList, args.Error(1)
 }
 
-func (m *MockMerchRepository) DeleteMerchItem(itemType string) error {
-	args := m.Called(itemType)
+func (m *MockMerchRepository) DeleteMerchItem(ctx context.Context, itemType string) error {
+	args := m.Called(ctx, itemType)
+	return args.Error(0)
+}
+
+func (m *MockMerchRepository) RestoreMerchItem(ctx context.Context, item *domain.MerchItem) (bool, error) {
+	args := m.Called(ctx, item)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockMerchRepository) SetStock(ctx context.Context, itemType string, stock *int) error {
+	args := m.Called(ctx, itemType, stock)
+	return args.Error(0)
+}
+
+func (m *MockMerchRepository) DecrementStock(ctx context.Context, itemType string, quantity int) error {
+	args := m.Called(ctx, itemType, quantity)
+	return args.Error(0)
+}
+
+func (m *MockMerchRepository) IncrementStock(ctx context.Context, itemType string, quantity int) error {
+	args := m.Called(ctx, itemType, quantity)
 	return args.Error(0)
 }
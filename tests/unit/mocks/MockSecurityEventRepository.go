@@ -0,0 +1,22 @@
+package mocks
+
+import (
+	"avito-tech-go/internal/domain"
+	"context"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockSecurityEventRepository struct {
+	mock.Mock
+}
+
+func (m *MockSecurityEventRepository) CreateEvent(ctx context.Context, event *domain.SecurityEvent) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+func (m *MockSecurityEventRepository) GetEventsByType(ctx context.Context, eventType string) ([]domain.SecurityEvent, error) {
+	args := m.Called(ctx, eventType)
+	events, _ := args.Get(0).([]domain.SecurityEvent)
+	return events, args.Error(1)
+}
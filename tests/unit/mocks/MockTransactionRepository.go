@@ -1,7 +1,11 @@
 package mocks
 
 import (
+	"context"
+	"time"
+
 	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -9,19 +13,81 @@ type MockTransactionRepository struct {
 	mock.Mock
 }
 
-func (m *MockTransactionRepository) CreateTransaction(tx *domain.Transaction) error {
-	args := m.Called(tx)
+func (m *MockTransactionRepository) CreateTransaction(ctx context.Context, tx *domain.Transaction) error {
+	args := m.Called(ctx, tx)
 	return args.Error(0)
 }
 
-func (m *MockTransactionRepository) GetUserTransactions(userID uint) ([]domain.Transaction, error) {
-	args := m.Called(userID)
+func (m *MockTransactionRepository) GetUserTransactions(ctx context.Context, userID uint) ([]domain.Transaction, error) {
+	args := m.Called(ctx, userID)
 	txList, _ := args.Get(0).([]domain.Transaction)
 	return txList, args.Error(1)
 }
 
-func (m *MockTransactionRepository) GetTransactionsByType(userID uint, txType domain.TransactionType) ([]domain.Transaction, error) {
-	args := m.Called(userID, txType)
+func (m *MockTransactionRepository) GetTransactionsByType(ctx context.Context, userID uint, txType domain.TransactionType) ([]domain.Transaction, error) {
+	args := m.Called(ctx, userID, txType)
 	txList, _ := args.Get(0).([]domain.Transaction)
 	return txList, args.Error(1)
 }
+
+func (m *MockTransactionRepository) GetUserHistory(ctx context.Context, query repositories.HistoryQuery) ([]domain.Transaction, error) {
+	args := m.Called(ctx, query)
+	txs, _ := args.Get(0).([]domain.Transaction)
+	return txs, args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetTransactionByID(ctx context.Context, id uint) (*domain.Transaction, error) {
+	args := m.Called(ctx, id)
+	tx, _ := args.Get(0).(*domain.Transaction)
+	return tx, args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetReversalOf(ctx context.Context, id uint) (*domain.Transaction, error) {
+	args := m.Called(ctx, id)
+	tx, _ := args.Get(0).(*domain.Transaction)
+	return tx, args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetTransferStats(ctx context.Context, userID uint, since time.Time) (repositories.TransferStats, error) {
+	args := m.Called(ctx, userID, since)
+	stats, _ := args.Get(0).(repositories.TransferStats)
+	return stats, args.Error(1)
+}
+
+func (m *MockTransactionRepository) IssueCoins(ctx context.Context, userID uint, amount int) error {
+	args := m.Called(ctx, userID, amount)
+	return args.Error(0)
+}
+
+func (m *MockTransactionRepository) GetAccountBalance(ctx context.Context, code string) (int, error) {
+	args := m.Called(ctx, code)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetLedgerTotal(ctx context.Context) (int, error) {
+	args := m.Called(ctx)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetBalanceDrifts(ctx context.Context) ([]domain.BalanceDrift, error) {
+	args := m.Called(ctx)
+	drifts, _ := args.Get(0).([]domain.BalanceDrift)
+	return drifts, args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetUnbalancedTransactionIDs(ctx context.Context) ([]uint, error) {
+	args := m.Called(ctx)
+	ids, _ := args.Get(0).([]uint)
+	return ids, args.Error(1)
+}
+
+func (m *MockTransactionRepository) GetUserIDsWithoutAccount(ctx context.Context) ([]uint, error) {
+	args := m.Called(ctx)
+	ids, _ := args.Get(0).([]uint)
+	return ids, args.Error(1)
+}
+
+func (m *MockTransactionRepository) HasUserAccount(ctx context.Context, userID uint) (bool, error) {
+	args := m.Called(ctx, userID)
+	return args.Bool(0), args.Error(1)
+}
@@ -0,0 +1,24 @@
+package mocks
+
+import (
+	"avito-tech-go/internal/repositories"
+	"context"
+)
+
+// MockUnitOfWork runs the callback directly against the configured repositories,
+// without opening a database transaction.
+type MockUnitOfWork struct {
+	Repos *repositories.Repositories
+}
+
+func NewMockUnitOfWork(repos *repositories.Repositories) *MockUnitOfWork {
+	return &MockUnitOfWork{Repos: repos}
+}
+
+func (m *MockUnitOfWork) Do(_ context.Context, fn func(repos *repositories.Repositories) error) error {
+	return fn(m.Repos)
+}
+
+func (m *MockUnitOfWork) ReadSnapshot(_ context.Context, fn func(repos *repositories.Repositories) error) error {
+	return fn(m.Repos)
+}
@@ -2,6 +2,7 @@ package mocks
 
 import (
 	"avito-tech-go/internal/domain"
+	"context"
 	"github.com/stretchr/testify/mock"
 )
 
@@ -9,44 +10,72 @@ type MockUserRepository struct {
 	mock.Mock
 }
 
-func (m *MockUserRepository) CreateUser(user *domain.User) error {
-	args := m.Called(user)
+func (m *MockUserRepository) CreateUser(ctx context.Context, user *domain.User) error {
+	args := m.Called(ctx, user)
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) UpdateUser(user *domain.User) error {
-	args := m.Called(user)
+func (m *MockUserRepository) UpdateUser(ctx context.Context, user *domain.User) error {
+	args := m.Called(ctx, user)
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) GetUserByID(ID uint) (*domain.User, error) {
-	args := m.Called(ID)
+func (m *MockUserRepository) GetUserByID(ctx context.Context, ID uint) (*domain.User, error) {
+	args := m.Called(ctx, ID)
 	user, _ := args.Get(0).(*domain.User)
 	return user, args.Error(1)
 }
 
-func (m *MockUserRepository) GetUserByName(username string) (*domain.User, error) {
-	args := m.Called(username)
+func (m *MockUserRepository) GetUserByName(ctx context.Context, username string) (*domain.User, error) {
+	args := m.Called(ctx, username)
 	user, _ := args.Get(0).(*domain.User)
 	return user, args.Error(1)
 }
 
-func (m *MockUserRepository) DeleteUser(user *domain.User) error {
-	args := m.Called(user)
+func (m *MockUserRepository) DeleteUser(ctx context.Context, user *domain.User) error {
+	args := m.Called(ctx, user)
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) ExistsByUsername(username string) (bool, error) {
-	args := m.Called(username)
+func (m *MockUserRepository) ExistsByUsername(ctx context.Context, username string) (bool, error) {
+	args := m.Called(ctx, username)
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockUserRepository) ChangeCoins(userID int, delta int) error {
-	args := m.Called(userID, delta)
+func (m *MockUserRepository) ChangeCoins(ctx context.Context, userID uint, delta int) error {
+	args := m.Called(ctx, userID, delta)
 	return args.Error(0)
 }
 
-func (m *MockUserRepository) GetUsernamesByIDs(ids []uint) (map[uint]string, error) {
-	args := m.Called(ids)
+func (m *MockUserRepository) ForceChangeCoins(ctx context.Context, userID uint, delta int) error {
+	args := m.Called(ctx, userID, delta)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) GetUsernamesByIDs(ctx context.Context, ids []uint) (map[uint]string, error) {
+	args := m.Called(ctx, ids)
 	return args.Get(0).(map[uint]string), args.Error(1)
 }
+
+func (m *MockUserRepository) GetUsersByNames(ctx context.Context, usernames []string) (map[string]*domain.User, error) {
+	args := m.Called(ctx, usernames)
+	users, _ := args.Get(0).(map[string]*domain.User)
+	return users, args.Error(1)
+}
+
+func (m *MockUserRepository) LockUsersByIDs(ctx context.Context, ids []uint) (map[uint]*domain.User, error) {
+	args := m.Called(ctx, ids)
+	users, _ := args.Get(0).(map[uint]*domain.User)
+	return users, args.Error(1)
+}
+
+func (m *MockUserRepository) GetAllUsers(ctx context.Context) ([]domain.User, error) {
+	args := m.Called(ctx)
+	users, _ := args.Get(0).([]domain.User)
+	return users, args.Error(1)
+}
+
+func (m *MockUserRepository) SyncAdmins(ctx context.Context, usernames []string) error {
+	args := m.Called(ctx, usernames)
+	return args.Error(0)
+}
@@ -0,0 +1,58 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	deadlineOf := func(timeout time.Duration) (time.Time, bool) {
+		var deadline time.Time
+		var ok bool
+		r := gin.New()
+		r.Use(middleware.TimeoutMiddleware(timeout))
+		r.GET("/", func(c *gin.Context) {
+			deadline, ok = c.Request.Context().Deadline()
+			c.Status(http.StatusNoContent)
+		})
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		return deadline, ok
+	}
+
+	t.Run("Sets the deadline", func(t *testing.T) {
+		start := time.Now()
+		deadline, ok := deadlineOf(5 * time.Second)
+		assert.True(t, ok)
+		assert.WithinDuration(t, start.Add(5*time.Second), deadline, time.Second)
+	})
+
+	t.Run("Zero timeout sets no deadline", func(t *testing.T) {
+		_, ok := deadlineOf(0)
+		assert.False(t, ok)
+	})
+
+	t.Run("Context is cancelled after the request", func(t *testing.T) {
+		r := gin.New()
+		r.Use(middleware.TimeoutMiddleware(time.Minute))
+		var done <-chan struct{}
+		r.GET("/", func(c *gin.Context) {
+			done = c.Request.Context().Done()
+			c.Status(http.StatusNoContent)
+		})
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		select {
+		case <-done:
+		default:
+			t.Fatal("request context is still live")
+		}
+	})
+}
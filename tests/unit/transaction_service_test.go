@@ -1,7 +1,9 @@
 package unit
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"testing"
 
 	"avito-tech-go/internal/domain"
@@ -17,7 +19,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	if err != nil {
 		t.Fatalf("failed to open in-memory sqlite database: %v", err)
 	}
-	err = db.AutoMigrate(&domain.User{}, &domain.Transaction{})
+	err = db.AutoMigrate(&domain.User{}, &domain.Transaction{}, &domain.LedgerAccount{}, &domain.LedgerEntry{}, &domain.TransferLimit{})
 	if err != nil {
 		t.Fatalf("failed to migrate models: %v", err)
 	}
@@ -25,35 +27,30 @@ func setupTestDB(t *testing.T) *gorm.DB {
 }
 
 func TestTransactionService_TransferCoins(t *testing.T) {
+	ctx := context.Background()
 	t.Run("same user", func(t *testing.T) {
 		db := setupTestDB(t)
-		userRepo := repositories.NewUserRepository(db)
-		txRepo := repositories.NewTransactionRepository(db)
-		txService := services.NewTransactionService(userRepo, txRepo, db)
+		txService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
 
-		err := txService.TransferCoins(1, 1, 100)
+		err := txService.TransferCoins(ctx, 1, 1, 100, services.TransferNote{})
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "cannot transfer coins to yourself")
 	})
 
 	t.Run("amount <= 0", func(t *testing.T) {
 		db := setupTestDB(t)
-		userRepo := repositories.NewUserRepository(db)
-		txRepo := repositories.NewTransactionRepository(db)
-		txService := services.NewTransactionService(userRepo, txRepo, db)
+		txService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
 
-		err := txService.TransferCoins(1, 2, 0)
+		err := txService.TransferCoins(ctx, 1, 2, 0, services.TransferNote{})
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "must be greater than 0")
 	})
 
 	t.Run("from user not found", func(t *testing.T) {
 		db := setupTestDB(t)
-		userRepo := repositories.NewUserRepository(db)
-		txRepo := repositories.NewTransactionRepository(db)
-		txService := services.NewTransactionService(userRepo, txRepo, db)
+		txService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
 
-		err := txService.TransferCoins(1, 2, 10)
+		err := txService.TransferCoins(ctx, 1, 2, 10, services.TransferNote{})
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "user 1 not found")
 	})
@@ -61,15 +58,14 @@ func TestTransactionService_TransferCoins(t *testing.T) {
 	t.Run("to user not found", func(t *testing.T) {
 		db := setupTestDB(t)
 		userRepo := repositories.NewUserRepository(db)
-		txRepo := repositories.NewTransactionRepository(db)
 		user1 := &domain.User{Coins: 100}
-		err := userRepo.CreateUser(user1)
+		err := userRepo.CreateUser(ctx, user1)
 		if err != nil {
 			t.Fatalf("failed to create user1: %v", err)
 		}
-		txService := services.NewTransactionService(userRepo, txRepo, db)
+		txService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
 
-		err = txService.TransferCoins(user1.ID, 9999, 10)
+		err = txService.TransferCoins(ctx, user1.ID, 9999, 10, services.TransferNote{})
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), fmt.Sprintf("user %d not found", 9999))
 	})
@@ -77,18 +73,17 @@ func TestTransactionService_TransferCoins(t *testing.T) {
 	t.Run("not enough coins", func(t *testing.T) {
 		db := setupTestDB(t)
 		userRepo := repositories.NewUserRepository(db)
-		txRepo := repositories.NewTransactionRepository(db)
 		user1 := &domain.User{Username: "user1", Coins: 5}
 		user2 := &domain.User{Username: "user2", Coins: 50}
-		if err := userRepo.CreateUser(user1); err != nil {
+		if err := userRepo.CreateUser(ctx, user1); err != nil {
 			t.Fatalf("failed to create user1: %v", err)
 		}
-		if err := userRepo.CreateUser(user2); err != nil {
+		if err := userRepo.CreateUser(ctx, user2); err != nil {
 			t.Fatalf("failed to create user2: %v", err)
 		}
-		txService := services.NewTransactionService(userRepo, txRepo, db)
+		txService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
 
-		err := txService.TransferCoins(user1.ID, user2.ID, 10)
+		err := txService.TransferCoins(ctx, user1.ID, user2.ID, 10, services.TransferNote{})
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), fmt.Sprintf("user %d does not have enough coins", user1.ID))
 	})
@@ -99,29 +94,29 @@ func TestTransactionService_TransferCoins(t *testing.T) {
 		txRepo := repositories.NewTransactionRepository(db)
 		user1 := &domain.User{Username: "user1", Coins: 100}
 		user2 := &domain.User{Username: "user2", Coins: 50}
-		if err := userRepo.CreateUser(user1); err != nil {
+		if err := userRepo.CreateUser(ctx, user1); err != nil {
 			t.Fatalf("failed to create user1: %v", err)
 		}
-		if err := userRepo.CreateUser(user2); err != nil {
+		if err := userRepo.CreateUser(ctx, user2); err != nil {
 			t.Fatalf("failed to create user2: %v", err)
 		}
-		txService := services.NewTransactionService(userRepo, txRepo, db)
+		txService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
 
-		err := txService.TransferCoins(user1.ID, user2.ID, 10)
+		err := txService.TransferCoins(ctx, user1.ID, user2.ID, 10, services.TransferNote{})
 		assert.NoError(t, err)
 
-		updatedUser1, err := userRepo.GetUserByID(user1.ID)
+		updatedUser1, err := userRepo.GetUserByID(ctx, user1.ID)
 		if err != nil {
 			t.Fatalf("failed to get user1: %v", err)
 		}
-		updatedUser2, err := userRepo.GetUserByID(user2.ID)
+		updatedUser2, err := userRepo.GetUserByID(ctx, user2.ID)
 		if err != nil {
 			t.Fatalf("failed to get user2: %v", err)
 		}
 		assert.Equal(t, 90, updatedUser1.Coins)
 		assert.Equal(t, 60, updatedUser2.Coins)
 
-		txs, err := txRepo.GetUserTransactions(user1.ID)
+		txs, err := txRepo.GetUserTransactions(ctx, user1.ID)
 		if err != nil {
 			t.Fatalf("failed to get transactions: %v", err)
 		}
@@ -133,4 +128,42 @@ func TestTransactionService_TransferCoins(t *testing.T) {
 		assert.Equal(t, 10, txRecord.Amount)
 		assert.Equal(t, domain.Transfer, txRecord.Type)
 	})
+
+	t.Run("note is sanitized and stored", func(t *testing.T) {
+		db := setupTestDB(t)
+		userRepo := repositories.NewUserRepository(db)
+		txRepo := repositories.NewTransactionRepository(db)
+		user1 := &domain.User{Username: "user1", Coins: 100}
+		user2 := &domain.User{Username: "user2", Coins: 50}
+		if err := userRepo.CreateUser(ctx, user1); err != nil {
+			t.Fatalf("failed to create user1: %v", err)
+		}
+		if err := userRepo.CreateUser(ctx, user2); err != nil {
+			t.Fatalf("failed to create user2: %v", err)
+		}
+		txService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
+
+		note := services.TransferNote{Message: "  thanks\x00 for\nlunch\u200b  ", Category: " Lunch "}
+		err := txService.TransferCoins(ctx, user1.ID, user2.ID, 10, note)
+		assert.NoError(t, err)
+
+		txs, err := txRepo.GetUserTransactions(ctx, user1.ID)
+		if err != nil {
+			t.Fatalf("failed to get transactions: %v", err)
+		}
+		assert.Len(t, txs, 1)
+		assert.Equal(t, "thanks for lunch", txs[0].Message)
+		assert.Equal(t, "lunch", txs[0].Category)
+	})
+
+	t.Run("invalid note", func(t *testing.T) {
+		db := setupTestDB(t)
+		txService := services.NewTransactionService(repositories.NewUnitOfWork(db), nil)
+
+		err := txService.TransferCoins(ctx, 1, 2, 10, services.TransferNote{Message: strings.Repeat("я", services.MaxTransferMessageLength+1)})
+		assert.ErrorIs(t, err, services.ErrTransferMessageTooLong)
+
+		err = txService.TransferCoins(ctx, 1, 2, 10, services.TransferNote{Category: "free beer"})
+		assert.ErrorIs(t, err, services.ErrInvalidTransferCategory)
+	})
 }
@@ -0,0 +1,128 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"avito-tech-go/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferLimits(t *testing.T) {
+	ctx := context.Background()
+	setup := func(t *testing.T, defaults services.TransferLimits) (services.TransactionService, services.TransferLimitService, repositories.TransactionRepository, *time.Time, *domain.User, *domain.User) {
+		db := setupTestDB(t)
+		userRepo := repositories.NewUserRepository(db)
+		txRepo := repositories.NewTransactionRepository(db)
+		sender := &domain.User{Username: "sender", Coins: 1000}
+		receiver := &domain.User{Username: "receiver", Coins: 1000}
+		require.NoError(t, userRepo.CreateUser(ctx, sender))
+		require.NoError(t, userRepo.CreateUser(ctx, receiver))
+
+		now := time.Now()
+		limits := services.NewTransferLimitService(repositories.NewTransferLimitRepository(db), txRepo, defaults, func() time.Time { return now })
+		return services.NewTransactionService(repositories.NewUnitOfWork(db), limits), limits, txRepo, &now, sender, receiver
+	}
+
+	sentAt := func(t *testing.T, txRepo repositories.TransactionRepository, from, to *domain.User, amount int, at time.Time) {
+		require.NoError(t, txRepo.CreateTransaction(ctx, &domain.Transaction{
+			FromUserID: from.ID, ToUserID: &to.ID, Amount: amount, Type: domain.Transfer, CreatedAt: at,
+		}))
+	}
+
+	assertLimit := func(t *testing.T, err error, target error, code string) {
+		require.ErrorIs(t, err, target)
+		var limitErr *services.TransferLimitError
+		require.True(t, errors.As(err, &limitErr))
+		assert.Equal(t, code, limitErr.Code)
+	}
+
+	t.Run("per transfer", func(t *testing.T) {
+		txService, _, _, _, sender, receiver := setup(t, services.TransferLimits{MaxAmount: 50})
+
+		err := txService.TransferCoins(ctx, sender.ID, receiver.ID, 51, services.TransferNote{})
+		assertLimit(t, err, services.ErrTransferAmountLimit, services.LimitCodeMaxAmount)
+		assert.NoError(t, txService.TransferCoins(ctx, sender.ID, receiver.ID, 50, services.TransferNote{}))
+	})
+
+	t.Run("daily amount over a rolling window", func(t *testing.T) {
+		txService, _, txRepo, now, sender, receiver := setup(t, services.TransferLimits{DailyAmount: 100})
+		sentAt(t, txRepo, sender, receiver, 80, now.Add(-services.TransferLimitWindow+time.Second))
+		// Transfers received do not count towards the limit.
+		sentAt(t, txRepo, receiver, sender, 500, now.Add(-time.Minute))
+
+		err := txService.TransferCoins(ctx, sender.ID, receiver.ID, 30, services.TransferNote{})
+		assertLimit(t, err, services.ErrDailyAmountLimit, services.LimitCodeDailyAmount)
+		assert.NoError(t, txService.TransferCoins(ctx, sender.ID, receiver.ID, 20, services.TransferNote{}))
+
+		// Exactly 24 hours later the old transfer leaves the window.
+		*now = now.Add(time.Second)
+		assert.NoError(t, txService.TransferCoins(ctx, sender.ID, receiver.ID, 80, services.TransferNote{}))
+		err = txService.TransferCoins(ctx, sender.ID, receiver.ID, 1, services.TransferNote{})
+		assertLimit(t, err, services.ErrDailyAmountLimit, services.LimitCodeDailyAmount)
+	})
+
+	t.Run("daily count over a rolling window", func(t *testing.T) {
+		txService, _, txRepo, now, sender, receiver := setup(t, services.TransferLimits{DailyCount: 2})
+		// Sent exactly 24 hours ago, so already outside the window.
+		sentAt(t, txRepo, sender, receiver, 1, now.Add(-services.TransferLimitWindow))
+		sentAt(t, txRepo, sender, receiver, 1, now.Add(-30*time.Minute))
+
+		assert.NoError(t, txService.TransferCoins(ctx, sender.ID, receiver.ID, 1, services.TransferNote{}))
+		err := txService.TransferCoins(ctx, sender.ID, receiver.ID, 1, services.TransferNote{})
+		assertLimit(t, err, services.ErrDailyCountLimit, services.LimitCodeDailyCount)
+
+		*now = now.Add(23 * time.Hour)
+		err = txService.TransferCoins(ctx, sender.ID, receiver.ID, 1, services.TransferNote{})
+		assertLimit(t, err, services.ErrDailyCountLimit, services.LimitCodeDailyCount)
+		*now = now.Add(time.Hour)
+		assert.NoError(t, txService.TransferCoins(ctx, sender.ID, receiver.ID, 1, services.TransferNote{}))
+	})
+
+	t.Run("batch counts every line", func(t *testing.T) {
+		txService, _, _, _, sender, receiver := setup(t, services.TransferLimits{DailyAmount: 100, DailyCount: 3})
+
+		_, err := txService.TransferCoinsBatch(ctx, sender.ID, []services.BatchTransferLine{
+			{ToUser: receiver.Username, Amount: 60}, {ToUser: receiver.Username, Amount: 60},
+		}, services.TransferNote{})
+		assertLimit(t, err, services.ErrDailyAmountLimit, services.LimitCodeDailyAmount)
+
+		_, err = txService.TransferCoinsBatch(ctx, sender.ID, []services.BatchTransferLine{
+			{ToUser: receiver.Username, Amount: 1}, {ToUser: receiver.Username, Amount: 1},
+			{ToUser: receiver.Username, Amount: 1}, {ToUser: receiver.Username, Amount: 1},
+		}, services.TransferNote{})
+		assertLimit(t, err, services.ErrDailyCountLimit, services.LimitCodeDailyCount)
+	})
+
+	t.Run("override", func(t *testing.T) {
+		txService, limits, _, _, sender, receiver := setup(t, services.TransferLimits{MaxAmount: 50, DailyCount: 1})
+
+		unlimited := 0
+		require.NoError(t, limits.SetOverride(ctx, sender.ID, services.TransferLimitOverride{MaxAmount: &unlimited}))
+		assert.NoError(t, txService.TransferCoins(ctx, sender.ID, receiver.ID, 500, services.TransferNote{}))
+
+		err := txService.TransferCoins(ctx, sender.ID, receiver.ID, 1, services.TransferNote{})
+		assertLimit(t, err, services.ErrDailyCountLimit, services.LimitCodeDailyCount)
+
+		info, err := limits.GetLimits(ctx, sender.ID)
+		require.NoError(t, err)
+		assert.Equal(t, services.TransferLimits{MaxAmount: 0, DailyCount: 1}, info.Limits)
+		assert.Equal(t, 500, info.UsedAmount)
+		assert.Equal(t, 1, info.UsedCount)
+		require.NotNil(t, info.Override)
+
+		require.NoError(t, limits.ClearOverride(ctx, sender.ID))
+		info, err = limits.GetLimits(ctx, sender.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 50, info.Limits.MaxAmount)
+		assert.Nil(t, info.Override)
+
+		negative := -1
+		assert.ErrorIs(t, limits.SetOverride(ctx, sender.ID, services.TransferLimitOverride{DailyAmount: &negative}), services.ErrInvalidTransferLimit)
+	})
+}
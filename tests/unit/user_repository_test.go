@@ -0,0 +1,43 @@
+package unit
+
+import (
+	"context"
+	"testing"
+
+	"avito-tech-go/internal/domain"
+	"avito-tech-go/internal/repositories"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserRepository_ChangeCoins(t *testing.T) {
+	ctx := context.Background()
+	userRepo := repositories.NewUserRepository(setupTestDB(t))
+
+	user := &domain.User{Username: "alice", PasswordHash: "irrelevant", Coins: 50}
+	require.NoError(t, userRepo.CreateUser(ctx, user))
+	coins := func() int {
+		updated, err := userRepo.GetUserByID(ctx, user.ID)
+		require.NoError(t, err)
+		return updated.Coins
+	}
+
+	t.Run("debit above the balance is rejected", func(t *testing.T) {
+		err := userRepo.ChangeCoins(ctx, user.ID, -51)
+		assert.ErrorIs(t, err, repositories.ErrInsufficientCoins)
+		assert.Equal(t, 50, coins())
+	})
+
+	t.Run("debit of the whole balance is applied", func(t *testing.T) {
+		require.NoError(t, userRepo.ChangeCoins(ctx, user.ID, -50))
+		assert.Equal(t, 0, coins())
+
+		assert.ErrorIs(t, userRepo.ChangeCoins(ctx, user.ID, -1), repositories.ErrInsufficientCoins)
+		assert.Equal(t, 0, coins())
+	})
+
+	t.Run("credit is applied", func(t *testing.T) {
+		require.NoError(t, userRepo.ChangeCoins(ctx, user.ID, 30))
+		assert.Equal(t, 30, coins())
+	})
+}
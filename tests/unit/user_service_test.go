@@ -2,6 +2,7 @@ package unit
 
 import (
 	"avito-tech-go/tests/unit/mocks"
+	"context"
 	"errors"
 	"testing"
 
@@ -9,9 +10,11 @@ import (
 	"avito-tech-go/internal/services"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestUserService_GetInfo(t *testing.T) {
+	ctx := context.Background()
 	mockUserRepo := new(mocks.MockUserRepository)
 	mockInvRepo := new(mocks.MockInventoryRepository)
 	mockTxRepo := new(mocks.MockTransactionRepository)
@@ -19,10 +22,10 @@ func TestUserService_GetInfo(t *testing.T) {
 	userSvc := services.NewUserService(mockUserRepo, mockInvRepo, mockTxRepo)
 
 	t.Run("user not found", func(t *testing.T) {
-		mockUserRepo.On("GetUserByID", uint(999)).
+		mockUserRepo.On("GetUserByID", mock.Anything, uint(999)).
 			Return((*domain.User)(nil), nil).Once()
 
-		info, err := userSvc.GetInfo(999)
+		info, err := userSvc.GetInfo(ctx, 999)
 		assert.Error(t, err)
 		assert.Nil(t, info)
 		assert.Contains(t, err.Error(), "user not found")
@@ -32,10 +35,10 @@ func TestUserService_GetInfo(t *testing.T) {
 
 	t.Run("db error on get user", func(t *testing.T) {
 		mockUserRepo.ExpectedCalls = nil
-		mockUserRepo.On("GetUserByID", uint(1)).
+		mockUserRepo.On("GetUserByID", mock.Anything, uint(1)).
 			Return((*domain.User)(nil), errors.New("db error")).Once()
 
-		info, err := userSvc.GetInfo(1)
+		info, err := userSvc.GetInfo(ctx, 1)
 		assert.Error(t, err)
 		assert.Nil(t, info)
 		assert.Contains(t, err.Error(), "db error")
@@ -49,16 +52,16 @@ func TestUserService_GetInfo(t *testing.T) {
 		mockTxRepo.ExpectedCalls = nil
 
 		// Ожидается вызов GetUserByID для основного пользователя (ID=1)
-		mockUserRepo.On("GetUserByID", uint(1)).
+		mockUserRepo.On("GetUserByID", mock.Anything, uint(1)).
 			Return(&domain.User{ID: 1, Username: "alex", Coins: 1000}, nil).Once()
 
-		mockInvRepo.On("GetAllByUser", uint(1)).
+		mockInvRepo.On("GetAllByUser", mock.Anything, uint(1)).
 			Return([]domain.InventoryItem{
 				{ID: 10, UserID: 1, ItemType: "t-shirt", Quantity: 2},
 				{ID: 11, UserID: 1, ItemType: "cup", Quantity: 1},
 			}, nil).Once()
 
-		mockTxRepo.On("GetUserTransactions", uint(1)).
+		mockTxRepo.On("GetUserTransactions", mock.Anything, uint(1)).
 			Return([]domain.Transaction{
 				// Purchase: отправлено в магазин
 				{ID: 1, FromUserID: 1, ToUserID: nil, Amount: 80, Type: domain.Purchase},
@@ -69,12 +72,12 @@ func TestUserService_GetInfo(t *testing.T) {
 			}, nil).Once()
 
 		// Ожидаем вызов GetUsernamesByIDs с параметром []uint{2}
-		mockUserRepo.On("GetUsernamesByIDs", []uint{2}).
+		mockUserRepo.On("GetUsernamesByIDs", mock.Anything, []uint{2}).
 			Return(map[uint]string{2: "bob"}, nil).Once()
 
 		// Удаляем ожидания для GetUserByID(uint(2)), так как они больше не требуются
 
-		info, err := userSvc.GetInfo(1)
+		info, err := userSvc.GetInfo(ctx, 1)
 		assert.NoError(t, err)
 		assert.NotNil(t, info)
 		assert.Equal(t, 1000, info.Coins)